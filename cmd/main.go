@@ -2,18 +2,33 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"nprn/internal/config"
+	"nprn/internal/entity/apikey/apikeystorage/apikeydb"
+	"nprn/internal/entity/attempt/attemptstorage/attemptdb"
+	"nprn/internal/entity/audit/auditstorage/auditdb"
+	"nprn/internal/entity/audit/auditstorage/auditfile"
+	"nprn/internal/entity/revision/revisionstorage/revisiondb"
 	"nprn/internal/entity/sale/salestorage/saledb"
+	"nprn/internal/entity/token/tokenstorage/resetdb"
+	"nprn/internal/entity/token/tokenstorage/revocationdb"
+	"nprn/internal/entity/token/tokenstorage/tokendb"
 	"nprn/internal/entity/user/userstorage/userdb"
 	"nprn/internal/handler"
 	"nprn/internal/service"
 	"nprn/pkg/client/mongodb"
 	"nprn/pkg/logging"
+	"nprn/pkg/mail"
+	"nprn/pkg/money"
 	"nprn/pkg/server"
 	"time"
+	_ "time/tzdata" // time zones of users don't depend on the system
 )
 
+// startupTimeout limits the checks of the data and the creation of indexes before the server is started
+const startupTimeout = 5 * time.Minute
+
 func main() {
 	logger := logging.GetLogger()
 	logger.Info("application is started")
@@ -23,10 +38,10 @@ func main() {
 	router := httprouter.New()
 	myServer := server.NewServer()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	connectCtx, cancelConnect := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelConnect()
 
-	myMongo, err := mongodb.NewClient(ctx,
+	myMongo, err := mongodb.NewClient(connectCtx,
 		cfg.MongoDB.Host, cfg.MongoDB.Port, cfg.MongoDB.Username,
 		cfg.MongoDB.Password, cfg.MongoDB.DBName, cfg.MongoDB.AuthDB)
 	if err != nil {
@@ -35,8 +50,114 @@ func main() {
 
 	myUsers := userdb.NewCollection(myMongo, cfg.MongoDB.UserCollection, logger)
 	mySales := saledb.NewCollection(myMongo, cfg.MongoDB.SaleCollection, logger)
+	myTokens := tokendb.NewCollection(myMongo, cfg.MongoDB.TokenCollection, logger)
+	myRevocations := revocationdb.NewCollection(myMongo, cfg.MongoDB.RevocationCollection, logger)
+	myResets := resetdb.NewCollection(myMongo, cfg.MongoDB.ResetCollection, logger)
+	myAPIKeys := apikeydb.NewCollection(myMongo, cfg.MongoDB.APIKeyCollection, logger)
+	myAttempts := attemptdb.NewCollection(myMongo, cfg.MongoDB.AttemptCollection, logger)
+	myAudit := auditdb.NewCollection(myMongo, cfg.MongoDB.AuditCollection, logger)
+	myRevisions := revisiondb.NewCollection(myMongo, cfg.MongoDB.RevisionCollection, logger)
+
+	// the checks and new indexes can take a while on big collections, the migrations are done by cmd/migrate
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+
+	notNormalized, err := myUsers.CountNotNormalized(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
-	appService := service.NewService(myUsers, mySales, logger)
+	if notNormalized > 0 {
+		logger.Fatalf("%d users are not normalized, run the migration first: go run ./cmd/migrate", notNormalized)
+	}
+
+	err = myUsers.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if _, err = time.LoadLocation(cfg.Sales.TimeZone); err != nil {
+		logger.Fatalf("sales.time_zone: %v", err)
+	}
+
+	if _, ok := money.MinorDigits(cfg.Sales.DefaultCurrency); !ok {
+		logger.Fatalf("sales.default_currency %q is not ISO 4217 code", cfg.Sales.DefaultCurrency)
+	}
+
+	notMigrated, err := mySales.CountNotMigrated(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	if notMigrated > 0 {
+		logger.Fatalf("%d sales are not migrated, run the migration first: go run ./cmd/migrate", notMigrated)
+	}
+
+	err = mySales.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myTokens.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myRevocations.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myResets.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myAPIKeys.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myAttempts.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myAudit.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = myRevisions.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var auditStorage service.AuditStorage = myAudit
+
+	if cfg.Audit.File != "" {
+		auditFile, err := auditfile.NewAuditFile(cfg.Audit.File, myAudit)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		auditStorage = auditFile
+	}
+
+	keys, err := service.LoadKeySet(cfg.JWT)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	appService := service.NewService(myUsers, mySales, myTokens, myRevocations, myResets, myAPIKeys, myAttempts,
+		auditStorage, myRevisions, mailer, keys, cfg, logger)
+
+	go appService.RunTrashPurge(context.Background())
 
 	handl := handler.NewHandler(appService, logger)
 
@@ -44,3 +165,14 @@ func main() {
 
 	logger.Fatal(myServer.Run(router, logger, cfg))
 }
+
+func newMailer(cfg config.Mail) (service.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From), nil
+	case "outbox":
+		return mail.NewOutboxMailer(cfg.OutboxDir, cfg.From)
+	}
+
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
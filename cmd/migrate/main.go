@@ -0,0 +1,114 @@
+// Migrate converts users and sales stored by older versions before the service is started:
+// usernames and emails are normalized and made unique, prices and amounts become decimals,
+// sales get versions and text dates become datetimes. Dates without time are read in the time zone of the seller or in sales.time_zone.
+//
+//	go run ./cmd/migrate
+package main
+
+import (
+	"context"
+	"nprn/internal/config"
+	"nprn/internal/entity/sale/salemodel"
+	"nprn/internal/entity/sale/salestorage/saledb"
+	"nprn/internal/entity/user/userstorage/userdb"
+	"nprn/pkg/client/mongodb"
+	"nprn/pkg/logging"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+func main() {
+	logger := logging.GetLogger()
+	logger.Info("migration is started")
+
+	cfg := config.GetConfig()
+
+	defaultLocation, err := time.LoadLocation(cfg.Sales.TimeZone)
+	if err != nil {
+		logger.Fatalf("sales.time_zone: %v", err)
+	}
+
+	connectCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	myMongo, err := mongodb.NewClient(connectCtx,
+		cfg.MongoDB.Host, cfg.MongoDB.Port, cfg.MongoDB.Username,
+		cfg.MongoDB.Password, cfg.MongoDB.DBName, cfg.MongoDB.AuthDB)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	myUsers := userdb.NewCollection(myMongo, cfg.MongoDB.UserCollection, logger)
+	mySales := saledb.NewCollection(myMongo, cfg.MongoDB.SaleCollection, logger)
+
+	ctx := context.Background()
+
+	err = myUsers.NormalizeAll(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	duplicates, err := myUsers.Duplicates(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	for _, duplicate := range duplicates {
+		logger.Errorf("%s %q is used by users id=%s", duplicate.Field, duplicate.Value, strings.Join(duplicate.UserIDs, ", "))
+	}
+
+	if len(duplicates) > 0 {
+		logger.Fatalf("%d usernames and emails are not unique, change them and run again", len(duplicates))
+	}
+
+	err = myUsers.CreateIndexes(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = mySales.MigrateMoney(ctx, cfg.Sales.DefaultCurrency)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	err = mySales.MigrateVersions(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	locations := make(map[string]*time.Location)
+
+	sellerLocation := func(sellerID string) *time.Location {
+		location, ok := locations[sellerID]
+		if ok {
+			return location
+		}
+
+		location = defaultLocation
+
+		user, err := myUsers.GetByID(ctx, sellerID)
+		if err == nil && user.TimeZone != "" {
+			if userLocation, err := time.LoadLocation(user.TimeZone); err == nil {
+				location = userLocation
+			}
+		}
+
+		locations[sellerID] = location
+
+		return location
+	}
+
+	migrated, failed, err := mySales.MigrateDates(ctx, func(date string, sellerID string) (time.Time, error) {
+		return salemodel.ParseDate(date, cfg.Sales.DateLayouts, sellerLocation(sellerID))
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Infof("dates of %d sales are migrated", migrated)
+
+	if failed > 0 {
+		logger.Fatalf("dates of %d sales are not migrated, add their layouts to sales.date_layouts and run again", failed)
+	}
+}
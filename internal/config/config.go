@@ -4,29 +4,167 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"nprn/pkg/logging"
 	"sync"
+	"time"
 )
 
 type Config struct {
-	IsDebug bool    `yaml:"is_debug"`
-	Listen  Listen  `yaml:"listen"`
-	MongoDB MongoDB `yaml:"mongo_db"`
+	IsDebug  bool     `yaml:"is_debug"`
+	Listen   Listen   `yaml:"listen"`
+	MongoDB  MongoDB  `yaml:"mongo_db"`
+	JWT      JWT      `yaml:"jwt"`
+	Password Password `yaml:"password"`
+	Lockout  Lockout  `yaml:"lockout"`
+	Mail     Mail     `yaml:"mail"`
+	// Verification of emails
+	Verification Verification `yaml:"verification"`
+	// PasswordReset by email
+	PasswordReset PasswordReset `yaml:"password_reset"`
+	MFA           MFA           `yaml:"mfa"`
+	Audit         Audit         `yaml:"audit"`
+	Sales         Sales         `yaml:"sales"`
 }
 
 type Listen struct {
 	Type   string `yaml:"type" env-default:"tcp"`
 	Port   string `yaml:"port" env-default:"8080"`
 	BindIP string `yaml:"bind_ip" env-default:"0.0.0.0"`
+	// TrustProxy takes the client address from X-Forwarded-For, enable it only behind a reverse proxy
+	TrustProxy bool `yaml:"trust_proxy"`
+	// ProxyHops is the number of trusted proxies, each of them appends an address to X-Forwarded-For,
+	// the client is the address appended by the first of them
+	ProxyHops int `yaml:"proxy_hops" env-default:"1"`
 }
 
 type MongoDB struct {
-	Host           string `yaml:"host"`
-	Port           string `yaml:"port"`
-	DBName         string `yaml:"db_name"`
-	UserCollection string `yaml:"user_collection"`
-	SaleCollection string `yaml:"sale_collection"`
-	AuthDB         string `yaml:"auth_db"`
-	Username       string `yaml:"username"`
-	Password       string `yaml:"password"`
+	Host                 string `yaml:"host"`
+	Port                 string `yaml:"port"`
+	DBName               string `yaml:"db_name"`
+	UserCollection       string `yaml:"user_collection"`
+	SaleCollection       string `yaml:"sale_collection"`
+	TokenCollection      string `yaml:"token_collection" env-default:"refresh_tokens"`
+	RevocationCollection string `yaml:"revocation_collection" env-default:"revoked_tokens"`
+	APIKeyCollection     string `yaml:"api_key_collection" env-default:"api_keys"`
+	AttemptCollection    string `yaml:"attempt_collection" env-default:"login_attempts"`
+	ResetCollection      string `yaml:"reset_collection" env-default:"password_resets"`
+	AuditCollection      string `yaml:"audit_collection" env-default:"audit_log"`
+	RevisionCollection   string `yaml:"revision_collection" env-default:"sale_revisions"`
+	AuthDB               string `yaml:"auth_db"`
+	Username             string `yaml:"username"`
+	Password             string `yaml:"password"`
+}
+
+type JWT struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// RevocationCacheTTL is how long revocations made by other instances may be unnoticed
+	RevocationCacheTTL time.Duration `yaml:"revocation_cache_ttl" env-default:"30s"`
+	SigningKey         string        `yaml:"signing_key"`
+	Keys               []JWTKey      `yaml:"keys"`
+}
+
+// JWTKey is a HMAC secret or a PEM file with a private (signing) or a public (verification only) key
+type JWTKey struct {
+	ID        string `yaml:"id"`
+	Algorithm string `yaml:"algorithm"`
+	Secret    string `yaml:"secret"`
+	File      string `yaml:"file"`
+}
+
+// Password is argon2id cost, hashes made with other params are upgraded on the next sign-in
+type Password struct {
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+	SaltLength  uint32 `yaml:"salt_length" env-default:"16"`
+	KeyLength   uint32 `yaml:"key_length" env-default:"32"`
+}
+
+// Lockout slows down password guessing. After the threshold of failed sign-ins every next failure
+// locks the username (or the client address) for BaseDelay, 2*BaseDelay, 4*BaseDelay... up to MaxDelay.
+// Failures are forgotten after Window without new ones.
+type Lockout struct {
+	Enabled       bool          `yaml:"enabled" env-default:"true"`
+	UserThreshold int           `yaml:"user_threshold" env-default:"5"`
+	IPThreshold   int           `yaml:"ip_threshold" env-default:"20"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"30s"`
+	MaxDelay      time.Duration `yaml:"max_delay" env-default:"1h"`
+	Window        time.Duration `yaml:"window" env-default:"24h"`
+}
+
+// Mail is sent with the "smtp" driver or written to OutboxDir with the "outbox" driver
+type Mail struct {
+	Driver    string `yaml:"driver" env-default:"outbox"`
+	From      string `yaml:"from" env-default:"noreply@nprn.local"`
+	Host      string `yaml:"host"`
+	Port      string `yaml:"port" env-default:"587"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password" env:"MAIL_PASSWORD"`
+	OutboxDir string `yaml:"outbox_dir" env-default:"outbox"`
+}
+
+// Verification links are LinkURL?token=..., the page posts the token to /auth/verify-email.
+// A new link can be sent once per ResendInterval and at most ResendLimit times per ResendWindow.
+type Verification struct {
+	// Required blocks users with unverified emails from the sales API
+	Required       bool          `yaml:"required"`
+	LinkURL        string        `yaml:"link_url" env-default:"http://127.0.0.1:8081/verify-email"`
+	TokenTTL       time.Duration `yaml:"token_ttl" env-default:"24h"`
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	ResendLimit    int           `yaml:"resend_limit" env-default:"5"`
+	ResendWindow   time.Duration `yaml:"resend_window" env-default:"24h"`
+}
+
+// PasswordReset links are LinkURL?token=..., the page posts the token with a new password to /auth/password/reset.
+// A link can be requested for an email once per Interval and at most Limit times per Window.
+type PasswordReset struct {
+	LinkURL  string        `yaml:"link_url" env-default:"http://127.0.0.1:8081/reset-password"`
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"1h"`
+	Interval time.Duration `yaml:"interval" env-default:"1m"`
+	Limit    int           `yaml:"limit" env-default:"5"`
+	Window   time.Duration `yaml:"window" env-default:"24h"`
+}
+
+// MFA is TOTP second factor. Users of RequiredRoles must enroll it and sign in with it
+// to use anything except their own account, Skew is the number of accepted 30 second steps of clock drift.
+type MFA struct {
+	Issuer        string        `yaml:"issuer" env-default:"NPRN"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	Skew          int           `yaml:"skew" env-default:"1"`
+	RecoveryCodes int           `yaml:"recovery_codes" env-default:"10"`
+	RequiredRoles []string      `yaml:"required_roles" env-default:"admin,manager"`
+}
+
+// Audit events are stored in MongoDB.AuditCollection, File is an optional NDJSON copy for log shippers
+type Audit struct {
+	File string `yaml:"file"`
+}
+
+// Sales are in DefaultCurrency if the client doesn't send the currency, it is ISO 4217 code.
+// The amount is computed by the server, with StrictAmount a sent amount which differs is rejected.
+// Dates without time start the day in the time zone of the user, or in TimeZone (IANA name) for users without one.
+// DateLayouts are Go layouts accepted besides RFC 3339 and YYYY-MM-DD, they are used by the migration too.
+// With RequireIfMatch PUT, PATCH and DELETE of a sale need If-Match with its ETag.
+// Deleted sales stay in the trash for TrashRetention, zero keeps them forever. The trash is purged every PurgeInterval.
+type Sales struct {
+	DefaultCurrency string        `yaml:"default_currency" env-default:"USD"`
+	StrictAmount    bool          `yaml:"strict_amount"`
+	TimeZone        string        `yaml:"time_zone" env-default:"UTC"`
+	DateLayouts     []string      `yaml:"date_layouts" env-default:"02-01-2006"`
+	RequireIfMatch  bool          `yaml:"require_if_match"`
+	TrashRetention  time.Duration `yaml:"trash_retention" env-default:"720h"`
+	PurgeInterval   time.Duration `yaml:"purge_interval" env-default:"1h"`
+	Import          Import        `yaml:"import"`
+}
+
+// Import limits one import of sales, it is inserted by BatchSize sales. CSV has a header, Columns maps
+// the fields of a sale to the columns of the header, the fields which are not in Columns are read from the columns
+// named as the fields. Delimiter is one character.
+type Import struct {
+	MaxRows   int               `yaml:"max_rows" env-default:"10000"`
+	MaxSize   int64             `yaml:"max_size" env-default:"10485760"`
+	BatchSize int               `yaml:"batch_size" env-default:"500"`
+	Delimiter string            `yaml:"delimiter" env-default:","`
+	Columns   map[string]string `yaml:"columns"`
 }
 
 var instance *Config
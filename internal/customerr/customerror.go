@@ -1,19 +1,62 @@
 package customerr
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
+var BadRequest *CustomError = NewCustomError(nil, "bad request")
 var NotFoundErr *CustomError = NewCustomError(nil, "not found")
 var NotAcceptable *CustomError = NewCustomError(nil, "not acceptable (maybe the username is not unique)")
+var Unauthorized *CustomError = NewCustomError(nil, "unauthorized")
+var Forbidden *CustomError = NewCustomError(nil, "forbidden: not enough permissions")
+var TooManyRequests *CustomError = NewCustomError(nil, "too many requests")
+var Conflict *CustomError = NewCustomError(nil, "conflict")
+var Unprocessable *CustomError = NewCustomError(nil, "unprocessable entity")
+var UnsupportedMediaType *CustomError = NewCustomError(nil, "unsupported media type")
+var PreconditionFailed *CustomError = NewCustomError(nil, "precondition failed")
+var PreconditionRequired *CustomError = NewCustomError(nil, "precondition required")
 
 type CustomError struct {
 	Err     error  `json:"-"`
 	Message string `json:"message,omitempty"`
+	// RetryAfter is in seconds, it is sent in the Retry-After header too
+	RetryAfter int64 `json:"retry_after,omitempty"`
+	// Field is the field of the request which caused the error
+	Field string `json:"field,omitempty"`
+	// Errors are the fields of the request which are not valid
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 func NewCustomError(err error, message string) *CustomError {
 	return &CustomError{Err: err, Message: message}
 }
 
+// NewRetryAfterError is TooManyRequests telling the client when to try again
+func NewRetryAfterError(message string, retryAfter time.Duration) *CustomError {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return &CustomError{Err: TooManyRequests, Message: message, RetryAfter: seconds}
+}
+
+// NewConflictError is Conflict for a value which has to be unique, like the username
+func NewConflictError(field string, message string) *CustomError {
+	return &CustomError{Err: Conflict, Message: message, Field: field}
+}
+
+// NewValidationError is Unprocessable listing all invalid fields, so the client can show them at once
+func NewValidationError(errors []FieldError) *CustomError {
+	return &CustomError{Err: Unprocessable, Message: "validation failed", Errors: errors}
+}
+
 func (e *CustomError) Error() string {
 	return e.Message
 }
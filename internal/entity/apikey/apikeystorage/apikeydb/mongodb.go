@@ -0,0 +1,130 @@
+package apikeydb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/apikey/apikeymodel"
+	"nprn/pkg/logging"
+	"time"
+)
+
+type APIKeyDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *APIKeyDB {
+	return &APIKeyDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+func (a *APIKeyDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+
+	_, err := a.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create api key indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (a *APIKeyDB) Create(ctx context.Context, key apikeymodel.APIKey) (string, error) {
+	result, err := a.collection.InsertOne(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create api key: %v", err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
+	}
+	a.logger.Tracef("api key id=%s is created for user id=%s", objID.Hex(), key.UserID)
+
+	return objID.Hex(), nil
+}
+
+func (a *APIKeyDB) GetByHash(ctx context.Context, hash string) (apikeymodel.APIKey, error) {
+	filter := bson.M{"hash": hash}
+
+	result := a.collection.FindOne(ctx, filter)
+	if result.Err() != nil {
+		return apikeymodel.APIKey{}, fmt.Errorf("failed to find api key: %v", result.Err())
+	}
+
+	var key apikeymodel.APIKey
+
+	err := result.Decode(&key)
+	if err != nil {
+		return apikeymodel.APIKey{}, fmt.Errorf("failed to decode api key: %v", err)
+	}
+
+	return key, nil
+}
+
+func (a *APIKeyDB) GetByUser(ctx context.Context, userID string) ([]apikeymodel.APIKey, error) {
+	filter := bson.M{"user_id": userID}
+
+	cursor, err := a.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api keys: %v", err)
+	}
+
+	keys := []apikeymodel.APIKey{}
+
+	err = cursor.All(ctx, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %v", err)
+	}
+
+	return keys, nil
+}
+
+// Revoke returns false if the user has no active key with the id
+func (a *APIKeyDB) Revoke(ctx context.Context, id string, userID string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, nil
+	}
+
+	filter := bson.M{"_id": objID, "user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}}
+
+	result, err := a.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute revoke api key: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (a *APIKeyDB) UpdateLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert api key id=%v to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$set": bson.M{"last_used_at": lastUsedAt}}
+
+	_, err = a.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute update api key last use: %v", err)
+	}
+
+	return nil
+}
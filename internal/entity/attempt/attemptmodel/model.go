@@ -0,0 +1,12 @@
+package attemptmodel
+
+import "time"
+
+// Attempt counts failed sign-ins for a key like "user:<username>" or "ip:<address>"
+type Attempt struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
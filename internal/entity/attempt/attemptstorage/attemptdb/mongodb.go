@@ -0,0 +1,109 @@
+package attemptdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/attempt/attemptmodel"
+	"nprn/pkg/logging"
+	"time"
+)
+
+type AttemptDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *AttemptDB {
+	return &AttemptDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes lets mongo forget failures after the window
+func (a *AttemptDB) CreateIndexes(ctx context.Context) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	_, err := a.collection.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return fmt.Errorf("failed to create attempt indexes: %v", err)
+	}
+
+	return nil
+}
+
+// Get returns an empty attempt if there were no failures
+func (a *AttemptDB) Get(ctx context.Context, key string) (attemptmodel.Attempt, error) {
+	result := a.collection.FindOne(ctx, bson.M{"_id": key})
+	if errors.Is(result.Err(), mongo.ErrNoDocuments) {
+		return attemptmodel.Attempt{Key: key}, nil
+	}
+
+	if result.Err() != nil {
+		return attemptmodel.Attempt{}, fmt.Errorf("failed to find attempt %s: %v", key, result.Err())
+	}
+
+	var attempt attemptmodel.Attempt
+
+	err := result.Decode(&attempt)
+	if err != nil {
+		return attemptmodel.Attempt{}, fmt.Errorf("failed to decode attempt: %v", err)
+	}
+
+	return attempt, nil
+}
+
+// AddFailure increments failures atomically and returns the updated attempt
+func (a *AttemptDB) AddFailure(ctx context.Context, key string, window time.Duration) (attemptmodel.Attempt, error) {
+	now := time.Now().UTC()
+
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": now, "expires_at": now.Add(window)},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	result := a.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts)
+	if result.Err() != nil {
+		return attemptmodel.Attempt{}, fmt.Errorf("failed to add failed attempt %s: %v", key, result.Err())
+	}
+
+	var attempt attemptmodel.Attempt
+
+	err := result.Decode(&attempt)
+	if err != nil {
+		return attemptmodel.Attempt{}, fmt.Errorf("failed to decode attempt: %v", err)
+	}
+
+	return attempt, nil
+}
+
+func (a *AttemptDB) Lock(ctx context.Context, key string, until time.Time) error {
+	update := bson.M{"$set": bson.M{"locked_until": until}, "$max": bson.M{"expires_at": until}}
+
+	_, err := a.collection.UpdateOne(ctx, bson.M{"_id": key}, update)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %v", key, err)
+	}
+
+	a.logger.Infof("%s is locked until %v", key, until)
+
+	return nil
+}
+
+func (a *AttemptDB) Delete(ctx context.Context, key string) error {
+	_, err := a.collection.DeleteOne(ctx, bson.M{"_id": key})
+	if err != nil {
+		return fmt.Errorf("failed to delete attempt %s: %v", key, err)
+	}
+
+	return nil
+}
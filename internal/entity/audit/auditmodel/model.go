@@ -0,0 +1,76 @@
+package auditmodel
+
+import "time"
+
+// Event types
+const (
+	TypeSignUp          = "sign_up"
+	TypeSignIn          = "sign_in"
+	TypeSignInMFA       = "sign_in_mfa"
+	TypeRefresh         = "token_refresh"
+	TypeLogout          = "logout"
+	TypeLogoutAll       = "logout_all"
+	TypeTokenRevoked    = "token_revoked"
+	TypeTokenRejected   = "token_rejected"
+	TypeTokenAccepted   = "token_accepted"
+	TypeAccessDenied    = "access_denied"
+	TypeEmailVerified   = "email_verified"
+	TypePasswordForgot  = "password_forgot"
+	TypePasswordReset   = "password_reset"
+	TypePasswordChanged = "password_changed"
+	TypeAccountUpdated  = "account_updated"
+	TypeAccountDeleted  = "account_deleted"
+	TypeMFAEnabled      = "mfa_enabled"
+	TypeMFADisabled     = "mfa_disabled"
+	TypeRecoveryCodes   = "mfa_recovery_codes"
+	TypeAPIKeyCreated   = "api_key_created"
+	TypeAPIKeyRevoked   = "api_key_revoked"
+
+	// actions of admins, the user is TargetID
+	TypeTokensRevoked       = "tokens_revoked"
+	TypeUserDisabled        = "user_disabled"
+	TypeUserEnabled         = "user_enabled"
+	TypeRoleChanged         = "role_changed"
+	TypePasswordResetForced = "password_reset_forced"
+	TypeUserUnlocked        = "user_unlocked"
+	TypeAddressUnlocked     = "address_unlocked"
+)
+
+// Outcomes
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeChallenge is a correct password of a user with the second factor
+	OutcomeChallenge = "challenge"
+)
+
+// Event is one record of the audit log, it is never changed after it is written
+type Event struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	Time      time.Time `json:"time" bson:"time"`
+	Type      string    `json:"type" bson:"type"`
+	Outcome   string    `json:"outcome" bson:"outcome"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	UserID    string    `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty" bson:"username,omitempty"`
+	IP        string    `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	// TokenID is the jti of the access token or the id of the api key the request is made with
+	TokenID  string `json:"token_id,omitempty" bson:"token_id,omitempty"`
+	APIKeyID string `json:"api_key_id,omitempty" bson:"api_key_id,omitempty"`
+	// TargetID is the user an admin action is made on
+	TargetID string `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	// Details are facts of the action like the new role
+	Details string `json:"details,omitempty" bson:"details,omitempty"`
+}
+
+// Filter selects events with From <= time < To, zero fields are not used
+type Filter struct {
+	From    time.Time
+	To      time.Time
+	Type    string
+	UserID  string
+	Outcome string
+	Skip    int64
+	Limit   int64
+}
@@ -0,0 +1,113 @@
+package auditdb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/pkg/logging"
+)
+
+// AuditDB only appends and reads events, there is no way to change or delete them from the app
+type AuditDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *AuditDB {
+	return &AuditDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes is for the time range queries of admins
+func (a *AuditDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "time", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "time", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "time", Value: -1}},
+		},
+	}
+
+	_, err := a.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create audit indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (a *AuditDB) Create(ctx context.Context, event auditmodel.Event) (string, error) {
+	result, err := a.collection.InsertOne(ctx, event)
+	if err != nil {
+		return "", fmt.Errorf("failed to create audit event: %v", err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if ok {
+		return objID.Hex(), nil
+	}
+
+	return "", fmt.Errorf("failed to convert objectID to Hex[%v]", result.InsertedID)
+}
+
+// List returns the newest events first and the number of all events matching the filter
+func (a *AuditDB) List(ctx context.Context, auditFilter auditmodel.Filter) ([]auditmodel.Event, int64, error) {
+	filter := bson.M{}
+
+	timeRange := bson.M{}
+	if !auditFilter.From.IsZero() {
+		timeRange["$gte"] = auditFilter.From
+	}
+	if !auditFilter.To.IsZero() {
+		timeRange["$lt"] = auditFilter.To
+	}
+	if len(timeRange) != 0 {
+		filter["time"] = timeRange
+	}
+
+	if auditFilter.Type != "" {
+		filter["type"] = auditFilter.Type
+	}
+
+	if auditFilter.UserID != "" {
+		filter["user_id"] = auditFilter.UserID
+	}
+
+	if auditFilter.Outcome != "" {
+		filter["outcome"] = auditFilter.Outcome
+	}
+
+	total, err := a.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(auditFilter.Skip).
+		SetLimit(auditFilter.Limit)
+
+	cursor, err := a.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find audit events: %v", err)
+	}
+
+	events := []auditmodel.Event{}
+
+	err = cursor.All(ctx, &events)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode audit events: %v", err)
+	}
+
+	return events, total, nil
+}
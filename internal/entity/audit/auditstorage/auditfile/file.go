@@ -0,0 +1,70 @@
+package auditfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"nprn/internal/entity/audit/auditmodel"
+	"os"
+	"sync"
+)
+
+type storage interface {
+	Create(ctx context.Context, event auditmodel.Event) (string, error)
+	List(ctx context.Context, filter auditmodel.Filter) ([]auditmodel.Event, int64, error)
+}
+
+// AuditFile writes every event as a JSON line to the file before passing it to the storage,
+// the file is for log shippers and survives the loss of the database. Events are read from the storage.
+type AuditFile struct {
+	mu      sync.Mutex
+	file    *os.File
+	storage storage
+}
+
+func NewAuditFile(path string, storage storage) (*AuditFile, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file %s: %v", path, err)
+	}
+
+	return &AuditFile{file: file, storage: storage}, nil
+}
+
+// Create writes the event to the storage even if the file fails, the first error is returned
+func (a *AuditFile) Create(ctx context.Context, event auditmodel.Event) (string, error) {
+	fileErr := a.write(event)
+
+	id, err := a.storage.Create(ctx, event)
+	if err != nil {
+		return "", err
+	}
+
+	return id, fileErr
+}
+
+func (a *AuditFile) List(ctx context.Context, filter auditmodel.Filter) ([]auditmodel.Event, int64, error) {
+	return a.storage.List(ctx, filter)
+}
+
+func (a *AuditFile) Close() error {
+	return a.file.Close()
+}
+
+func (a *AuditFile) write(event auditmodel.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// one write call per line, so lines of concurrent events are not mixed
+	_, err = a.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write audit file: %v", err)
+	}
+
+	return nil
+}
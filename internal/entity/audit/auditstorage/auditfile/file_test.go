@@ -0,0 +1,65 @@
+package auditfile
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nprn/internal/entity/audit/auditmodel"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeStorage struct {
+	events []auditmodel.Event
+	err    error
+}
+
+func (f *fakeStorage) Create(_ context.Context, event auditmodel.Event) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	f.events = append(f.events, event)
+	return "1", nil
+}
+
+func (f *fakeStorage) List(context.Context, auditmodel.Filter) ([]auditmodel.Event, int64, error) {
+	return f.events, int64(len(f.events)), nil
+}
+
+func TestAuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	storage := &fakeStorage{}
+
+	auditFile, err := NewAuditFile(path, storage)
+	require.NoError(t, err)
+
+	_, err = auditFile.Create(context.Background(), auditmodel.Event{Type: auditmodel.TypeSignIn, UserID: "1"})
+	require.NoError(t, err)
+
+	// the file keeps the event even if the database fails
+	storage.err = errors.New("no connection")
+	_, err = auditFile.Create(context.Background(), auditmodel.Event{Type: auditmodel.TypeLogout, UserID: "2"})
+	assert.Error(t, err)
+
+	require.NoError(t, auditFile.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var types []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event auditmodel.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		types = append(types, event.Type)
+	}
+
+	assert.Equal(t, []string{auditmodel.TypeSignIn, auditmodel.TypeLogout}, types)
+	assert.Len(t, storage.events, 1)
+}
@@ -0,0 +1,50 @@
+package revisionmodel
+
+import (
+	"nprn/internal/entity/sale/salemodel"
+	"strconv"
+	"time"
+)
+
+// fields are compared in the order of the API, the id, the version and the storage times are not
+var fields = []struct {
+	name  string
+	value func(sale salemodel.Sale) string
+}{
+	{"article", func(sale salemodel.Sale) string { return sale.Article }},
+	{"price_for_one", func(sale salemodel.Sale) string { return sale.PriceForOne.String() }},
+	{"number_of_units", func(sale salemodel.Sale) string { return strconv.Itoa(sale.NumberOfUnits) }},
+	{"amount", func(sale salemodel.Sale) string { return sale.Amount.String() }},
+	{"currency", func(sale salemodel.Sale) string { return sale.Currency }},
+	{"date", func(sale salemodel.Sale) string { return formatTime(sale.Date) }},
+	{"seller_id", func(sale salemodel.Sale) string { return sale.SellerID }},
+	{"deleted_at", func(sale salemodel.Sale) string {
+		if sale.DeletedAt == nil {
+			return ""
+		}
+		return formatTime(*sale.DeletedAt)
+	}},
+	{"deleted_by", func(sale salemodel.Sale) string { return sale.DeletedBy }},
+}
+
+// Diff returns the fields which differ, a new sale is compared with the zero sale
+func Diff(before salemodel.Sale, after salemodel.Sale) []Change {
+	changes := []Change{}
+
+	for _, field := range fields {
+		from, to := field.value(before), field.value(after)
+		if from != to {
+			changes = append(changes, Change{Field: field.name, From: from, To: to})
+		}
+	}
+
+	return changes
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
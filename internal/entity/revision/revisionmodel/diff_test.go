@@ -0,0 +1,32 @@
+package revisionmodel
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nprn/internal/entity/sale/salemodel"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	date := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	before := salemodel.Sale{ID: "1", Article: "12-223-41-33", PriceForOne: 2408000, NumberOfUnits: 1, Amount: 2408000,
+		Currency: "USD", Date: date, SellerID: "1", Version: 1}
+
+	after := before
+	after.NumberOfUnits = 2
+	after.Amount = 4816000
+	after.Version = 2
+	after.UpdatedAt = date
+
+	assert.Equal(t, []Change{
+		{Field: "number_of_units", From: "1", To: "2"},
+		{Field: "amount", From: "240.8", To: "481.6"},
+	}, Diff(before, after))
+
+	assert.Equal(t, []Change{}, Diff(before, before))
+
+	created := Diff(salemodel.Sale{}, before)
+	assert.Len(t, created, 7)
+	assert.Equal(t, Change{Field: "price_for_one", From: "0", To: "240.8"}, created[1])
+	assert.Equal(t, Change{Field: "date", From: "", To: "2022-02-01T10:00:00Z"}, created[5])
+}
@@ -0,0 +1,41 @@
+package revisionmodel
+
+import (
+	"errors"
+	"nprn/internal/entity/sale/salemodel"
+	"time"
+)
+
+// ErrNotFound is returned by the storage when the sale has no revision with the version
+var ErrNotFound = errors.New("revision is not found")
+
+// Actions
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+	ActionReverted = "reverted"
+)
+
+// Revision is the state of the sale after one change, it is never changed after it is written
+type Revision struct {
+	ID     string `json:"id" bson:"_id,omitempty"`
+	SaleID string `json:"sale_id" bson:"sale_id"`
+	// Version is the version of the sale after the change
+	Version int64     `json:"version" bson:"version"`
+	Action  string    `json:"action" bson:"action"`
+	UserID  string    `json:"user_id" bson:"user_id"`
+	Time    time.Time `json:"time" bson:"time"`
+	// RevertedFrom is the version the sale is reverted to
+	RevertedFrom int64          `json:"reverted_from,omitempty" bson:"reverted_from,omitempty"`
+	Sale         salemodel.Sale `json:"sale" bson:"sale"`
+	Changes      []Change       `json:"changes" bson:"changes"`
+}
+
+// Change is one field of the sale, the values are in the form the API shows them
+type Change struct {
+	Field string `json:"field" bson:"field"`
+	From  string `json:"from" bson:"from"`
+	To    string `json:"to" bson:"to"`
+}
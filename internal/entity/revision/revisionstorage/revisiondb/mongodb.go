@@ -0,0 +1,117 @@
+package revisiondb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/revision/revisionmodel"
+	"nprn/pkg/logging"
+)
+
+// RevisionDB only appends and reads revisions, they are not changed or deleted from the app
+type RevisionDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *RevisionDB {
+	return &RevisionDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes makes the version unique for the sale, so a revision can't be written twice
+func (r *RevisionDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "sale_id", Value: 1}, {Key: "version", Value: -1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create revision indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (r *RevisionDB) Create(ctx context.Context, revision revisionmodel.Revision) (string, error) {
+	result, err := r.collection.InsertOne(ctx, revision)
+	if err != nil {
+		return "", fmt.Errorf("failed to create revision of sale id=%s: %v", revision.SaleID, err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if ok {
+		return objID.Hex(), nil
+	}
+
+	return "", fmt.Errorf("failed to convert objectID to Hex[%v]", result.InsertedID)
+}
+
+// CreateMany inserts the revisions of sales created together, like the import
+func (r *RevisionDB) CreateMany(ctx context.Context, revisions []revisionmodel.Revision) error {
+	documents := make([]interface{}, 0, len(revisions))
+	for _, revision := range revisions {
+		documents = append(documents, revision)
+	}
+
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("failed to create %d revisions: %v", len(revisions), err)
+	}
+
+	return nil
+}
+
+// List returns the newest revisions of the sale first and the number of all its revisions
+func (r *RevisionDB) List(ctx context.Context, saleID string, skip int64, limit int64) ([]revisionmodel.Revision, int64, error) {
+	filter := bson.M{"sale_id": saleID}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count revisions: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find revisions: %v", err)
+	}
+
+	revisions := []revisionmodel.Revision{}
+
+	err = cursor.All(ctx, &revisions)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode revisions: %v", err)
+	}
+
+	return revisions, total, nil
+}
+
+// GetByVersion returns revisionmodel.ErrNotFound if the sale has no such version
+func (r *RevisionDB) GetByVersion(ctx context.Context, saleID string, version int64) (revisionmodel.Revision, error) {
+	var revision revisionmodel.Revision
+
+	err := r.collection.FindOne(ctx, bson.M{"sale_id": saleID, "version": version}).Decode(&revision)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return revisionmodel.Revision{}, revisionmodel.ErrNotFound
+	}
+
+	if err != nil {
+		return revisionmodel.Revision{}, fmt.Errorf("failed to find revision: %v", err)
+	}
+
+	return revision, nil
+}
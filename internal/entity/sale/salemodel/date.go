@@ -0,0 +1,26 @@
+package salemodel
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateLayout is the date without time, it is the start of the day in the time zone of the user
+const DateLayout = "2006-01-02"
+
+// ParseDate accepts RFC 3339 time, or DateLayout and legacy layouts which are read in the location
+func ParseDate(value string, layouts []string, location *time.Location) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date.UTC(), nil
+	}
+
+	for _, layout := range append([]string{DateLayout}, layouts...) {
+		date, err = time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return date.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("date %q is not RFC 3339 or YYYY-MM-DD", value)
+}
@@ -0,0 +1,50 @@
+package salemodel
+
+import (
+	"errors"
+	"nprn/pkg/money"
+	"time"
+)
+
+// ErrInvalidCursor is returned by the storage for a cursor it didn't make or made for another sort
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// SortFields are the fields sales can be sorted by, the id breaks ties
+var SortFields = map[string]string{
+	"id":              "_id",
+	"date":            "date",
+	"article":         "article",
+	"amount":          "amount",
+	"price_for_one":   "price_for_one",
+	"number_of_units": "number_of_units",
+}
+
+// ListFilter selects a page of sales, zero fields are not used
+type ListFilter struct {
+	SellerID string
+	// DateFrom is included, DateTo is not
+	DateFrom      time.Time
+	DateTo        time.Time
+	ArticlePrefix string
+	Currency      string
+	MinAmount     *money.Decimal
+	MaxAmount     *money.Decimal
+
+	// Deleted lists the trash instead of the sales
+	Deleted bool
+
+	// Sort is a key of SortFields
+	Sort       string
+	Descending bool
+	Limit      int64
+	// Cursor is NextCursor of the previous page
+	Cursor string
+}
+
+// Page is one page of sales, NextCursor is empty on the last page.
+// Total is the number of all sales matching the filter.
+type Page struct {
+	Sales      []Sale
+	NextCursor string
+	Total      int64
+}
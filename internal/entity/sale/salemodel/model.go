@@ -1,11 +1,32 @@
 package salemodel
 
+import (
+	"errors"
+	"nprn/pkg/money"
+	"time"
+)
+
+// ErrVersionConflict is returned by the storage when the sale was changed after it was read
+var ErrVersionConflict = errors.New("sale version doesn't match")
+
 type Sale struct {
-	ID            string  `json:"id" bson:"_id,omitempty"`
-	Article       string  `json:"article" bson:"article"`
-	PriceForOne   float64 `json:"price_for_one" bson:"price_for_one"`
-	NumberOfUnits int     `json:"number_of_units" bson:"number_of_units"`
-	Amount        float64 `json:"amount" bson:"amount"`
-	Date          string  `json:"date" bson:"date"`
-	SellerID      string  `json:"seller_id" bson:"seller_id"`
+	ID            string        `json:"id" bson:"_id,omitempty"`
+	Article       string        `json:"article" bson:"article"`
+	PriceForOne   money.Decimal `json:"price_for_one" bson:"price_for_one"`
+	NumberOfUnits int           `json:"number_of_units" bson:"number_of_units"`
+	Amount        money.Decimal `json:"amount" bson:"amount"`
+	// Currency is ISO 4217 code of PriceForOne and Amount
+	Currency string    `json:"currency" bson:"currency"`
+	Date     time.Time `json:"date" bson:"date"`
+	SellerID string    `json:"seller_id" bson:"seller_id"`
+
+	// Version starts with 1 and is incremented by the storage on every update, it is the ETag of the sale
+	Version int64 `json:"version" bson:"version"`
+	// CreatedAt and UpdatedAt are set by the storage
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+
+	// DeletedAt and DeletedBy (the user id) are set for the sale in the trash, it is purged after the retention period
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
 }
@@ -0,0 +1,130 @@
+package saledb
+
+import (
+	"encoding/base64"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"nprn/internal/entity/sale/salemodel"
+	"regexp"
+)
+
+// listCursor is the position after the last sale of a page, it is sent to the client as base64 of BSON,
+// so the value keeps its BSON type
+type listCursor struct {
+	Field      string             `bson:"f"`
+	Descending bool               `bson:"d"`
+	Value      bson.RawValue      `bson:"v"`
+	ID         primitive.ObjectID `bson:"i"`
+}
+
+// cursorValueTypes are the types of the sort fields, other values of a cursor are not accepted
+var cursorValueTypes = map[bsontype.Type]bool{
+	bsontype.Null:       true,
+	bsontype.String:     true,
+	bsontype.DateTime:   true,
+	bsontype.Decimal128: true,
+	bsontype.Double:     true,
+	bsontype.Int32:      true,
+	bsontype.Int64:      true,
+}
+
+func listQuery(filter salemodel.ListFilter) bson.M {
+	// null matches the missing field too and, unlike $exists, is served by an index
+	query := bson.M{"deleted_at": nil}
+	if filter.Deleted {
+		query["deleted_at"] = bson.M{"$ne": nil}
+	}
+
+	if filter.SellerID != "" {
+		query["seller_id"] = filter.SellerID
+	}
+
+	if filter.Currency != "" {
+		query["currency"] = filter.Currency
+	}
+
+	if filter.ArticlePrefix != "" {
+		// the anchored regex is served by the article index
+		query["article"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.ArticlePrefix)}
+	}
+
+	amount := bson.M{}
+	if filter.MinAmount != nil {
+		amount["$gte"] = *filter.MinAmount
+	}
+	if filter.MaxAmount != nil {
+		amount["$lte"] = *filter.MaxAmount
+	}
+	if len(amount) > 0 {
+		query["amount"] = amount
+	}
+
+	date := bson.M{}
+	if !filter.DateFrom.IsZero() {
+		date["$gte"] = filter.DateFrom
+	}
+	if !filter.DateTo.IsZero() {
+		date["$lt"] = filter.DateTo
+	}
+	if len(date) > 0 {
+		query["date"] = date
+	}
+
+	return query
+}
+
+// makeCursor remembers the sort value and the id of the document
+func makeCursor(document bson.Raw, field string, descending bool) (string, error) {
+	id, ok := document.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", salemodel.ErrInvalidCursor
+	}
+
+	cursor := listCursor{Field: field, Descending: descending, ID: id, Value: bson.RawValue{Type: bsontype.Null}}
+
+	if value, err := document.LookupErr(field); err == nil && field != "_id" {
+		cursor.Value = value
+	}
+
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// afterCursor selects sales after the cursor in the same order, the cursor is valid only for the sort it was made for
+func afterCursor(value string, field string, descending bool) (bson.M, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, salemodel.ErrInvalidCursor
+	}
+
+	var cursor listCursor
+
+	err = bson.Unmarshal(data, &cursor)
+	if err != nil || cursor.Field != field || cursor.Descending != descending || cursor.ID.IsZero() {
+		return nil, salemodel.ErrInvalidCursor
+	}
+
+	// the cursor comes from the client, a document like {"$ne": null} or a regex would change the query
+	if !cursorValueTypes[cursor.Value.Type] {
+		return nil, salemodel.ErrInvalidCursor
+	}
+
+	operator := "$gt"
+	if descending {
+		operator = "$lt"
+	}
+
+	if field == "_id" {
+		return bson.M{"_id": bson.M{operator: cursor.ID}}, nil
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{operator: cursor.Value}},
+		bson.D{{Key: field, Value: cursor.Value}, {Key: "_id", Value: bson.M{operator: cursor.ID}}},
+	}}, nil
+}
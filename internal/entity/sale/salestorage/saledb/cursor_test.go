@@ -0,0 +1,86 @@
+package saledb
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"nprn/internal/entity/sale/salemodel"
+	"nprn/pkg/money"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	document, err := bson.Marshal(bson.M{"_id": id, "amount": 222.5, "article": "12-223-41-33"})
+	require.NoError(t, err)
+
+	cursor, err := makeCursor(document, "amount", true)
+	require.NoError(t, err)
+
+	after, err := afterCursor(cursor, "amount", true)
+	require.NoError(t, err)
+
+	query, err := bson.Marshal(after)
+	require.NoError(t, err)
+
+	excepted, err := bson.Marshal(bson.M{"$or": bson.A{
+		bson.M{"amount": bson.M{"$lt": 222.5}},
+		bson.D{{Key: "amount", Value: 222.5}, {Key: "_id", Value: bson.M{"$lt": id}}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, bson.Raw(excepted).String(), bson.Raw(query).String())
+
+	_, err = afterCursor(cursor, "amount", false)
+	assert.ErrorIs(t, err, salemodel.ErrInvalidCursor)
+
+	_, err = afterCursor(cursor, "article", true)
+	assert.ErrorIs(t, err, salemodel.ErrInvalidCursor)
+
+	_, err = afterCursor("not a cursor", "amount", true)
+	assert.ErrorIs(t, err, salemodel.ErrInvalidCursor)
+}
+
+func TestCursor_Tampered(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	operator, err := bson.Marshal(bson.M{"$ne": nil})
+	require.NoError(t, err)
+
+	regex, err := bson.Marshal(bson.M{"v": primitive.Regex{Pattern: ".*"}})
+	require.NoError(t, err)
+
+	values := []bson.RawValue{
+		{Type: bsontype.EmbeddedDocument, Value: operator},
+		{Type: bsontype.Array, Value: operator},
+		bson.Raw(regex).Lookup("v"),
+	}
+
+	for _, value := range values {
+		data, err := bson.Marshal(listCursor{Field: "amount", Value: value, ID: id})
+		require.NoError(t, err)
+
+		_, err = afterCursor(base64.RawURLEncoding.EncodeToString(data), "amount", false)
+		assert.ErrorIs(t, err, salemodel.ErrInvalidCursor, value.Type.String())
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	minAmount := money.Decimal(1000000)
+
+	query := listQuery(salemodel.ListFilter{SellerID: "1", ArticlePrefix: "12.", MinAmount: &minAmount})
+
+	assert.Equal(t, bson.M{
+		"deleted_at": nil,
+		"seller_id":  "1",
+		"article":    bson.M{"$regex": `^12\.`},
+		"amount":     bson.M{"$gte": minAmount},
+	}, query)
+
+	query = listQuery(salemodel.ListFilter{Deleted: true})
+
+	assert.Equal(t, bson.M{"deleted_at": bson.M{"$ne": nil}}, query)
+}
@@ -2,14 +2,21 @@ package saledb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"nprn/internal/entity/sale/salemodel"
 	"nprn/pkg/logging"
+	"nprn/pkg/money"
+	"time"
 )
 
+// exportBatchSize is the number of sales the cursor of Export gets from the server at once
+const exportBatchSize = 500
+
 type SaleDB struct {
 	collection *mongo.Collection
 	logger     *logging.Logger
@@ -22,7 +29,187 @@ func NewCollection(database *mongo.Database, collection string, logger *logging.
 	}
 }
 
+// MigrateMoney converts prices and amounts stored as numbers to Decimal128, amounts are rounded to the minor unit.
+// Sales without a currency get the given one.
+func (s *SaleDB) MigrateMoney(ctx context.Context, currency string) error {
+	numbers := bson.M{"$type": bson.A{"double", "int", "long"}}
+
+	cursor, err := s.collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"price_for_one": numbers},
+		bson.M{"amount": numbers},
+		bson.M{"currency": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to find sales to migrate: %v", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	count := 0
+
+	for cursor.Next(ctx) {
+		// only the money, the date can be still text
+		var sale struct {
+			ID          primitive.ObjectID `bson:"_id"`
+			PriceForOne money.Decimal      `bson:"price_for_one"`
+			Amount      money.Decimal      `bson:"amount"`
+			Currency    string             `bson:"currency"`
+		}
+
+		err = cursor.Decode(&sale)
+		if err != nil {
+			return fmt.Errorf("failed to decode sale: %v", err)
+		}
+
+		if sale.Currency == "" {
+			sale.Currency = currency
+		}
+
+		if digits, ok := money.MinorDigits(sale.Currency); ok {
+			sale.Amount = sale.Amount.Round(digits)
+		}
+
+		_, err = s.collection.UpdateOne(ctx, bson.M{"_id": sale.ID}, bson.M{"$set": bson.M{
+			"price_for_one": sale.PriceForOne,
+			"amount":        sale.Amount,
+			"currency":      sale.Currency,
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to migrate sale id=%s: %v", sale.ID.Hex(), err)
+		}
+
+		count++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read sales to migrate: %v", err)
+	}
+
+	if count != 0 {
+		s.logger.Infof("money of %d sales is migrated to decimal", count)
+	}
+
+	return nil
+}
+
+// MigrateVersions gives version 1 to sales created before the versions
+func (s *SaleDB) MigrateVersions(ctx context.Context) error {
+	result, err := s.collection.UpdateMany(ctx, bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"version": int64(1)}})
+	if err != nil {
+		return fmt.Errorf("failed to migrate sale versions: %v", err)
+	}
+
+	if result.ModifiedCount != 0 {
+		s.logger.Infof("%d sales got version 1", result.ModifiedCount)
+	}
+
+	return nil
+}
+
+// CountNotMigrated counts sales stored by older versions: with money as numbers, without a currency or a version
+// and with dates stored as text before they became datetimes
+func (s *SaleDB) CountNotMigrated(ctx context.Context) (int64, error) {
+	numbers := bson.M{"$type": bson.A{"double", "int", "long"}}
+
+	count, err := s.collection.CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"price_for_one": numbers},
+		bson.M{"amount": numbers},
+		bson.M{"currency": bson.M{"$exists": false}},
+		bson.M{"version": bson.M{"$exists": false}},
+		bson.M{"date": bson.M{"$type": "string"}},
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sales to migrate: %v", err)
+	}
+
+	return count, nil
+}
+
+// MigrateDates converts text dates to datetimes by the parse function which gets the date and the seller,
+// sales with dates it can't parse are left as they are and counted as failed.
+// created_at and updated_at of old sales are taken from their ids.
+func (s *SaleDB) MigrateDates(ctx context.Context, parse func(date string, sellerID string) (time.Time, error)) (int, int, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"date": bson.M{"$type": "string"}})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find sales to migrate: %v", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	migrated, failed := 0, 0
+
+	for cursor.Next(ctx) {
+		var sale struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			Date      string             `bson:"date"`
+			SellerID  string             `bson:"seller_id"`
+			CreatedAt *time.Time         `bson:"created_at"`
+		}
+
+		err = cursor.Decode(&sale)
+		if err != nil {
+			return migrated, failed, fmt.Errorf("failed to decode sale: %v", err)
+		}
+
+		date, err := parse(sale.Date, sale.SellerID)
+		if err != nil {
+			s.logger.Warnf("sale id=%s is not migrated: %v", sale.ID.Hex(), err)
+			failed++
+			continue
+		}
+
+		update := bson.M{"date": date}
+		if sale.CreatedAt == nil {
+			update["created_at"] = sale.ID.Timestamp().UTC()
+			update["updated_at"] = sale.ID.Timestamp().UTC()
+		}
+
+		_, err = s.collection.UpdateOne(ctx, bson.M{"_id": sale.ID}, bson.M{"$set": update})
+		if err != nil {
+			return migrated, failed, fmt.Errorf("failed to migrate sale id=%s: %v", sale.ID.Hex(), err)
+		}
+
+		migrated++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return migrated, failed, fmt.Errorf("failed to read sales to migrate: %v", err)
+	}
+
+	return migrated, failed, nil
+}
+
+// CreateIndexes covers the filters and the sorts of GetAll, a seller lists only own sales
+// so every index is also prefixed by seller_id. The trash is purged by deleted_at.
+func (s *SaleDB) CreateIndexes(ctx context.Context) error {
+	var models []mongo.IndexModel
+
+	for _, field := range []string{"date", "amount", "article"} {
+		models = append(models,
+			mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: field, Value: 1}, {Key: "_id", Value: 1}}},
+		)
+	}
+
+	models = append(models,
+		mongo.IndexModel{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: "_id", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+	)
+
+	_, err := s.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create sale indexes: %v", err)
+	}
+
+	return nil
+}
+
 func (s *SaleDB) Create(ctx context.Context, sale salemodel.Sale) (string, error) {
+	sale.CreatedAt = time.Now().UTC()
+	sale.UpdatedAt = sale.CreatedAt
+	sale.Version = 1
+
 	result, err := s.collection.InsertOne(ctx, sale)
 	if err != nil {
 		return "", fmt.Errorf("failed to create new sale: %v", err)
@@ -37,14 +224,74 @@ func (s *SaleDB) Create(ctx context.Context, sale salemodel.Sale) (string, error
 	return objID.Hex(), nil
 }
 
+// CreateMany inserts the sales in order and returns the ids of the inserted ones. The insert stops at the first
+// failed sale, so with an error the ids are of the sales before it.
+func (s *SaleDB) CreateMany(ctx context.Context, sales []salemodel.Sale) ([]string, error) {
+	now := time.Now().UTC()
+
+	documents := make([]interface{}, 0, len(sales))
+	for _, sale := range sales {
+		sale.CreatedAt = now
+		sale.UpdatedAt = now
+		sale.Version = 1
+
+		documents = append(documents, sale)
+	}
+
+	result, err := s.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(true))
+
+	inserted := 0
+	if err == nil {
+		inserted = len(sales)
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		inserted = bulkErr.WriteErrors[0].Index
+	}
+
+	ids := make([]string, 0, inserted)
+	if result != nil {
+		for _, insertedID := range result.InsertedIDs[:inserted] {
+			objID, ok := insertedID.(primitive.ObjectID)
+			if !ok {
+				return ids, fmt.Errorf("failed to convert objectID to Hex[%v]", insertedID)
+			}
+
+			ids = append(ids, objID.Hex())
+		}
+	}
+
+	if err != nil {
+		return ids, fmt.Errorf("failed to create sales: %v", err)
+	}
+
+	s.logger.Tracef("%d sales are created", len(ids))
+
+	return ids, nil
+}
+
+// GetOne doesn't find the sale in the trash
 func (s *SaleDB) GetOne(ctx context.Context, id string) (salemodel.Sale, error) {
+	return s.findOne(ctx, id, false)
+}
+
+// GetDeleted finds only the sale in the trash
+func (s *SaleDB) GetDeleted(ctx context.Context, id string) (salemodel.Sale, error) {
+	return s.findOne(ctx, id, true)
+}
+
+func (s *SaleDB) findOne(ctx context.Context, id string, deleted bool) (salemodel.Sale, error) {
 
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return salemodel.Sale{}, fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
 	}
 
-	filter := bson.M{"_id": objID}
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	if deleted {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	}
 
 	result := s.collection.FindOne(ctx, filter)
 	if result.Err() != nil {
@@ -61,30 +308,169 @@ func (s *SaleDB) GetOne(ctx context.Context, id string) (salemodel.Sale, error)
 	return sale, nil
 }
 
-func (s *SaleDB) GetAll(ctx context.Context) ([]salemodel.Sale, error) {
+// GetAll returns a page of sales sorted by the filter.Sort field, sales with the same value are sorted by id.
+// The next page starts after the last sale of this one (keyset pagination), so it isn't slowed down by skip
+// and isn't shifted by sales created in between.
+func (s *SaleDB) GetAll(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error) {
+	field, ok := salemodel.SortFields[filter.Sort]
+	if !ok {
+		field = "_id"
+	}
 
-	cursor, err := s.collection.Find(ctx, bson.M{})
+	direction := 1
+	if filter.Descending {
+		direction = -1
+	}
+
+	query := listQuery(filter)
+
+	total, err := s.collection.CountDocuments(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all sales: %v", err)
+		return salemodel.Page{}, fmt.Errorf("failed to count sales: %v", err)
 	}
 
-	var sales []salemodel.Sale
+	if filter.Cursor != "" {
+		after, err := afterCursor(filter.Cursor, field, filter.Descending)
+		if err != nil {
+			return salemodel.Page{}, err
+		}
+
+		query = bson.M{"$and": bson.A{query, after}}
+	}
 
-	err = cursor.All(ctx, &sales)
+	sort := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+
+	// one more sale tells if there is the next page
+	opts := options.Find().SetSort(sort).SetLimit(filter.Limit + 1)
+
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return salemodel.Page{}, fmt.Errorf("failed to get sales: %v", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	page := salemodel.Page{Sales: make([]salemodel.Sale, 0, filter.Limit), Total: total}
+
+	var next string
+
+	for int64(len(page.Sales)) < filter.Limit && cursor.Next(ctx) {
+		var sale salemodel.Sale
+
+		err = cursor.Decode(&sale)
+		if err != nil {
+			return salemodel.Page{}, fmt.Errorf("failed to decode sale: %v", err)
+		}
+
+		page.Sales = append(page.Sales, sale)
+
+		if int64(len(page.Sales)) == filter.Limit {
+			next, err = makeCursor(cursor.Current, field, filter.Descending)
+			if err != nil {
+				return salemodel.Page{}, err
+			}
+		}
+	}
+
+	if next != "" && cursor.Next(ctx) {
+		page.NextCursor = next
+	}
+
+	if err = cursor.Err(); err != nil {
+		return salemodel.Page{}, fmt.Errorf("failed to get sales: %v", err)
+	}
+
+	return page, nil
+}
+
+// Export calls the function for every sale matching the filter in the order of the filter, the sales are read
+// from the cursor one by one. The limit and the cursor of the filter are not used.
+func (s *SaleDB) Export(ctx context.Context, filter salemodel.ListFilter, each func(sale salemodel.Sale) error) error {
+	field, ok := salemodel.SortFields[filter.Sort]
+	if !ok {
+		field = "_id"
+	}
+
+	direction := 1
+	if filter.Descending {
+		direction = -1
+	}
+
+	sort := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+
+	cursor, err := s.collection.Find(ctx, listQuery(filter), options.Find().SetSort(sort).SetBatchSize(exportBatchSize))
+	if err != nil {
+		return fmt.Errorf("failed to export sales: %v", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var sale salemodel.Sale
+
+		err = cursor.Decode(&sale)
+		if err != nil {
+			return fmt.Errorf("failed to decode sale: %v", err)
+		}
+
+		err = each(sale)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("failed to export sales: %v", err)
+	}
+
+	return nil
+}
+
+// CountBySeller returns the number of sales of every seller from the list who has sales, the trash is not counted
+func (s *SaleDB) CountBySeller(ctx context.Context, sellerIDs []string) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"seller_id": bson.M{"$in": sellerIDs}, "deleted_at": nil}}},
+		{{Key: "$group", Value: bson.M{"_id": "$seller_id", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sales by seller: %v", err)
+	}
+
+	var rows []struct {
+		SellerID string `bson:"_id"`
+		Count    int64  `bson:"count"`
+	}
+
+	err = cursor.All(ctx, &rows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode all sales: %v", err)
+		return nil, fmt.Errorf("failed to decode sale counts: %v", err)
 	}
 
-	return sales, nil
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SellerID] = row.Count
+	}
+
+	return counts, nil
 }
 
+// Update replaces the sale only if it has the version it was read with and increments the version
 func (s *SaleDB) Update(ctx context.Context, sale salemodel.Sale) error {
 	objID, err := primitive.ObjectIDFromHex(sale.ID)
 	if err != nil {
 		return fmt.Errorf("failed to convert sale id=%v to objectID: %v", sale.ID, err)
 	}
 
-	filter := bson.M{"_id": objID}
+	// the version of the sale is the one it was read with, the sale in the trash is not changed
+	filter := bson.M{"_id": objID, "version": sale.Version, "deleted_at": nil}
 
 	saleBytes, err := bson.Marshal(sale)
 	if err != nil {
@@ -99,8 +485,14 @@ func (s *SaleDB) Update(ctx context.Context, sale salemodel.Sale) error {
 	}
 
 	delete(updateSaleObj, "_id") // for not to overwrite id
+	delete(updateSaleObj, "created_at")
+	delete(updateSaleObj, "version")
+	// the trash is changed only by Delete and Restore
+	delete(updateSaleObj, "deleted_at")
+	delete(updateSaleObj, "deleted_by")
+	updateSaleObj["updated_at"] = time.Now().UTC()
 
-	update := bson.M{"$set": updateSaleObj}
+	update := bson.M{"$set": updateSaleObj, "$inc": bson.M{"version": 1}}
 
 	result, err := s.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -108,7 +500,7 @@ func (s *SaleDB) Update(ctx context.Context, sale salemodel.Sale) error {
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("sale is not found: %v", err)
+		return salemodel.ErrVersionConflict
 	}
 
 	s.logger.Tracef("matched %d documents and modified %d documents", result.MatchedCount, result.ModifiedCount)
@@ -116,24 +508,69 @@ func (s *SaleDB) Update(ctx context.Context, sale salemodel.Sale) error {
 	return nil
 }
 
-func (s *SaleDB) Delete(ctx context.Context, id string) error {
+// Delete moves the sale to the trash if it has the version it was read with, the version is incremented
+func (s *SaleDB) Delete(ctx context.Context, id string, version int64, deletedBy string) error {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
 	}
 
-	filter := bson.M{"_id": objID}
+	now := time.Now().UTC()
+
+	filter := bson.M{"_id": objID, "version": version, "deleted_at": nil}
+	update := bson.M{
+		"$set": bson.M{"deleted_at": now, "deleted_by": deletedBy, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
 
-	result, err := s.collection.DeleteOne(ctx, filter)
+	result, err := s.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return fmt.Errorf("failed to execute delete sale: %v", err)
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("sale is not found")
+	if result.MatchedCount == 0 {
+		return salemodel.ErrVersionConflict
+	}
+
+	s.logger.Tracef("sale id=%s is moved to the trash by user id=%s", id, deletedBy)
+
+	return nil
+}
+
+// Restore takes the sale out of the trash if it has the version it was read with, the version is incremented
+func (s *SaleDB) Restore(ctx context.Context, id string, version int64) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
+	}
+
+	filter := bson.M{"_id": objID, "version": version, "deleted_at": bson.M{"$ne": nil}}
+	update := bson.M{
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$set":   bson.M{"updated_at": time.Now().UTC()},
+		"$inc":   bson.M{"version": 1},
 	}
 
-	s.logger.Tracef("deleted %d documents", result.DeletedCount)
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute restore sale: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return salemodel.ErrVersionConflict
+	}
+
+	s.logger.Tracef("sale id=%s is restored", id)
 
 	return nil
 }
+
+// Purge removes sales which are in the trash since before the time, it returns the number of removed sales
+func (s *SaleDB) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := s.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sales: %v", err)
+	}
+
+	return result.DeletedCount, nil
+}
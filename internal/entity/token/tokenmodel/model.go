@@ -0,0 +1,48 @@
+package tokenmodel
+
+import "time"
+
+// RefreshToken is stored without the opaque token itself, only with its hash
+type RefreshToken struct {
+	ID        string     `bson:"_id,omitempty"`
+	Hash      string     `bson:"hash"`
+	UserID    string     `bson:"user_id"`
+	FamilyID  string     `bson:"family_id"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	RotatedAt *time.Time `bson:"rotated_at,omitempty"`
+	Revoked   bool       `bson:"revoked"`
+	// MFA is true if the family was started by a sign-in with the second factor
+	MFA bool `bson:"mfa,omitempty"`
+}
+
+// Revocation rejects one access token by TokenID or every access token of the user issued before IssuedBefore
+type Revocation struct {
+	ID           string    `bson:"_id,omitempty"`
+	TokenID      string    `bson:"token_id,omitempty"`
+	UserID       string    `bson:"user_id"`
+	IssuedBefore time.Time `bson:"issued_before,omitempty"`
+	// IssuedBeforeNano is IssuedBefore in nanoseconds, mongo keeps time only in milliseconds
+	IssuedBeforeNano int64     `bson:"issued_before_ns,omitempty"`
+	CreatedAt        time.Time `bson:"created_at"`
+	ExpiresAt        time.Time `bson:"expires_at"`
+}
+
+// Before returns the time tokens have to be issued before to be revoked, it is zero for the revocation by TokenID
+func (r Revocation) Before() time.Time {
+	if r.IssuedBeforeNano != 0 {
+		return time.Unix(0, r.IssuedBeforeNano).UTC()
+	}
+
+	return r.IssuedBefore
+}
+
+// PasswordReset is a one-time token sent by email, only its hash is stored
+type PasswordReset struct {
+	ID        string     `bson:"_id,omitempty"`
+	Hash      string     `bson:"hash"`
+	UserID    string     `bson:"user_id"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
@@ -0,0 +1,113 @@
+package resetdb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/token/tokenmodel"
+	"nprn/pkg/logging"
+	"time"
+)
+
+type ResetDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *ResetDB {
+	return &ResetDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes makes the token hash unique and lets mongo remove expired tokens by itself
+func (r *ResetDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (r *ResetDB) Create(ctx context.Context, reset tokenmodel.PasswordReset) (string, error) {
+	result, err := r.collection.InsertOne(ctx, reset)
+	if err != nil {
+		return "", fmt.Errorf("failed to create password reset: %v", err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
+	}
+	r.logger.Tracef("password reset id=%s is created for user id=%s", objID.Hex(), reset.UserID)
+
+	return objID.Hex(), nil
+}
+
+func (r *ResetDB) GetByHash(ctx context.Context, hash string) (tokenmodel.PasswordReset, error) {
+	result := r.collection.FindOne(ctx, bson.M{"hash": hash})
+	if result.Err() != nil {
+		return tokenmodel.PasswordReset{}, fmt.Errorf("failed to find password reset: %v", result.Err())
+	}
+
+	var reset tokenmodel.PasswordReset
+
+	err := result.Decode(&reset)
+	if err != nil {
+		return tokenmodel.PasswordReset{}, fmt.Errorf("failed to decode password reset: %v", err)
+	}
+
+	return reset, nil
+}
+
+// Use marks the token as used, it returns false if the token has been used before
+func (r *ResetDB) Use(ctx context.Context, id string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert password reset id=%v to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID, "used_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"used_at": time.Now().UTC()}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute use password reset: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseAll invalidates every unused token of the user
+func (r *ResetDB) UseAll(ctx context.Context, userID string) error {
+	filter := bson.M{"user_id": userID, "used_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"used_at": time.Now().UTC()}}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute use password resets of user: %v", err)
+	}
+
+	r.logger.Tracef("invalidated %d password resets of user id=%s", result.ModifiedCount, userID)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package revocationdb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/token/tokenmodel"
+	"nprn/pkg/logging"
+	"time"
+)
+
+type RevocationDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *RevocationDB {
+	return &RevocationDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes lets mongo remove revocations when the revoked tokens have expired anyway
+func (r *RevocationDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create revocation indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (r *RevocationDB) Create(ctx context.Context, revocation tokenmodel.Revocation) (string, error) {
+	result, err := r.collection.InsertOne(ctx, revocation)
+	if err != nil {
+		return "", fmt.Errorf("failed to create revocation: %v", err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
+	}
+	r.logger.Tracef("revocation id=%s is created for user id=%s", objID.Hex(), revocation.UserID)
+
+	return objID.Hex(), nil
+}
+
+// GetByUser returns revocations of the user which are still in force
+func (r *RevocationDB) GetByUser(ctx context.Context, userID string) ([]tokenmodel.Revocation, error) {
+	filter := bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revocations: %v", err)
+	}
+
+	var revocations []tokenmodel.Revocation
+
+	err = cursor.All(ctx, &revocations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode revocations: %v", err)
+	}
+
+	return revocations, nil
+}
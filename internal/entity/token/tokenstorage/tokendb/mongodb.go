@@ -0,0 +1,131 @@
+package tokendb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"nprn/internal/entity/token/tokenmodel"
+	"nprn/pkg/logging"
+	"time"
+)
+
+type TokenDB struct {
+	collection *mongo.Collection
+	logger     *logging.Logger
+}
+
+func NewCollection(database *mongo.Database, collection string, logger *logging.Logger) *TokenDB {
+	return &TokenDB{
+		collection: database.Collection(collection),
+		logger:     logger,
+	}
+}
+
+// CreateIndexes makes the token hash unique and lets mongo remove expired tokens by itself
+func (t *TokenDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "family_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := t.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token indexes: %v", err)
+	}
+
+	return nil
+}
+
+func (t *TokenDB) Create(ctx context.Context, token tokenmodel.RefreshToken) (string, error) {
+	result, err := t.collection.InsertOne(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to create refresh token: %v", err)
+	}
+
+	objID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
+	}
+	t.logger.Tracef("refresh token id=%s is created for user id=%s", objID.Hex(), token.UserID)
+
+	return objID.Hex(), nil
+}
+
+func (t *TokenDB) GetByHash(ctx context.Context, hash string) (tokenmodel.RefreshToken, error) {
+	filter := bson.M{"hash": hash}
+
+	result := t.collection.FindOne(ctx, filter)
+	if result.Err() != nil {
+		return tokenmodel.RefreshToken{}, fmt.Errorf("failed to find refresh token: %v", result.Err())
+	}
+
+	var token tokenmodel.RefreshToken
+
+	err := result.Decode(&token)
+	if err != nil {
+		return tokenmodel.RefreshToken{}, fmt.Errorf("failed to decode refresh token: %v", err)
+	}
+
+	return token, nil
+}
+
+// Rotate marks the token as used, it returns false if the token has been rotated before
+func (t *TokenDB) Rotate(ctx context.Context, id string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert refresh token id=%v to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID, "rotated_at": bson.M{"$exists": false}, "revoked": false}
+	update := bson.M{"$set": bson.M{"rotated_at": time.Now().UTC()}}
+
+	result, err := t.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute rotate refresh token: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (t *TokenDB) RevokeFamily(ctx context.Context, familyID string) error {
+	filter := bson.M{"family_id": familyID}
+	update := bson.M{"$set": bson.M{"revoked": true}}
+
+	result, err := t.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute revoke refresh token family: %v", err)
+	}
+
+	t.logger.Tracef("revoked %d refresh tokens of family %s", result.ModifiedCount, familyID)
+
+	return nil
+}
+
+func (t *TokenDB) RevokeUser(ctx context.Context, userID string) error {
+	filter := bson.M{"user_id": userID, "revoked": false}
+	update := bson.M{"$set": bson.M{"revoked": true}}
+
+	result, err := t.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute revoke refresh tokens of user: %v", err)
+	}
+
+	t.logger.Tracef("revoked %d refresh tokens of user id=%s", result.ModifiedCount, userID)
+
+	return nil
+}
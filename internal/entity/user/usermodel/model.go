@@ -1,11 +1,56 @@
 package usermodel
 
+import "time"
+
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleSeller  = "seller"
+	RoleViewer  = "viewer"
+)
+
 // UserInternal only internal use!!!
 type UserInternal struct {
-	ID           string `json:"id" bson:"_id,omitempty"`
-	Username     string `json:"username" bson:"username"`
+	ID       string `json:"id" bson:"_id,omitempty"`
+	Username string `json:"username" bson:"username"`
+	// UsernameKey is the normalized username, users are unique and found by it
+	UsernameKey  string `json:"-" bson:"username_key"`
 	PasswordHash string `json:"password" bson:"password"`
 	Email        string `json:"email" bson:"email"`
+	Role         string `json:"role" bson:"role"`
+	// TimeZone is IANA name, the days of sales of the user start in it
+	TimeZone string `json:"time_zone" bson:"time_zone"`
+
+	EmailVerified   bool       `json:"email_verified" bson:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" bson:"email_verified_at"`
+
+	MFA MFA `json:"-" bson:"mfa"`
+
+	// Disabled users can't sign in, their tokens are revoked when they are disabled
+	Disabled   bool       `json:"-" bson:"disabled"`
+	DisabledAt *time.Time `json:"-" bson:"disabled_at"`
+	// MustResetPassword is set by admins, the password doesn't work until it is reset by email
+	MustResetPassword bool `json:"-" bson:"must_reset_password"`
+}
+
+// ListFilter is for admins, Search matches a part of the username or the email
+type ListFilter struct {
+	Search string
+	Role   string
+	Skip   int64
+	Limit  int64
+}
+
+// MFA is the TOTP second factor, PendingSecret waits for the confirmation with a code
+type MFA struct {
+	Enabled       bool   `bson:"enabled"`
+	Secret        string `bson:"secret,omitempty"`
+	PendingSecret string `bson:"pending_secret,omitempty"`
+	// RecoveryCodes are sha-256 hashes of unused codes
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// LastCounter is the time step of the last accepted code, older codes are rejected
+	LastCounter int64      `bson:"last_counter"`
+	EnabledAt   *time.Time `bson:"enabled_at,omitempty"`
 }
 
 // UserTransfer for sharing
@@ -13,4 +58,31 @@ type UserTransfer struct {
 	ID       string `json:"id" bson:"_id"`
 	Username string `json:"username" bson:"username"`
 	Email    string `json:"email" bson:"email"`
+	Role     string `json:"role" bson:"role"`
+	TimeZone string `json:"time_zone,omitempty" bson:"time_zone"`
+
+	EmailVerified bool `json:"email_verified" bson:"email_verified"`
+	MFAEnabled    bool `json:"mfa_enabled" bson:"-"`
+}
+
+// NewUserTransfer drops everything secret from the user
+func NewUserTransfer(user UserInternal) UserTransfer {
+	return UserTransfer{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Role:          user.Role,
+		TimeZone:      user.TimeZone,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFA.Enabled,
+	}
+}
+
+// IsValidRole checks the role is one of the known roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleManager, RoleSeller, RoleViewer:
+		return true
+	}
+	return false
 }
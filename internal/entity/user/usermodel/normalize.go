@@ -0,0 +1,42 @@
+package usermodel
+
+import (
+	"fmt"
+	"golang.org/x/text/secure/precis"
+	"strings"
+)
+
+// DuplicateError is returned by the storage when the username or the email belongs to another user
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s is already taken", e.Field)
+}
+
+// NormalizeUsername returns the username to show and the key it is unique by.
+// The username is checked by the PRECIS profile (RFC 8265), so look-alike spellings get the same key:
+// "Anna" and "ＡＮＮＡ" are one user.
+func NormalizeUsername(username string) (string, string, error) {
+	display, err := precis.UsernameCasePreserved.String(strings.TrimSpace(username))
+	if err == nil && display == "" {
+		err = fmt.Errorf("username is empty")
+	}
+
+	if err != nil {
+		return "", "", fmt.Errorf("username %q is not valid: %v", username, err)
+	}
+
+	key, err := precis.UsernameCaseMapped.String(display)
+	if err != nil {
+		return "", "", fmt.Errorf("username %q is not valid: %v", username, err)
+	}
+
+	return display, key, nil
+}
+
+// NormalizeEmail lower-cases the whole address, mail servers treat the local part case-insensitively in practice
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,39 @@
+package usermodel
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	testTable := []struct {
+		name        string
+		username    string
+		exceptedKey string
+		exceptedErr bool
+	}{
+		{name: "Case", username: "AnnaTest", exceptedKey: "annatest"},
+		{name: "Full width", username: "ＡｎｎａTest", exceptedKey: "annatest"},
+		{name: "Spaces around", username: "  AnnaTest ", exceptedKey: "annatest"},
+		{name: "Cyrillic", username: "Анна", exceptedKey: "анна"},
+		{name: "Space inside", username: "Anna Test", exceptedErr: true},
+		{name: "Empty", username: "", exceptedErr: true},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, key, err := NormalizeUsername(testCase.username)
+			if testCase.exceptedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.exceptedKey, key)
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "anna@test.com", NormalizeEmail(" Anna@Test.COM "))
+}
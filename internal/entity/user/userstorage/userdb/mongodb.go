@@ -6,8 +6,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"nprn/internal/entity/user/usermodel"
 	"nprn/pkg/logging"
+	"regexp"
+	"strings"
+	"time"
 )
 
 type UserDB struct {
@@ -22,9 +26,145 @@ func NewCollection(database *mongo.Database, collection string, logger *logging.
 	}
 }
 
+const (
+	usernameIndex = "username_key_unique"
+	emailIndex    = "email_unique"
+)
+
+// CreateIndexes makes normalized usernames and emails unique, users without an email are allowed
+func (u *UserDB) CreateIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username_key", Value: 1}},
+			Options: options.Index().SetName(usernameIndex).SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName(emailIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+		},
+	}
+
+	_, err := u.collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return fmt.Errorf("failed to create user indexes (duplicate usernames and emails are listed by "+
+			"go run ./cmd/migrate): %v", err)
+	}
+
+	return nil
+}
+
+// Duplicate is a username key or an email used by more than one user, it doesn't allow CreateIndexes
+type Duplicate struct {
+	Field   string
+	Value   string
+	UserIDs []string
+}
+
+// Duplicates finds normalized usernames and emails which collide, NormalizeAll has to be done before
+func (u *UserDB) Duplicates(ctx context.Context) ([]Duplicate, error) {
+	var duplicates []Duplicate
+
+	for _, field := range []string{"username_key", "email"} {
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{field: bson.M{"$gt": ""}}}},
+			{{Key: "$group", Value: bson.M{"_id": "$" + field, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+			{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+			{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		}
+
+		cursor, err := u.collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find duplicate users: %v", err)
+		}
+
+		var groups []struct {
+			Value string               `bson:"_id"`
+			IDs   []primitive.ObjectID `bson:"ids"`
+		}
+
+		err = cursor.All(ctx, &groups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read duplicate users: %v", err)
+		}
+
+		for _, group := range groups {
+			duplicate := Duplicate{Field: field, Value: group.Value}
+			for _, id := range group.IDs {
+				duplicate.UserIDs = append(duplicate.UserIDs, id.Hex())
+			}
+
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+
+	return duplicates, nil
+}
+
+// CountNotNormalized counts users created before the normalization, the service doesn't start with them
+func (u *UserDB) CountNotNormalized(ctx context.Context) (int64, error) {
+	count, err := u.collection.CountDocuments(ctx, bson.M{"username_key": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users to normalize: %v", err)
+	}
+
+	return count, nil
+}
+
+// NormalizeAll fills username keys and lower-cases emails of users created before the normalization,
+// it has to be done before CreateIndexes
+func (u *UserDB) NormalizeAll(ctx context.Context) error {
+	cursor, err := u.collection.Find(ctx, bson.M{"username_key": bson.M{"$exists": false}})
+	if err != nil {
+		return fmt.Errorf("failed to find users to normalize: %v", err)
+	}
+
+	defer cursor.Close(ctx)
+
+	count := 0
+
+	for cursor.Next(ctx) {
+		var user usermodel.UserInternal
+
+		err = cursor.Decode(&user)
+		if err != nil {
+			return fmt.Errorf("failed to decode user: %v", err)
+		}
+
+		_, key, err := usermodel.NormalizeUsername(user.Username)
+		if err != nil {
+			u.logger.Warnf("user id=%s: %v, the lower-cased username is used as the key", user.ID, err)
+			key = strings.ToLower(user.Username)
+		}
+
+		err = u.updateOne(ctx, user.ID, bson.M{"$set": bson.M{
+			"username_key": key,
+			"email":        usermodel.NormalizeEmail(user.Email),
+		}}, "normalize user")
+		if err != nil {
+			return err
+		}
+
+		count++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read users to normalize: %v", err)
+	}
+
+	if count != 0 {
+		u.logger.Infof("%d users are normalized", count)
+	}
+
+	return nil
+}
+
 func (u *UserDB) Create(ctx context.Context, user usermodel.UserInternal) (string, error) {
 	result, err := u.collection.InsertOne(ctx, user)
 	if err != nil {
+		if duplicate := duplicateError(err); duplicate != nil {
+			return "", duplicate
+		}
 		return "", fmt.Errorf("failed to create new user: %v", err)
 	}
 
@@ -38,29 +178,269 @@ func (u *UserDB) Create(ctx context.Context, user usermodel.UserInternal) (strin
 	return "", fmt.Errorf("failed to convert objectID to Hex[%s]", objID.Hex())
 }
 
-func (u *UserDB) GetOne(ctx context.Context, username string, password string) (usermodel.UserTransfer, error) {
-	//objID, err := primitive.ObjectIDFromHex(id)
-	//if err != nil {
-	//	return usermodel.UserTransfer{}, fmt.Errorf("failed to convert Hex[%v] to objectID", objID)
-	//}
+func (u *UserDB) GetByID(ctx context.Context, id string) (usermodel.UserInternal, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return usermodel.UserInternal{}, fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID}
+
+	result := u.collection.FindOne(ctx, filter)
+	if result.Err() != nil {
+		return usermodel.UserInternal{}, fmt.Errorf("failed to find user with id=%s: %v", id, result.Err())
+	}
+
+	var user usermodel.UserInternal
+
+	err = result.Decode(&user)
+	if err != nil {
+		return usermodel.UserInternal{}, fmt.Errorf("failed to decode user: %v", err)
+	}
+
+	return user, nil
+}
+
+// GetByUsername finds the user by the key from usermodel.NormalizeUsername
+func (u *UserDB) GetByUsername(ctx context.Context, username string) (usermodel.UserInternal, error) {
+	filter := bson.M{"username_key": username}
 
-	filter := bson.M{"username": username, "password": password}
+	result := u.collection.FindOne(ctx, filter)
+	if result.Err() != nil {
+		return usermodel.UserInternal{}, fmt.Errorf("failed to find user with username[%s]: %v", username, result.Err())
+	}
+
+	var user usermodel.UserInternal
+
+	err := result.Decode(&user)
+	if err != nil {
+		return usermodel.UserInternal{}, fmt.Errorf("failed to decode user: %v", err)
+	}
+
+	return user, nil
+}
+
+func (u *UserDB) GetByEmail(ctx context.Context, email string) (usermodel.UserInternal, error) {
+	filter := bson.M{"email": email}
 
 	result := u.collection.FindOne(ctx, filter)
 	if result.Err() != nil {
-		return usermodel.UserTransfer{}, fmt.Errorf("failed to find user with username[%s] and/or password[%s]", username, password)
+		return usermodel.UserInternal{}, fmt.Errorf("failed to find user with email[%s]: %v", email, result.Err())
 	}
 
-	var user usermodel.UserTransfer
+	var user usermodel.UserInternal
 
 	err := result.Decode(&user)
 	if err != nil {
-		return usermodel.UserTransfer{}, fmt.Errorf("failed to decode user: %v", err)
+		return usermodel.UserInternal{}, fmt.Errorf("failed to decode user: %v", err)
 	}
 
 	return user, nil
 }
 
+// List returns a page of users sorted by username and the number of all users matching the filter
+func (u *UserDB) List(ctx context.Context, listFilter usermodel.ListFilter) ([]usermodel.UserInternal, int64, error) {
+	filter := bson.M{}
+
+	if listFilter.Search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(listFilter.Search), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"username": pattern}, bson.M{"email": pattern}}
+	}
+
+	if listFilter.Role != "" {
+		filter["role"] = listFilter.Role
+	}
+
+	total, err := u.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "username", Value: 1}}).
+		SetSkip(listFilter.Skip).
+		SetLimit(listFilter.Limit)
+
+	cursor, err := u.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %v", err)
+	}
+
+	users := []usermodel.UserInternal{}
+
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode users: %v", err)
+	}
+
+	return users, total, nil
+}
+
+func (u *UserDB) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	update := bson.M{"$set": bson.M{"disabled": disabled, "disabled_at": nil}}
+	if disabled {
+		update = bson.M{"$set": bson.M{"disabled": true, "disabled_at": time.Now().UTC()}}
+	}
+
+	return u.updateOne(ctx, id, update, "disable user")
+}
+
+func (u *UserDB) UpdateRole(ctx context.Context, id string, role string) error {
+	return u.updateOne(ctx, id, bson.M{"$set": bson.M{"role": role}}, "update role")
+}
+
+func (u *UserDB) SetMustResetPassword(ctx context.Context, id string) error {
+	return u.updateOne(ctx, id, bson.M{"$set": bson.M{"must_reset_password": true}}, "force password reset")
+}
+
+func (u *UserDB) updateOne(ctx context.Context, id string, update bson.M, action string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	result, err := u.collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute %s: %v", action, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user is not found")
+	}
+
+	return nil
+}
+
+// UpdatePassword also clears the forced password reset
+func (u *UserDB) UpdatePassword(ctx context.Context, id string, passwordHash string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$set": bson.M{"password": passwordHash, "must_reset_password": false}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute update password: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user is not found")
+	}
+
+	return nil
+}
+
+// SetEmailVerified marks the email verified if it is still the email of the user
+func (u *UserDB) SetEmailVerified(ctx context.Context, id string, email string, verifiedAt time.Time) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID, "email": email, "email_verified": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": verifiedAt}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute verify email: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (u *UserDB) UpdateMFA(ctx context.Context, id string, mfa usermodel.MFA) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$set": bson.M{"mfa": mfa}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to execute update mfa: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user is not found")
+	}
+
+	return nil
+}
+
+// UseTOTPCounter saves the time step of an accepted code, it returns false if the step (or a later one) was used
+func (u *UserDB) UseTOTPCounter(ctx context.Context, id string, counter int64) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID, "mfa.enabled": true, "mfa.last_counter": bson.M{"$lt": counter}}
+	update := bson.M{"$set": bson.M{"mfa.last_counter": counter}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute use totp counter: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the code hash, it returns false if there is no such code
+func (u *UserDB) UseRecoveryCode(ctx context.Context, id string, hash string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert user id[%v] to objectID: %v", id, err)
+	}
+
+	filter := bson.M{"_id": objID, "mfa.enabled": true, "mfa.recovery_codes": hash}
+	update := bson.M{"$pull": bson.M{"mfa.recovery_codes": hash}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute use recovery code: %v", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UpdateProfile saves only the fields the user changes in their profile, so the password, the role,
+// the second factor and the other fields changed at the same time are not overwritten
+func (u *UserDB) UpdateProfile(ctx context.Context, user usermodel.UserInternal) error {
+	objID, err := primitive.ObjectIDFromHex(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to convert user id[%v] to objectID: %v", user.ID, err)
+	}
+
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$set": bson.M{
+		"username":          user.Username,
+		"username_key":      user.UsernameKey,
+		"email":             user.Email,
+		"email_verified":    user.EmailVerified,
+		"email_verified_at": user.EmailVerifiedAt,
+		"time_zone":         user.TimeZone,
+	}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if duplicate := duplicateError(err); duplicate != nil {
+			return duplicate
+		}
+		return fmt.Errorf("failed to execute update profile: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user is not found")
+	}
+
+	return nil
+}
+
 func (u *UserDB) Update(ctx context.Context, user usermodel.UserInternal) error {
 
 	objID, err := primitive.ObjectIDFromHex(user.ID)
@@ -88,6 +468,9 @@ func (u *UserDB) Update(ctx context.Context, user usermodel.UserInternal) error
 
 	result, err := u.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
+		if duplicate := duplicateError(err); duplicate != nil {
+			return duplicate
+		}
 		return fmt.Errorf("failed to execute update user: %v", err)
 	}
 
@@ -122,3 +505,19 @@ func (u *UserDB) Delete(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// duplicateError tells which unique index is violated, the index name is only in the message
+func duplicateError(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	switch {
+	case strings.Contains(err.Error(), usernameIndex):
+		return &usermodel.DuplicateError{Field: "username"}
+	case strings.Contains(err.Error(), emailIndex):
+		return &usermodel.DuplicateError{Field: "email"}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/user/usermodel"
+	"nprn/internal/service"
+	"strconv"
+	"time"
+)
+
+type adminUser struct {
+	usermodel.UserTransfer
+	Disabled          bool  `json:"disabled"`
+	MustResetPassword bool  `json:"must_reset_password"`
+	SaleCount         int64 `json:"sale_count"`
+}
+
+type userPageResponse struct {
+	Users []adminUser `json:"users"`
+	Total int64       `json:"total"`
+	Page  int64       `json:"page"`
+	Limit int64       `json:"limit"`
+}
+
+type changeRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func newAdminUser(summary service.UserSummary) adminUser {
+	return adminUser{
+		UserTransfer:      summary.User,
+		Disabled:          summary.Disabled,
+		MustResetPassword: summary.MustResetPassword,
+		SaleCount:         summary.SaleCount,
+	}
+}
+
+// ListUsers supports ?search=, ?role=, ?page= and ?limit=
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	query := r.URL.Query()
+
+	page, err := queryInt(query.Get("page"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "page is not a number")
+	}
+
+	limit, err := queryInt(query.Get("limit"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "limit is not a number")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := h.service.ListUsers(ctx, query.Get("search"), query.Get("role"), page, limit)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	users := make([]adminUser, 0, len(result.Users))
+	for _, summary := range result.Users {
+		users = append(users, newAdminUser(summary))
+	}
+
+	return writeJSON(w, 200, userPageResponse{Users: users, Total: result.Total, Page: result.Page, Limit: result.Limit})
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	summary, err := h.service.GetUser(ctx, params.ByName("id"))
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, newAdminUser(summary))
+}
+
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.DisableUser(ctx, params.ByName("id"))
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.EnableUser(ctx, params.ByName("id"))
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+func (h *Handler) ChangeRole(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	var roleReq changeRoleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&roleReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = h.service.ChangeRole(ctx, params.ByName("id"), roleReq.Role)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// ForcePasswordReset signs the user out and mails a reset link
+func (h *Handler) ForcePasswordReset(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.ForcePasswordReset(ctx, params.ByName("id"))
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// queryInt treats an absent parameter as zero
+func queryInt(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
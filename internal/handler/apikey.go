@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/apikey/apikeymodel"
+	"time"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type createAPIKeyResponse struct {
+	Key string `json:"key"`
+	apikeymodel.APIKey
+}
+
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var keyReq createAPIKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&keyReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	key, apiKey, err := h.service.CreateAPIKey(ctx, keyReq.Name, keyReq.Scopes, keyReq.ExpiresAt)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	marshal, err := json.Marshal(createAPIKeyResponse{Key: key, APIKey: apiKey})
+	if err != nil {
+		return customerr.NewCustomError(err, "error with marshal json answer")
+	}
+
+	w.WriteHeader(200)
+	w.Write(marshal)
+
+	return nil
+}
+
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := h.service.GetAPIKeys(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	marshal, err := json.Marshal(result)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with marshal json answer")
+	}
+
+	w.WriteHeader(200)
+	w.Write(marshal)
+
+	return nil
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	idStr := params.ByName("id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.RevokeAPIKey(ctx, idStr)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	marshal, err := json.Marshal(&answer{ID: idStr})
+	if err != nil {
+		return customerr.NewCustomError(err, "error with marshal json answer")
+	}
+
+	w.WriteHeader(200)
+	w.Write(marshal)
+
+	return nil
+}
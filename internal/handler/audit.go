@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"time"
+)
+
+type auditPageResponse struct {
+	Events []auditmodel.Event `json:"events"`
+	Total  int64              `json:"total"`
+	Page   int64              `json:"page"`
+	Limit  int64              `json:"limit"`
+}
+
+// ListAudit supports ?from= and ?to= in RFC 3339, ?type=, ?user_id=, ?outcome=, ?page= and ?limit=
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	query := r.URL.Query()
+
+	from, err := queryTime(query.Get("from"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "from is not RFC 3339 time")
+	}
+
+	to, err := queryTime(query.Get("to"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "to is not RFC 3339 time")
+	}
+
+	page, err := queryInt(query.Get("page"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "page is not a number")
+	}
+
+	limit, err := queryInt(query.Get("limit"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "limit is not a number")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := h.service.ListAudit(ctx, auditmodel.Filter{
+		From:    from,
+		To:      to,
+		Type:    query.Get("type"),
+		UserID:  query.Get("user_id"),
+		Outcome: query.Get("outcome"),
+		Limit:   limit,
+	}, page)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, auditPageResponse{Events: result.Events, Total: result.Total, Page: result.Page, Limit: result.Limit})
+}
+
+// queryTime treats an absent parameter as zero time
+func queryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/service"
+	"strconv"
+	"strings"
+)
+
+// saleETag is the strong ETag of the sale version
+func saleETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch returns the sale version from If-Match, zero if the header is not sent and service.AnyVersion for "*".
+// A weak or unknown ETag can't match any version, so it gets Precondition Failed.
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		return 0, nil
+	}
+
+	if value == "*" {
+		return service.AnyVersion, nil
+	}
+
+	if strings.Contains(value, ",") {
+		return 0, customerr.NewCustomError(customerr.BadRequest, "If-Match has to be one ETag")
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version < 1 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return 0, customerr.NewCustomError(customerr.PreconditionFailed, "If-Match doesn't match the sale")
+	}
+
+	return version, nil
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"mime"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/sale/salemodel"
+	"nprn/pkg/server"
+	"nprn/pkg/xlsx"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFields are the columns of CSV and XLSX, the dates are RFC 3339 so the file can be imported again
+var exportFields = []string{"id", "article", "price_for_one", "number_of_units", "amount", "currency", "date",
+	"seller_id", "version", "created_at", "updated_at"}
+
+// formulaPrefixes are the first characters of text a spreadsheet runs as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// exportContentTypes are the formats of the export
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// saleWriter writes sales in one of the formats of the export, the file is complete after Close
+type saleWriter interface {
+	Write(sale salemodel.Sale) error
+	Close() error
+}
+
+// ExportSales supports ?format=csv|ndjson|xlsx (csv by default) and the filters and the sort of GetAllSales,
+// all the sales are written. ?formula_guard=false writes the text of CSV as it is. The sales are written as they are read, so the response can't report an error
+// after the first one: the connection is aborted and the client gets an incomplete body. The write deadline
+// of the server is moved as the sales are written.
+func (h *Handler) ExportSales(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return customerr.NewCustomError(customerr.BadRequest, "format has to be csv, ndjson or xlsx")
+	}
+
+	formulaGuard := true
+	if value := query.Get("formula_guard"); value != "" {
+		var err error
+
+		formulaGuard, err = strconv.ParseBool(value)
+		if err != nil {
+			return customerr.NewCustomError(customerr.BadRequest, "formula_guard has to be true or false")
+		}
+	}
+
+	var location *time.Location
+
+	filter, err := saleListFilter(query, func() *time.Location {
+		if location == nil {
+			location = h.service.Location(ctx)
+		}
+		return location
+	})
+	if err != nil {
+		return err
+	}
+
+	var writer saleWriter
+
+	// start sends the headers with the first sale, errors before it are answered as usual
+	start := func() error {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": "sales-" + time.Now().UTC().Format("20060102-150405") + "." + format,
+		}))
+		w.WriteHeader(200)
+
+		var err error
+
+		writer, err = newSaleWriter(format, &deadlineWriter{ctx: ctx, writer: w}, formulaGuard)
+
+		return err
+	}
+
+	err = h.service.ExportSales(ctx, filter, func(sale salemodel.Sale) error {
+		if writer == nil {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		return writer.Write(sale)
+	})
+	if err != nil {
+		if writer == nil {
+			h.logger.Info(err)
+			return err
+		}
+
+		h.logger.Errorf("export of sales is stopped: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if writer == nil {
+		err = start()
+		if err != nil {
+			h.logger.Errorf("export of sales is stopped: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		h.logger.Errorf("export of sales is stopped: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	return nil
+}
+
+// deadlineWriter moves the write deadline of the server while the export is written, so a long export
+// is not cut off and only a client which doesn't read for server.WriteTimeout is
+type deadlineWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	movedAt time.Time
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if now := time.Now(); now.Sub(d.movedAt) > time.Second {
+		err := server.SetWriteDeadline(d.ctx, now.Add(server.WriteTimeout))
+		if err != nil {
+			return 0, err
+		}
+
+		d.movedAt = now
+	}
+
+	return d.writer.Write(p)
+}
+
+// newSaleWriter writes the header, formulaGuard is used only by CSV: XLSX has text in inline strings,
+// they are never run as formulas
+func newSaleWriter(format string, w io.Writer, formulaGuard bool) (saleWriter, error) {
+	switch format {
+	case "ndjson":
+		return &ndjsonSaleWriter{encoder: json.NewEncoder(w)}, nil
+	case "xlsx":
+		writer, err := xlsx.NewWriter(w, "Sales")
+		if err != nil {
+			return nil, err
+		}
+
+		header := make([]xlsx.Cell, len(exportFields))
+		for i, field := range exportFields {
+			header[i] = xlsx.Cell{Value: field}
+		}
+
+		return &xlsxSaleWriter{writer: writer}, writer.WriteRow(header)
+	default:
+		writer := csv.NewWriter(w)
+
+		return &csvSaleWriter{writer: writer, formulaGuard: formulaGuard}, writer.Write(exportFields)
+	}
+}
+
+// exportRow returns the values of exportFields, numbers is true for the numeric ones
+func exportRow(sale salemodel.Sale) (values []string, numbers []bool) {
+	values = []string{
+		sale.ID,
+		sale.Article,
+		sale.PriceForOne.String(),
+		strconv.Itoa(sale.NumberOfUnits),
+		sale.Amount.String(),
+		sale.Currency,
+		sale.Date.Format(time.RFC3339),
+		sale.SellerID,
+		strconv.FormatInt(sale.Version, 10),
+		sale.CreatedAt.Format(time.RFC3339),
+		sale.UpdatedAt.Format(time.RFC3339),
+	}
+	numbers = []bool{false, false, true, true, true, false, false, false, true, false, false}
+
+	return values, numbers
+}
+
+// guardFormula keeps a spreadsheet from running the text as a formula, it is prefixed with "'".
+// The import removes the prefix, see unguardFormula.
+func guardFormula(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+// unguardFormula removes the prefix added by guardFormula
+func unguardFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+
+	return value
+}
+
+type csvSaleWriter struct {
+	writer       *csv.Writer
+	formulaGuard bool
+}
+
+func (c *csvSaleWriter) Write(sale salemodel.Sale) error {
+	values, numbers := exportRow(sale)
+
+	if c.formulaGuard {
+		for i, value := range values {
+			if !numbers[i] {
+				values[i] = guardFormula(value)
+			}
+		}
+	}
+
+	return c.writer.Write(values)
+}
+
+func (c *csvSaleWriter) Close() error {
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
+
+type ndjsonSaleWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonSaleWriter) Write(sale salemodel.Sale) error {
+	return n.encoder.Encode(sale)
+}
+
+func (n *ndjsonSaleWriter) Close() error {
+	return nil
+}
+
+type xlsxSaleWriter struct {
+	writer *xlsx.Writer
+}
+
+func (x *xlsxSaleWriter) Write(sale salemodel.Sale) error {
+	values, numbers := exportRow(sale)
+
+	cells := make([]xlsx.Cell, len(values))
+	for i, value := range values {
+		cells[i] = xlsx.Cell{Value: value, Number: numbers[i]}
+	}
+
+	return x.writer.WriteRow(cells)
+}
+
+func (x *xlsxSaleWriter) Close() error {
+	return x.writer.Close()
+}
@@ -4,15 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/julienschmidt/httprouter"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"nprn/internal/customerr"
+	"nprn/internal/entity/revision/revisionmodel"
 	"nprn/internal/entity/sale/salemodel"
 	"nprn/internal/entity/user/usermodel"
 	"nprn/internal/service"
 	"nprn/pkg/logging"
+	"nprn/pkg/money"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// maxPatchSize limits the body of PATCH, a sale is much smaller
+const maxPatchSize = 64 << 10
+
 type Handler struct {
 	service *service.Service
 	logger  *logging.Logger
@@ -23,14 +33,47 @@ type signInRequest struct {
 	Password string `json:"password"`
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type tokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// saleRequest takes the date as text, a date without time is parsed in the time zone of the user
+type saleRequest struct {
+	salemodel.Sale
+	Date string `json:"date"`
+}
+
+type salePageResponse struct {
+	Sales      []salemodel.Sale `json:"sales"`
+	NextCursor string           `json:"next_cursor"`
+	Total      int64            `json:"total"`
+}
+
+type revisionPageResponse struct {
+	Revisions []revisionmodel.Revision `json:"revisions"`
+	Total     int64                    `json:"total"`
+	Page      int64                    `json:"page"`
+	Limit     int64                    `json:"limit"`
 }
 
 type answer struct {
 	ID string `json:"id"`
 }
 
+// route is protected by CheckAuthorizationMiddleware and requires the permission
+type route struct {
+	method     string
+	path       string
+	permission service.Permission
+	handler    CustomHandlerFunc
+}
+
 func NewHandler(service *service.Service, logger *logging.Logger) *Handler {
 	return &Handler{service: service, logger: logger}
 }
@@ -38,18 +81,60 @@ func NewHandler(service *service.Service, logger *logging.Logger) *Handler {
 func (h *Handler) RegisterRouting(router *httprouter.Router) {
 
 	router.POST("/auth/sign-in", h.CheckErrorMiddleware(h.SignIn))
+	router.POST("/auth/sign-in/mfa", h.CheckErrorMiddleware(h.SignInMFA))
 	router.POST("/auth/sign-up", h.CheckErrorMiddleware(h.SignUp))
-	{
-		//router.PUT("/user/:id", h.CheckAuthorizationMiddleware(h.Update))
-		//router.DELETE("/user/:id", h.CheckAuthorizationMiddleware(h.Delete))
+	router.POST("/auth/refresh", h.CheckErrorMiddleware(h.Refresh))
+	router.POST("/auth/logout", h.CheckErrorMiddleware(h.Logout))
+	router.POST("/auth/verify-email", h.CheckErrorMiddleware(h.VerifyEmail))
+	router.POST("/auth/password/forgot", h.CheckErrorMiddleware(h.ForgotPassword))
+	router.POST("/auth/password/reset", h.CheckErrorMiddleware(h.ResetPassword))
+	router.GET("/.well-known/jwks.json", h.CheckErrorMiddleware(h.GetJWKS))
+
+	routes := []route{
+		{http.MethodGet, "/api/v1/sale/", service.PermissionSaleRead, h.GetAllSales},
+		{http.MethodGet, "/api/v1/sale/:id", service.PermissionSaleRead, h.GetSale},
+		{http.MethodPost, "/api/v1/sale/", service.PermissionSaleCreate, h.CreateSale},
+		{http.MethodPut, "/api/v1/sale/:id", service.PermissionSaleUpdate, h.UpdateSale},
+		{http.MethodPatch, "/api/v1/sale/:id", service.PermissionSaleUpdate, h.PatchSale},
+		{http.MethodDelete, "/api/v1/sale/:id", service.PermissionSaleDelete, h.DeleteSale},
+		{http.MethodPost, "/api/v1/sale/:id", service.PermissionSaleCreate, h.SaleAction},
+		{http.MethodPost, "/api/v1/sale/:id/restore", service.PermissionSaleDelete, h.RestoreSale},
+		{http.MethodGet, "/api/v1/sale/:id/history", service.PermissionSaleRead, h.GetSaleHistory},
+		{http.MethodPost, "/api/v1/sale/:id/history/:version/revert", service.PermissionSaleUpdate, h.RevertSale},
+
+		{http.MethodGet, "/api/v1/users/me", service.PermissionAuthenticated, h.GetMe},
+		{http.MethodPatch, "/api/v1/users/me", service.PermissionAuthenticated, h.UpdateMe},
+		{http.MethodDelete, "/api/v1/users/me", service.PermissionAuthenticated, h.DeleteMe},
+		{http.MethodPost, "/api/v1/users/me/password", service.PermissionAuthenticated, h.ChangePassword},
+
+		{http.MethodPost, "/auth/revoke", service.PermissionAuthenticated, h.RevokeToken},
+		{http.MethodPost, "/auth/logout-all", service.PermissionAuthenticated, h.LogoutAll},
+		{http.MethodPost, "/auth/verify-email/resend", service.PermissionAuthenticated, h.ResendVerification},
+
+		{http.MethodGet, "/api/v1/admin/users", service.PermissionUserManage, h.ListUsers},
+		{http.MethodGet, "/api/v1/admin/users/:id", service.PermissionUserManage, h.GetUser},
+		{http.MethodPost, "/api/v1/admin/users/:id/disable", service.PermissionUserManage, h.DisableUser},
+		{http.MethodPost, "/api/v1/admin/users/:id/enable", service.PermissionUserManage, h.EnableUser},
+		{http.MethodPut, "/api/v1/admin/users/:id/role", service.PermissionUserManage, h.ChangeRole},
+		{http.MethodPost, "/api/v1/admin/users/:id/reset-password", service.PermissionUserManage, h.ForcePasswordReset},
+		{http.MethodPost, "/api/v1/admin/users/:id/revoke-tokens", service.PermissionUserManage, h.RevokeUserTokens},
+		{http.MethodPost, "/api/v1/admin/users/:id/unlock", service.PermissionUserManage, h.UnlockUser},
+		{http.MethodPost, "/api/v1/admin/addresses/:ip/unlock", service.PermissionUserManage, h.UnlockAddress},
+
+		{http.MethodGet, "/api/v1/audit", service.PermissionAuditRead, h.ListAudit},
+
+		{http.MethodPost, "/api/v1/mfa/totp", service.PermissionAuthenticated, h.EnrollTOTP},
+		{http.MethodPost, "/api/v1/mfa/totp/confirm", service.PermissionAuthenticated, h.ConfirmTOTP},
+		{http.MethodPost, "/api/v1/mfa/totp/disable", service.PermissionAuthenticated, h.DisableTOTP},
+		{http.MethodPost, "/api/v1/mfa/recovery-codes", service.PermissionAuthenticated, h.RegenerateRecoveryCodes},
+
+		{http.MethodGet, "/api/v1/keys", service.PermissionAuthenticated, h.GetAPIKeys},
+		{http.MethodPost, "/api/v1/keys", service.PermissionAuthenticated, h.CreateAPIKey},
+		{http.MethodDelete, "/api/v1/keys/:id", service.PermissionAuthenticated, h.RevokeAPIKey},
 	}
 
-	{
-		router.GET("/api/v1/sale/", h.CheckAuthorizationMiddleware(h.GetAllSales))
-		router.GET("/api/v1/sale/:id", h.CheckAuthorizationMiddleware(h.GetSale))
-		router.POST("/api/v1/sale/", h.CheckAuthorizationMiddleware(h.CreateSale))
-		router.PUT("/api/v1/sale/:id", h.CheckAuthorizationMiddleware(h.UpdateSale))
-		router.DELETE("/api/v1/sale/:id", h.CheckAuthorizationMiddleware(h.DeleteSale))
+	for _, rt := range routes {
+		router.Handle(rt.method, rt.path, h.CheckAuthorizationMiddleware(rt.permission, rt.handler))
 	}
 
 	h.logger.Info("routing is registered")
@@ -65,52 +150,108 @@ func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 
 	defer r.Body.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	token, err := h.service.SignIn(ctx, signReq.Username, signReq.Password)
+	result, err := h.service.SignIn(ctx, signReq.Username, signReq.Password, h.clientIP(r))
 	if err != nil {
 		h.logger.Info(err)
 		return err
 	}
 
-	tr := tokenResponse{
-		Token: token,
+	if result.MFAToken != "" {
+		return writeMFAChallenge(w, result)
 	}
 
-	marshal, err := json.Marshal(tr)
+	return writeTokens(w, result.Tokens)
+}
+
+func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var usr usermodel.UserInternal
+
+	err := json.NewDecoder(r.Body).Decode(&usr)
 	if err != nil {
-		return customerr.NewCustomError(err, "error with marshal json answer")
+		return customerr.NewCustomError(err, "error with decode body")
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(marshal)
+	defer r.Body.Close()
 
-	return nil
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := h.service.SignUp(ctx, usr)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeTokens(w, tokens)
 }
 
-func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
-	var usr usermodel.UserInternal
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var refreshReq refreshRequest
 
-	err := json.NewDecoder(r.Body).Decode(&usr)
+	err := json.NewDecoder(r.Body).Decode(&refreshReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := h.service.Refresh(ctx, refreshReq.RefreshToken)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeTokens(w, tokens)
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var refreshReq refreshRequest
+
+	err := json.NewDecoder(r.Body).Decode(&refreshReq)
 	if err != nil {
 		return customerr.NewCustomError(err, "error with decode body")
 	}
 
 	defer r.Body.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	token, err := h.service.SignUp(ctx, usr)
+	err = h.service.Logout(ctx, refreshReq.RefreshToken)
 	if err != nil {
 		h.logger.Info(err)
 		return err
 	}
 
+	w.WriteHeader(204)
+
+	return nil
+}
+
+func (h *Handler) GetJWKS(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) error {
+	marshal, err := json.Marshal(h.service.JWKS())
+	if err != nil {
+		return customerr.NewCustomError(err, "error with marshal json answer")
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(200)
+	w.Write(marshal)
+
+	return nil
+}
+
+func writeTokens(w http.ResponseWriter, tokens service.TokenPair) error {
 	tr := tokenResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
 	}
 
 	marshal, err := json.Marshal(tr)
@@ -125,8 +266,22 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	return nil
 }
 
+// writeJSON writes v with the status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	marshal, err := json.Marshal(v)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with marshal json answer")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(marshal)
+
+	return nil
+}
+
 func (h *Handler) CreateSale(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
-	var sale salemodel.Sale
+	var sale saleRequest
 
 	err := json.NewDecoder(r.Body).Decode(&sale)
 	if err != nil {
@@ -135,10 +290,10 @@ func (h *Handler) CreateSale(w http.ResponseWriter, r *http.Request, _ httproute
 
 	defer r.Body.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	id, err := h.service.CreateSale(ctx, sale)
+	id, err := h.service.CreateSale(ctx, sale.Sale, sale.Date)
 	if err != nil {
 		h.logger.Info(err)
 		return err
@@ -154,10 +309,17 @@ func (h *Handler) CreateSale(w http.ResponseWriter, r *http.Request, _ httproute
 	return nil
 }
 
-func (h *Handler) GetSale(w http.ResponseWriter, _ *http.Request, params httprouter.Params) error {
+// GetSale also serves /api/v1/sale/trash and /api/v1/sale/export, httprouter doesn't allow a static segment next to :id
+func (h *Handler) GetSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	idStr := params.ByName("id")
+	switch idStr {
+	case "trash":
+		return h.ListTrash(w, r, params)
+	case "export":
+		return h.ExportSales(w, r, params)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	result, err := h.service.GetSale(ctx, idStr)
@@ -171,38 +333,134 @@ func (h *Handler) GetSale(w http.ResponseWriter, _ *http.Request, params httprou
 		return customerr.NewCustomError(err, "error with marshal json answer")
 	}
 
+	w.Header().Set("ETag", saleETag(result.Version))
 	w.WriteHeader(200)
 	w.Write(marshal)
 
 	return nil
 }
 
-func (h *Handler) GetAllSales(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) error {
+// GetAllSales supports ?seller_id=, ?article= (a prefix), ?currency=, ?min_amount=, ?max_amount=, ?date_from= and ?date_to=
+// (RFC 3339 or YYYY-MM-DD in the time zone of the user, both days are included), ?sort= (a field, with "-"
+// in descending order), ?limit= and ?cursor=
+func (h *Handler) GetAllSales(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	return h.listSales(w, r, h.service.GetAllSales)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// ListTrash lists deleted sales with the same parameters as GetAllSales
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	return h.listSales(w, r, h.service.ListTrash)
+}
+
+func (h *Handler) listSales(w http.ResponseWriter, r *http.Request,
+	list func(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error)) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	result, err := h.service.GetAllSales(ctx)
+	var location *time.Location
+
+	filter, err := saleListFilter(r.URL.Query(), func() *time.Location {
+		if location == nil {
+			location = h.service.Location(ctx)
+		}
+		return location
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := list(ctx, filter)
 	if err != nil {
 		h.logger.Info(err)
 		return err
 	}
 
-	marshal, err := json.Marshal(result)
+	return writeJSON(w, 200, salePageResponse{Sales: result.Sales, NextCursor: result.NextCursor, Total: result.Total})
+}
+
+// saleListFilter asks for the location only if a day has to be converted to time
+func saleListFilter(query url.Values, location func() *time.Location) (salemodel.ListFilter, error) {
+	filter := salemodel.ListFilter{
+		SellerID:      query.Get("seller_id"),
+		ArticlePrefix: query.Get("article"),
+		Currency:      strings.ToUpper(query.Get("currency")),
+		Sort:          strings.TrimPrefix(query.Get("sort"), "-"),
+		Descending:    strings.HasPrefix(query.Get("sort"), "-"),
+		Cursor:        query.Get("cursor"),
+	}
+
+	var err error
+
+	filter.Limit, err = queryInt(query.Get("limit"))
 	if err != nil {
-		return customerr.NewCustomError(err, "error with marshal json answer")
+		return filter, customerr.NewCustomError(customerr.BadRequest, "limit is not a number")
 	}
 
-	w.WriteHeader(200)
-	w.Write(marshal)
+	filter.MinAmount, err = queryDecimal(query.Get("min_amount"))
+	if err != nil {
+		return filter, customerr.NewCustomError(customerr.BadRequest, "min_amount is not a number")
+	}
 
-	return nil
+	filter.MaxAmount, err = queryDecimal(query.Get("max_amount"))
+	if err != nil {
+		return filter, customerr.NewCustomError(customerr.BadRequest, "max_amount is not a number")
+	}
+
+	filter.DateFrom, err = queryDate(query.Get("date_from"), location, false)
+	if err != nil {
+		return filter, customerr.NewCustomError(customerr.BadRequest, "date_from is not RFC 3339 time or YYYY-MM-DD")
+	}
+
+	filter.DateTo, err = queryDate(query.Get("date_to"), location, true)
+	if err != nil {
+		return filter, customerr.NewCustomError(customerr.BadRequest, "date_to is not RFC 3339 time or YYYY-MM-DD")
+	}
+
+	return filter, nil
+}
+
+// queryDecimal returns nil for an absent parameter
+func queryDecimal(value string) (*money.Decimal, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := money.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &number, nil
+}
+
+// queryDate returns the start of the day in the location, or the start of the next day for the last day
+// of a range. RFC 3339 time is taken as it is.
+func queryDate(value string, location func() *time.Location, last bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date, nil
+	}
+
+	date, err = time.ParseInLocation(salemodel.DateLayout, value, location())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if last {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date.UTC(), nil
 }
 
 func (h *Handler) UpdateSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	idStr := params.ByName("id")
 
-	var saleUpdate salemodel.Sale
+	var saleUpdate saleRequest
 
 	err := json.NewDecoder(r.Body).Decode(&saleUpdate)
 	if err != nil {
@@ -213,10 +471,15 @@ func (h *Handler) UpdateSale(w http.ResponseWriter, r *http.Request, params http
 
 	saleUpdate.ID = idStr
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	err = h.service.UpdateSale(ctx, saleUpdate)
+	version, err = h.service.UpdateSale(ctx, saleUpdate.Sale, saleUpdate.Date, version)
 	if err != nil {
 		h.logger.Info(err)
 		return err
@@ -226,19 +489,61 @@ func (h *Handler) UpdateSale(w http.ResponseWriter, r *http.Request, params http
 	if err != nil {
 		return customerr.NewCustomError(err, "error with marshal json answer")
 	}
+	w.Header().Set("ETag", saleETag(version))
 	w.WriteHeader(200)
 	w.Write(marshal)
 
 	return nil
 }
 
-func (h *Handler) DeleteSale(w http.ResponseWriter, _ *http.Request, params httprouter.Params) error {
+// PatchSale takes RFC 7396 merge patch, the fields which are not in the patch are kept
+func (h *Handler) PatchSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	idStr := params.ByName("id")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		return customerr.NewCustomError(customerr.UnsupportedMediaType,
+			"content type has to be application/merge-patch+json")
+	}
+
+	defer r.Body.Close()
+
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		return customerr.NewCustomError(err, "error with read body")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	version, err = h.service.PatchSale(ctx, idStr, patch, version)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.Header().Set("ETag", saleETag(version))
+
+	return writeJSON(w, 200, answer{ID: idStr})
+}
+
+func (h *Handler) DeleteSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	idStr := params.ByName("id")
+
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	err := h.service.DeleteSale(ctx, idStr)
+	err = h.service.DeleteSale(ctx, idStr, version)
 	if err != nil {
 		h.logger.Info(err)
 		return err
@@ -254,47 +559,80 @@ func (h *Handler) DeleteSale(w http.ResponseWriter, _ *http.Request, params http
 	return nil
 }
 
-//func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-//	var usr usermodel.UserInternal
-//
-//	err := json.NewDecoder(r.Body).Decode(&usr)
-//	if err != nil {
-//		return customerr.NewCustomError(err, "error with decode body")
-//	}
-//
-//	defer r.Body.Close()
-//
-//	idStr := params.ByName("id")
-//	usr.ID = idStr
-//
-//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-//	defer cancel()
-//
-//	err = h.service.UpdateUser(ctx, usr)
-//	if err != nil {
-//		h.logger.Info(err)
-//		return err
-//	}
-//
-//	w.WriteHeader(204)
-//
-//	return nil
-//}
-
-//
-//func (h *Handler) DeleteUser(w http.ResponseWriter, _ *http.Request, params httprouter.Params) error {
-//	idStr := params.ByName("id")
-//
-//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-//	defer cancel()
-//
-//	err := h.service.DeleteUser(ctx, idStr)
-//	if err != nil {
-//		h.logger.Info(err)
-//		return err
-//	}
-//
-//	w.WriteHeader(204)
-//
-//	return nil
-//}
+// RestoreSale takes the sale out of the trash
+func (h *Handler) RestoreSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	idStr := params.ByName("id")
+
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	version, err = h.service.RestoreSale(ctx, idStr, version)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.Header().Set("ETag", saleETag(version))
+
+	return writeJSON(w, 200, answer{ID: idStr})
+}
+
+// GetSaleHistory supports ?page= and ?limit=, the newest revisions are first
+func (h *Handler) GetSaleHistory(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	query := r.URL.Query()
+
+	page, err := queryInt(query.Get("page"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "page is not a number")
+	}
+
+	limit, err := queryInt(query.Get("limit"))
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "limit is not a number")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := h.service.GetSaleHistory(ctx, params.ByName("id"), page, limit)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, revisionPageResponse{Revisions: result.Revisions, Total: result.Total,
+		Page: result.Page, Limit: result.Limit})
+}
+
+// RevertSale makes the sale as it was in the revision
+func (h *Handler) RevertSale(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	idStr := params.ByName("id")
+
+	toVersion, err := strconv.ParseInt(params.ByName("version"), 10, 64)
+	if err != nil {
+		return customerr.NewCustomError(customerr.BadRequest, "version is not a number")
+	}
+
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	version, err = h.service.RevertSale(ctx, idStr, toVersion, version)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.Header().Set("ETag", saleETag(version))
+
+	return writeJSON(w, 200, answer{ID: idStr})
+}
@@ -1,19 +1,43 @@
 package handler
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/julienschmidt/httprouter"
 	"github.com/muesli/termenv"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
 	"log"
+	"mime"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"nprn/internal/config"
+	"nprn/internal/entity/apikey/apikeymodel"
+	"nprn/internal/entity/attempt/attemptmodel"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/revision/revisionmodel"
+	"nprn/internal/entity/sale/salemodel"
+	"nprn/internal/entity/token/tokenmodel"
 	"nprn/internal/entity/user/usermodel"
 	"nprn/internal/service"
 	mock_service "nprn/internal/service/mocks"
 	"nprn/pkg/logging"
+	"nprn/pkg/mail"
+	"nprn/pkg/money"
+	"nprn/pkg/passhash"
+	"nprn/pkg/server"
+	"nprn/pkg/totp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -26,31 +50,111 @@ func TestMain(m *testing.M) {
 }
 
 func TestHandler_SignUp(t *testing.T) {
-	type mockBehavior func(storage *mock_service.MockUserStorage, user usermodel.UserInternal)
-
-	token, _ := service.GenerateToken("1")
-	passHash, _ := service.GeneratePasswordHash("AnnaTestPass")
+	type mockBehavior func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer)
 
 	testTable := []struct {
-		name                string
-		inputBody           string
-		inputUser           usermodel.UserInternal
-		mockBehavior        mockBehavior
-		exceptedStatusCode  int
-		exceptedRequestBody string
+		name               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedUserID     string
+		exceptedBody       string
 	}{
 		{
 			name:      "OK",
 			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"test@test.com"}`,
-			inputUser: usermodel.UserInternal{
-				Username:     "AnnaTest",
-				PasswordHash: passHash,
-				Email:        "test@test.com"},
-			mockBehavior: func(storage *mock_service.MockUserStorage, user usermodel.UserInternal) {
-				storage.EXPECT().Create(gomock.Any(), user).Return("1", nil)
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+				storage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, user usermodel.UserInternal) (string, error) {
+						assert.Equal(t, "AnnaTest", user.Username)
+						assert.Equal(t, "annatest", user.UsernameKey)
+						assert.Equal(t, "test@test.com", user.Email)
+
+						ok, _, err := passhash.Verify("AnnaTestPass", user.PasswordHash)
+						assert.NoError(t, err)
+						assert.True(t, ok)
+						assert.False(t, user.EmailVerified)
+
+						return "1", nil
+					})
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, msg mail.Message) error {
+						assert.Equal(t, "test@test.com", msg.To)
+						assert.Contains(t, msg.Body, "http://test/verify-email?token=")
+						return nil
+					})
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
 			},
-			exceptedStatusCode:  200,
-			exceptedRequestBody: fmt.Sprintf(`{"token":"%s"}`, token),
+			exceptedStatusCode: 200,
+			exceptedUserID:     "1",
+		},
+		{
+			name:      "Mail error doesn't fail sign-up",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"test@test.com"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+				storage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("1", nil)
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any()).Return(errors.New("connection refused"))
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedUserID:     "1",
+		},
+		{
+			name:      "Invalid email",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"Anna <test@test.com>"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+			},
+			exceptedStatusCode: 400,
+		},
+		{
+			name:      "Invalid username",
+			inputBody: `{"username":"Anna Test", "password":"AnnaTestPass", "email":"test@test.com"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+			},
+			exceptedStatusCode: 400,
+		},
+		{
+			name:      "Time zone",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"test@test.com", "time_zone":"Europe/Moscow"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+				storage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, user usermodel.UserInternal) (string, error) {
+						assert.Equal(t, "Europe/Moscow", user.TimeZone)
+						return "1", nil
+					})
+				mailer.EXPECT().Send(gomock.Any(), gomock.Any()).Return(nil)
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedUserID:     "1",
+		},
+		{
+			name:      "Invalid time zone",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"test@test.com", "time_zone":"Mars/Olympus"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+			},
+			exceptedStatusCode: 400,
+			exceptedBody:       `{"message":"time zone is not IANA name"}`,
+		},
+		{
+			name:      "Local time zone of the server",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"test@test.com", "time_zone":"Local"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+			},
+			exceptedStatusCode: 400,
+		},
+		{
+			name:      "Email is taken",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass", "email":"TEST@test.com"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, mailer *mock_service.MockMailer) {
+				storage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, user usermodel.UserInternal) (string, error) {
+						assert.Equal(t, "test@test.com", user.Email)
+						return "", &usermodel.DuplicateError{Field: "email"}
+					})
+			},
+			exceptedStatusCode: 409,
+			exceptedBody:       `{"message":"email is already taken", "field":"email"}`,
 		},
 	}
 
@@ -60,11 +164,13 @@ func TestHandler_SignUp(t *testing.T) {
 			defer c.Finish()
 
 			userStorage := mock_service.NewMockUserStorage(c)
-			testCase.mockBehavior(userStorage, testCase.inputUser)
+			tokenStorage := mock_service.NewMockTokenStorage(c)
+			mailer := mock_service.NewMockMailer(c)
+			testCase.mockBehavior(userStorage, tokenStorage, mailer)
 
 			logger := logging.GetLogger()
 
-			testService := service.NewService(userStorage, nil, logger)
+			testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage, mailer: mailer})
 			testHandler := NewHandler(testService, logger)
 
 			router := httprouter.New()
@@ -76,37 +182,79 @@ func TestHandler_SignUp(t *testing.T) {
 			router.ServeHTTP(recorder, req)
 
 			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
-			assert.Equal(t, testCase.exceptedRequestBody, recorder.Body.String())
-
+			if testCase.exceptedUserID != "" {
+				assertTokens(t, testService, testCase.exceptedUserID, recorder.Body.Bytes())
+			}
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
 		})
 	}
 }
 
 func TestHandler_SignIn(t *testing.T) {
-	type mockBehavior func(storage *mock_service.MockUserStorage, username string, password string)
+	type mockBehavior func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage)
+
+	testService := newTestService(testDeps{})
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{
+		Memory:      testService.Config.Password.Memory,
+		Iterations:  testService.Config.Password.Iterations,
+		Parallelism: testService.Config.Password.Parallelism,
+		SaltLength:  testService.Config.Password.SaltLength,
+		KeyLength:   testService.Config.Password.KeyLength,
+	})
 
-	token, _ := service.GenerateToken("1")
-	passAnna, _ := service.GeneratePasswordHash("AnnaTestPass")
+	// sha-256 of "AnnaTestPass" prefixed with the old static salt
+	legacyAnna := fmt.Sprintf("%x", append([]byte("4hsd83jd7fsd2"), sha256Sum("AnnaTestPass")...))
 
 	testTable := []struct {
-		name                string
-		inputBody           string
-		inputUsername       string
-		inputPassword       string
-		mockBehavior        mockBehavior
-		exceptedStatusCode  int
-		exceptedRequestBody string
+		name               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedUserID     string
 	}{
 		{
-			name:          "OK",
-			inputBody:     `{"username":"AnnaTest", "password":"AnnaTestPass"}`,
-			inputUsername: "AnnaTest",
-			inputPassword: passAnna,
-			mockBehavior: func(storage *mock_service.MockUserStorage, username string, password string) {
-				storage.EXPECT().GetOne(gomock.Any(), username, password).Return(usermodel.UserTransfer{ID: "1", Username: "AnnaTest"}, nil)
+			name:      "OK",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				storage.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna}, nil)
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedUserID:     "1",
+		},
+		{
+			name:      "Legacy hash is upgraded",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				storage.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: legacyAnna}, nil)
+				storage.EXPECT().UpdatePassword(gomock.Any(), "1", gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, passwordHash string) error {
+						assert.True(t, passhash.IsPHC(passwordHash))
+						return nil
+					})
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
 			},
-			exceptedStatusCode:  200,
-			exceptedRequestBody: fmt.Sprintf(`{"token":"%s"}`, token),
+			exceptedStatusCode: 200,
+			exceptedUserID:     "1",
+		},
+		{
+			name:      "Wrong password",
+			inputBody: `{"username":"AnnaTest", "password":"WrongPass"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				storage.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna}, nil)
+			},
+			exceptedStatusCode: 404,
+		},
+		{
+			name:      "Unknown user",
+			inputBody: `{"username":"Nobody", "password":"AnnaTestPass"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				storage.EXPECT().GetByUsername(gomock.Any(), "nobody").Return(usermodel.UserInternal{}, errors.New("not found"))
+			},
+			exceptedStatusCode: 404,
 		},
 	}
 
@@ -116,11 +264,12 @@ func TestHandler_SignIn(t *testing.T) {
 			defer c.Finish()
 
 			userStorage := mock_service.NewMockUserStorage(c)
-			testCase.mockBehavior(userStorage, testCase.inputUsername, testCase.inputPassword)
+			tokenStorage := mock_service.NewMockTokenStorage(c)
+			testCase.mockBehavior(userStorage, tokenStorage)
 
 			logger := logging.GetLogger()
 
-			testService := service.NewService(userStorage, nil, logger)
+			testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage})
 			testHandler := NewHandler(testService, logger)
 
 			router := httprouter.New()
@@ -133,25 +282,2797 @@ func TestHandler_SignIn(t *testing.T) {
 			router.ServeHTTP(recorder, req)
 
 			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
-			assert.Equal(t, testCase.exceptedRequestBody, recorder.Body.String())
+			if testCase.exceptedUserID != "" {
+				assertTokens(t, testService, testCase.exceptedUserID, recorder.Body.Bytes())
+			}
 		})
 	}
 }
 
-func printWarning(message string) {
-	profile := termenv.ColorProfile()
+func TestHandler_Refresh(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage)
 
-	str := termenv.String(message)
-	styleStr := str.Foreground(profile.Color("#ff0000"))
+	rotatedAt := time.Now().Add(-time.Minute)
 
-	log.Println(styleStr)
+	stored := tokenmodel.RefreshToken{
+		ID:        "10",
+		UserID:    "1",
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	rotated := stored
+	rotated.RotatedAt = &rotatedAt
+
+	expired := stored
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+
+	testTable := []struct {
+		name               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+	}{
+		{
+			name:      "OK",
+			inputBody: `{"refresh_token":"refresh"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				tokens.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(stored, nil)
+				tokens.EXPECT().Rotate(gomock.Any(), "10").Return(true, nil)
+				storage.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", Role: usermodel.RoleManager}, nil)
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ interface{}, token tokenmodel.RefreshToken) (string, error) {
+						assert.Equal(t, "family", token.FamilyID)
+						return "11", nil
+					})
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:      "Reuse revokes family",
+			inputBody: `{"refresh_token":"refresh"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				tokens.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(rotated, nil)
+				tokens.EXPECT().RevokeFamily(gomock.Any(), "family").Return(nil)
+			},
+			exceptedStatusCode: 401,
+		},
+		{
+			name:      "Concurrent rotation revokes family",
+			inputBody: `{"refresh_token":"refresh"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				tokens.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(stored, nil)
+				tokens.EXPECT().Rotate(gomock.Any(), "10").Return(false, nil)
+				tokens.EXPECT().RevokeFamily(gomock.Any(), "family").Return(nil)
+			},
+			exceptedStatusCode: 401,
+		},
+		{
+			name:      "Expired",
+			inputBody: `{"refresh_token":"refresh"}`,
+			mockBehavior: func(storage *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage) {
+				tokens.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(expired, nil)
+			},
+			exceptedStatusCode: 401,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			userStorage := mock_service.NewMockUserStorage(c)
+			tokenStorage := mock_service.NewMockTokenStorage(c)
+			testCase.mockBehavior(userStorage, tokenStorage)
+
+			logger := logging.GetLogger()
+
+			testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage})
+			testHandler := NewHandler(testService, logger)
+
+			router := httprouter.New()
+
+			router.POST("/auth/refresh", testHandler.CheckErrorMiddleware(testHandler.Refresh))
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(testCase.inputBody))
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+		})
+	}
 }
 
-func printSuccess(message string) {
-	profile := termenv.ColorProfile()
+func TestHandler_RolePermissions(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
 
-	str := termenv.String(message)
-	styleStr := str.Foreground(profile.Color("#0dff00"))
+	testTable := []struct {
+		name               string
+		role               string
+		method             string
+		path               string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+	}{
+		{
+			name:   "Viewer reads sales",
+			role:   usermodel.RoleViewer,
+			method: "GET",
+			path:   "/api/v1/sale/",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "", Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:               "Viewer can't create sales",
+			role:               usermodel.RoleViewer,
+			method:             "POST",
+			path:               "/api/v1/sale/",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:               "Seller can't delete sales",
+			role:               usermodel.RoleSeller,
+			method:             "DELETE",
+			path:               "/api/v1/sale/61f867172c75ef87b9f4d040",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:   "Admin deletes sales",
+			role:   usermodel.RoleAdmin,
+			method: "DELETE",
+			path:   "/api/v1/sale/61f867172c75ef87b9f4d040",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), "61f867172c75ef87b9f4d040").Return(salemodel.Sale{ID: "61f867172c75ef87b9f4d040", SellerID: "2", Version: 3}, nil)
+				storage.EXPECT().Delete(gomock.Any(), "61f867172c75ef87b9f4d040", int64(3), "1").Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+	}
 
-	log.Println(styleStr)
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			logger := logging.GetLogger()
+
+			testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+			testHandler := NewHandler(testService, logger)
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBufferString(""))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+		})
+	}
+}
+
+func TestHandler_SaleOwnership(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
+
+	const saleID = "61f867172c75ef87b9f4d040"
+
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name               string
+		role               string
+		method             string
+		path               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+	}{
+		{
+			name:      "Seller id is taken from token",
+			role:      usermodel.RoleSeller,
+			method:    "POST",
+			path:      "/api/v1/sale/",
+			inputBody: `{"article":"12-223-41-33","price_for_one":"10","number_of_units":1,"date":"2022-02-01T10:00:00Z","seller_id":"2"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().Create(gomock.Any(), salemodel.Sale{Article: "12-223-41-33", PriceForOne: 100000, NumberOfUnits: 1,
+					Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "1"}).Return(saleID, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:      "Manager books sale for seller",
+			role:      usermodel.RoleManager,
+			method:    "POST",
+			path:      "/api/v1/sale/",
+			inputBody: `{"article":"12-223-41-33","price_for_one":"10","number_of_units":1,"date":"2022-02-01T10:00:00Z","seller_id":"2"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().Create(gomock.Any(), salemodel.Sale{Article: "12-223-41-33", PriceForOne: 100000, NumberOfUnits: 1,
+					Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "2"}).Return(saleID, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:   "Seller reads only own sales",
+			role:   usermodel.RoleSeller,
+			method: "GET",
+			path:   "/api/v1/sale/",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "1", Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:   "Seller can't read sale of another seller",
+			role:   usermodel.RoleSeller,
+			method: "GET",
+			path:   "/api/v1/sale/" + saleID,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(salemodel.Sale{ID: saleID, SellerID: "2"}, nil)
+			},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:      "Seller can't update sale of another seller",
+			role:      usermodel.RoleSeller,
+			method:    "PUT",
+			path:      "/api/v1/sale/" + saleID,
+			inputBody: `{"article":"12-223-41-33"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(salemodel.Sale{ID: saleID, SellerID: "2"}, nil)
+			},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:      "Seller updates own sale",
+			role:      usermodel.RoleSeller,
+			method:    "PUT",
+			path:      "/api/v1/sale/" + saleID,
+			inputBody: `{"article":"12-223-41-33","price_for_one":"10","number_of_units":1,"date":"2022-02-01T10:00:00Z","seller_id":"2"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(salemodel.Sale{ID: saleID, SellerID: "1"}, nil)
+				storage.EXPECT().Update(gomock.Any(), salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000,
+					NumberOfUnits: 1, Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "1"}).Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			userStorage := mock_service.NewMockUserStorage(c)
+			userStorage.EXPECT().GetByID(gomock.Any(), "2").Return(usermodel.UserInternal{ID: "2", Role: usermodel.RoleSeller}, nil).AnyTimes()
+
+			logger := logging.GetLogger()
+
+			testService := newTestService(testDeps{users: userStorage, sales: saleStorage, revocations: revocationStorage})
+			testHandler := NewHandler(testService, logger)
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+		})
+	}
+}
+
+func TestHandler_SaleValidation(t *testing.T) {
+	type mockBehavior func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage)
+
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name               string
+		role               string
+		strictAmount       bool
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedBody       string
+	}{
+		{
+			name: "Amount is computed",
+			role: usermodel.RoleSeller,
+			inputBody: `{"article":"13-222-21-21","price_for_one":"240.8","number_of_units":2,"amount":"240.8",
+				"date":"2022-02-01T13:00:00+03:00"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				sales.EXPECT().Create(gomock.Any(), salemodel.Sale{Article: "13-222-21-21", PriceForOne: 2408000,
+					NumberOfUnits: 2, Amount: 4816000, Currency: "USD", Date: saleDate, SellerID: "1"}).Return("1", nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:      "Amount is rounded to minor unit",
+			role:      usermodel.RoleSeller,
+			inputBody: `{"article":"12-223-41-33","price_for_one":"0.0125","number_of_units":3,"date":"2022-02-01"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				// the day starts in the time zone of the user
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", TimeZone: "Europe/Moscow"}, nil)
+				sales.EXPECT().Create(gomock.Any(), salemodel.Sale{Article: "12-223-41-33", PriceForOne: 125,
+					NumberOfUnits: 3, Amount: 400, Currency: "USD", Date: time.Date(2022, 1, 31, 21, 0, 0, 0, time.UTC),
+					SellerID: "1"}).Return("1", nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:      "Currency without minor unit",
+			role:      usermodel.RoleSeller,
+			inputBody: `{"article":"12-223-41-33","price_for_one":240.5,"number_of_units":1,"currency":"jpy","date":"01-02-2022"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				// the legacy layout in the default time zone
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1"}, nil)
+				sales.EXPECT().Create(gomock.Any(), salemodel.Sale{Article: "12-223-41-33", PriceForOne: 2405000,
+					NumberOfUnits: 1, Amount: 2410000, Currency: "JPY", Date: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+					SellerID: "1"}).Return("1", nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:               "Amount differs in strict mode",
+			role:               usermodel.RoleSeller,
+			strictAmount:       true,
+			inputBody:          `{"article":"13-222-21-21","price_for_one":"240.8","number_of_units":2,"amount":"240.8"}`,
+			mockBehavior:       func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {},
+			exceptedStatusCode: 422,
+			exceptedBody: `{"message":"validation failed", "errors":[
+				{"field":"amount", "message":"amount has to be price_for_one * number_of_units = 481.6"}]}`,
+		},
+		{
+			name:      "All invalid fields are returned",
+			role:      usermodel.RoleSeller,
+			inputBody: `{"article":" ","price_for_one":"-1","number_of_units":0,"currency":"XXY","date":"yesterday"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1"}, nil)
+			},
+			exceptedStatusCode: 422,
+			exceptedBody: `{"message":"validation failed", "errors":[
+				{"field":"article", "message":"article is required"},
+				{"field":"date", "message":"date has to be RFC 3339 time or YYYY-MM-DD"},
+				{"field":"number_of_units", "message":"number_of_units has to be positive"},
+				{"field":"price_for_one", "message":"price_for_one can't be negative"},
+				{"field":"currency", "message":"currency is not ISO 4217 code"}]}`,
+		},
+		{
+			name:      "Manager books sale for unknown seller",
+			role:      usermodel.RoleManager,
+			inputBody: `{"article":"12-223-41-33","price_for_one":"1","number_of_units":1,"seller_id":"not-an-id"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				users.EXPECT().GetByID(gomock.Any(), "not-an-id").Return(usermodel.UserInternal{}, errors.New("not found"))
+			},
+			exceptedStatusCode: 422,
+			exceptedBody:       `{"message":"validation failed", "errors":[{"field":"seller_id", "message":"seller is not found"}]}`,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			userStorage := mock_service.NewMockUserStorage(c)
+			testCase.mockBehavior(saleStorage, userStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{users: userStorage, sales: saleStorage, revocations: revocationStorage})
+			testService.Config.Sales.StrictAmount = testCase.strictAmount
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/v1/sale/", bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_SalePatch(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
+
+	const saleID = "61f867172c75ef87b9f4d040"
+
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	current := salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000, NumberOfUnits: 1,
+		Amount: 100000, Currency: "EUR", Date: saleDate, SellerID: "1"}
+
+	testTable := []struct {
+		name               string
+		method             string
+		contentType        string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedBody       string
+	}{
+		{
+			name:        "Patch keeps other fields and computes amount",
+			method:      "PATCH",
+			contentType: "application/merge-patch+json",
+			inputBody:   `{"number_of_units":3,"seller_id":"2","id":"another"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000,
+					NumberOfUnits: 3, Amount: 300000, Currency: "EUR", Date: saleDate, SellerID: "1"}).Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:        "Null removes field",
+			method:      "PATCH",
+			contentType: "application/merge-patch+json",
+			inputBody:   `{"article":null}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+			},
+			exceptedStatusCode: 422,
+			exceptedBody:       `{"message":"validation failed", "errors":[{"field":"article", "message":"article is required"}]}`,
+		},
+		{
+			name:               "Patch is not object",
+			method:             "PATCH",
+			contentType:        "application/merge-patch+json",
+			inputBody:          `["article"]`,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 400,
+		},
+		{
+			name:               "JSON Patch is not supported",
+			method:             "PATCH",
+			contentType:        "application/json-patch+json",
+			inputBody:          `[{"op":"remove","path":"/article"}]`,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 415,
+		},
+		{
+			name:        "Put replaces whole sale",
+			method:      "PUT",
+			contentType: "application/json",
+			inputBody:   `{"article":"13-222-21-21","price_for_one":"10","number_of_units":1,"date":"2022-02-01T10:00:00Z"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), salemodel.Sale{ID: saleID, Article: "13-222-21-21", PriceForOne: 100000,
+					NumberOfUnits: 1, Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "1"}).Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:        "Patch can't move sale to trash",
+			method:      "PATCH",
+			contentType: "application/merge-patch+json",
+			inputBody:   `{"number_of_units":3,"deleted_at":"2022-02-01T10:00:00Z","deleted_by":"1"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000,
+					NumberOfUnits: 3, Amount: 300000, Currency: "EUR", Date: saleDate, SellerID: "1"}).Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:        "Put can't move sale to trash",
+			method:      "PUT",
+			contentType: "application/json",
+			inputBody: `{"article":"13-222-21-21","price_for_one":"10","number_of_units":1,"date":"2022-02-01T10:00:00Z",
+				"deleted_at":"2022-02-01T10:00:00Z","deleted_by":"1"}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), salemodel.Sale{ID: saleID, Article: "13-222-21-21", PriceForOne: 100000,
+					NumberOfUnits: 1, Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "1"}).Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:        "Put without required fields",
+			method:      "PUT",
+			contentType: "application/json",
+			inputBody:   `{"number_of_units":1}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+			},
+			exceptedStatusCode: 422,
+			exceptedBody:       `{"message":"validation failed", "errors":[{"field":"article", "message":"article is required"}]}`,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+			testService.Config.Sales.StrictAmount = true
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, "/api/v1/sale/"+saleID, bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", testCase.contentType)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_SaleVersion(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
+
+	const saleID = "61f867172c75ef87b9f4d040"
+
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	current := salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000, NumberOfUnits: 1,
+		Amount: 100000, Currency: "USD", Date: saleDate, SellerID: "1", Version: 3}
+	updated := current
+	updated.NumberOfUnits = 2
+	updated.Amount = 200000
+
+	testTable := []struct {
+		name               string
+		method             string
+		ifMatch            string
+		requireIfMatch     bool
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedETag       string
+	}{
+		{
+			name:   "Get returns ETag",
+			method: "GET",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedETag:       `"3"`,
+		},
+		{
+			name:      "Patch with current ETag",
+			method:    "PATCH",
+			ifMatch:   `"3"`,
+			inputBody: `{"number_of_units":2}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), updated).Return(nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedETag:       `"4"`,
+		},
+		{
+			name:      "Put with stale ETag",
+			method:    "PUT",
+			ifMatch:   `"2"`,
+			inputBody: `{"article":"12-223-41-33","price_for_one":"10","number_of_units":2}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+			},
+			exceptedStatusCode: 412,
+		},
+		{
+			name:               "Weak ETag doesn't match",
+			method:             "PUT",
+			ifMatch:            `W/"3"`,
+			inputBody:          `{"article":"12-223-41-33","price_for_one":"10","number_of_units":2}`,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 412,
+		},
+		{
+			name:      "Sale is changed after it is read",
+			method:    "PATCH",
+			ifMatch:   `"3"`,
+			inputBody: `{"number_of_units":2}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), updated).Return(salemodel.ErrVersionConflict)
+			},
+			exceptedStatusCode: 412,
+		},
+		{
+			name:      "Sale is changed after it is read without If-Match",
+			method:    "PATCH",
+			inputBody: `{"number_of_units":2}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), updated).Return(salemodel.ErrVersionConflict)
+			},
+			exceptedStatusCode: 409,
+		},
+		{
+			name:           "If-Match is required",
+			method:         "DELETE",
+			requireIfMatch: true,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+			},
+			exceptedStatusCode: 428,
+		},
+		{
+			name:           "Any ETag meets the requirement",
+			method:         "PATCH",
+			ifMatch:        "*",
+			requireIfMatch: true,
+			inputBody:      `{"number_of_units":2}`,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Update(gomock.Any(), updated).Return(nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedETag:       `"4"`,
+		},
+		{
+			name:           "Any ETag and the sale is changed after it is read",
+			method:         "DELETE",
+			ifMatch:        "*",
+			requireIfMatch: true,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Delete(gomock.Any(), saleID, int64(3), "1").Return(salemodel.ErrVersionConflict)
+			},
+			exceptedStatusCode: 409,
+		},
+		{
+			name:           "Delete with current ETag",
+			method:         "DELETE",
+			ifMatch:        `"3"`,
+			requireIfMatch: true,
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				storage.EXPECT().Delete(gomock.Any(), saleID, int64(3), "1").Return(nil)
+			},
+			exceptedStatusCode: 200,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+			testService.Config.Sales.RequireIfMatch = testCase.requireIfMatch
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleAdmin})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, "/api/v1/sale/"+saleID, bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+			if testCase.method == "PATCH" {
+				req.Header.Set("Content-Type", "application/merge-patch+json")
+			}
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.exceptedETag, recorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestHandler_SaleTrash(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
+
+	const saleID = "61f867172c75ef87b9f4d040"
+
+	deletedAt := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	deleted := salemodel.Sale{ID: saleID, SellerID: "2", Version: 4, DeletedAt: &deletedAt, DeletedBy: "1"}
+
+	testTable := []struct {
+		name               string
+		role               string
+		method             string
+		path               string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedETag       string
+	}{
+		{
+			name:   "Admin lists trash",
+			role:   usermodel.RoleAdmin,
+			method: "GET",
+			path:   "/api/v1/sale/trash?limit=10",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{Deleted: true, Sort: "id", Limit: 10}).
+					Return(salemodel.Page{Sales: []salemodel.Sale{deleted}, Total: 1}, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:               "Manager can't list trash",
+			role:               usermodel.RoleManager,
+			method:             "GET",
+			path:               "/api/v1/sale/trash",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:   "Admin restores sale",
+			role:   usermodel.RoleAdmin,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/restore",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetDeleted(gomock.Any(), saleID).Return(deleted, nil)
+				storage.EXPECT().Restore(gomock.Any(), saleID, int64(4)).Return(nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedETag:       `"5"`,
+		},
+		{
+			name:   "Sale is not in trash",
+			role:   usermodel.RoleAdmin,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/restore",
+			mockBehavior: func(storage *mock_service.MockSaleStorage) {
+				storage.EXPECT().GetDeleted(gomock.Any(), saleID).Return(salemodel.Sale{}, errors.New("not found"))
+			},
+			exceptedStatusCode: 404,
+		},
+		{
+			name:               "Seller can't restore sale",
+			role:               usermodel.RoleSeller,
+			method:             "POST",
+			path:               "/api/v1/sale/" + saleID + "/restore",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 403,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, testCase.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.exceptedETag, recorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestHandler_SaleHistory(t *testing.T) {
+	type mockBehavior func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage)
+
+	const saleID = "61f867172c75ef87b9f4d040"
+
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	current := salemodel.Sale{ID: saleID, Article: "12-223-41-33", PriceForOne: 100000, NumberOfUnits: 2,
+		Amount: 200000, Currency: "USD", Date: saleDate, SellerID: "1", Version: 3, CreatedAt: saleDate}
+	first := current
+	first.NumberOfUnits = 1
+	first.Amount = 100000
+	first.Version = 1
+
+	testTable := []struct {
+		name               string
+		role               string
+		method             string
+		path               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedBody       string
+	}{
+		{
+			name:      "Patch records revision",
+			role:      usermodel.RoleSeller,
+			method:    "PATCH",
+			path:      "/api/v1/sale/" + saleID,
+			inputBody: `{"article":"13-222-21-21"}`,
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				sales.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+				revisions.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, revision revisionmodel.Revision) (string, error) {
+						assert.Equal(t, saleID, revision.SaleID)
+						assert.Equal(t, int64(4), revision.Version)
+						assert.Equal(t, int64(4), revision.Sale.Version)
+						assert.Equal(t, revisionmodel.ActionUpdated, revision.Action)
+						assert.Equal(t, "1", revision.UserID)
+						assert.Equal(t, []revisionmodel.Change{{Field: "article", From: "12-223-41-33", To: "13-222-21-21"}},
+							revision.Changes)
+						return "1", nil
+					})
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:   "Seller reads history",
+			role:   usermodel.RoleSeller,
+			method: "GET",
+			path:   "/api/v1/sale/" + saleID + "/history?limit=1",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				revisions.EXPECT().List(gomock.Any(), saleID, int64(0), int64(1)).Return([]revisionmodel.Revision{{
+					ID: "5", SaleID: saleID, Version: 1, Action: revisionmodel.ActionCreated, UserID: "1", Time: saleDate,
+					Sale: first, Changes: []revisionmodel.Change{{Field: "article", From: "", To: "12-223-41-33"}},
+				}}, int64(3), nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedBody: `{"revisions":[{"id":"5", "sale_id":"61f867172c75ef87b9f4d040", "version":1, "action":"created",
+				"user_id":"1", "time":"2022-02-01T10:00:00Z", "sale":{"id":"61f867172c75ef87b9f4d040",
+				"article":"12-223-41-33", "price_for_one":"10", "number_of_units":1, "amount":"10", "currency":"USD",
+				"date":"2022-02-01T10:00:00Z", "seller_id":"1", "version":1, "created_at":"2022-02-01T10:00:00Z",
+				"updated_at":"0001-01-01T00:00:00Z"}, "changes":[{"field":"article", "from":"", "to":"12-223-41-33"}]}],
+				"total":3, "page":1, "limit":1}`,
+		},
+		{
+			name:   "History of sale in trash",
+			role:   usermodel.RoleAdmin,
+			method: "GET",
+			path:   "/api/v1/sale/" + saleID + "/history",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(salemodel.Sale{}, errors.New("not found"))
+				sales.EXPECT().GetDeleted(gomock.Any(), saleID).Return(current, nil)
+				revisions.EXPECT().List(gomock.Any(), saleID, int64(0), int64(50)).Return([]revisionmodel.Revision{}, int64(0), nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedBody:       `{"revisions":[], "total":0, "page":1, "limit":50}`,
+		},
+		{
+			name:   "Seller can't read history of another seller",
+			role:   usermodel.RoleSeller,
+			method: "GET",
+			path:   "/api/v1/sale/" + saleID + "/history",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(salemodel.Sale{ID: saleID, SellerID: "2"}, nil)
+			},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:   "Revert to first revision",
+			role:   usermodel.RoleSeller,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/history/1/revert",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				revisions.EXPECT().GetByVersion(gomock.Any(), saleID, int64(1)).
+					Return(revisionmodel.Revision{SaleID: saleID, Version: 1, Sale: first}, nil)
+
+				reverted := first
+				reverted.Version = 3
+				sales.EXPECT().Update(gomock.Any(), reverted).Return(nil)
+
+				revisions.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, revision revisionmodel.Revision) (string, error) {
+						assert.Equal(t, revisionmodel.ActionReverted, revision.Action)
+						assert.Equal(t, int64(4), revision.Version)
+						assert.Equal(t, int64(1), revision.RevertedFrom)
+						assert.Equal(t, []revisionmodel.Change{
+							{Field: "number_of_units", From: "2", To: "1"},
+							{Field: "amount", From: "20", To: "10"},
+						}, revision.Changes)
+						return "2", nil
+					})
+			},
+			exceptedStatusCode: 200,
+			exceptedBody:       `{"id":"61f867172c75ef87b9f4d040"}`,
+		},
+		{
+			name:   "Seller's revert keeps the seller",
+			role:   usermodel.RoleSeller,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/history/1/revert",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+
+				other := first
+				other.SellerID = "2"
+				revisions.EXPECT().GetByVersion(gomock.Any(), saleID, int64(1)).
+					Return(revisionmodel.Revision{SaleID: saleID, Version: 1, Sale: other}, nil)
+
+				reverted := first
+				reverted.Version = 3
+				sales.EXPECT().Update(gomock.Any(), reverted).Return(nil)
+
+				revisions.EXPECT().Create(gomock.Any(), gomock.Any()).Return("2", nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedBody:       `{"id":"61f867172c75ef87b9f4d040"}`,
+		},
+		{
+			name:   "Revert to revision which is not valid now",
+			role:   usermodel.RoleSeller,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/history/1/revert",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+
+				invalid := first
+				invalid.Currency = "ABC"
+				revisions.EXPECT().GetByVersion(gomock.Any(), saleID, int64(1)).
+					Return(revisionmodel.Revision{SaleID: saleID, Version: 1, Sale: invalid}, nil)
+			},
+			exceptedStatusCode: 422,
+		},
+		{
+			name:   "Revert to unknown revision",
+			role:   usermodel.RoleSeller,
+			method: "POST",
+			path:   "/api/v1/sale/" + saleID + "/history/9/revert",
+			mockBehavior: func(sales *mock_service.MockSaleStorage, revisions *mock_service.MockRevisionStorage) {
+				sales.EXPECT().GetOne(gomock.Any(), saleID).Return(current, nil)
+				revisions.EXPECT().GetByVersion(gomock.Any(), saleID, int64(9)).
+					Return(revisionmodel.Revision{}, revisionmodel.ErrNotFound)
+			},
+			exceptedStatusCode: 404,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			revisionStorage := mock_service.NewMockRevisionStorage(c)
+			testCase.mockBehavior(saleStorage, revisionStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{sales: saleStorage, revisions: revisionStorage, revocations: revocationStorage})
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_SaleImport(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage)
+
+	saleDate := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	first := salemodel.Sale{Article: "12-223-41-33", PriceForOne: 2408000, NumberOfUnits: 2, Amount: 4816000,
+		Currency: "USD", Date: saleDate, SellerID: "1"}
+	second := salemodel.Sale{Article: "13-222-21-21", PriceForOne: 100000, NumberOfUnits: 1, Amount: 100000,
+		Currency: "EUR", Date: saleDate, SellerID: "1"}
+
+	csvBody := "Item,price_for_one,number_of_units,currency,date\n" +
+		"12-223-41-33,240.8,2,,2022-02-01\n" +
+		"12-223-41-34,ten,0,USD,2022-02-01\n" +
+		"13-222-21-21,10,1,eur,2022-02-01\n"
+
+	testTable := []struct {
+		name               string
+		role               string
+		query              string
+		contentType        string
+		inputBody          string
+		batchSize          int
+		maxSize            int64
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedBody       string
+	}{
+		{
+			name:        "CSV with column mapping",
+			query:       "?columns=article:Item",
+			contentType: "text/csv",
+			inputBody:   csvBody,
+			mockBehavior: func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				storage.EXPECT().CreateMany(gomock.Any(), []salemodel.Sale{first, second}).Return([]string{"a", "b"}, nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedBody: `{"dry_run":false, "total":3, "accepted":2, "rejected":1, "rows":[
+				{"line":2, "status":"accepted", "id":"a"},
+				{"line":3, "status":"rejected", "errors":[
+					{"field":"price_for_one", "message":"price_for_one is not a decimal number"},
+					{"field":"number_of_units", "message":"number_of_units has to be positive"}]},
+				{"line":4, "status":"accepted", "id":"b"}],
+				"batches":[{"first_line":2, "last_line":4, "rows":2, "stored":2}]}`,
+		},
+		{
+			name:        "CSV exported with formula guard",
+			contentType: "text/csv",
+			inputBody: "article,price_for_one,number_of_units,currency,date\n" +
+				"'-12-223-41-33,240.8,2,USD,2022-02-01\n" +
+				"\"'=13-222-21-21\",10,1,EUR,2022-02-01\n",
+			mockBehavior: func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				guarded := []salemodel.Sale{first, second}
+				guarded[0].Article = "-12-223-41-33"
+				guarded[1].Article = "=13-222-21-21"
+				storage.EXPECT().CreateMany(gomock.Any(), guarded).Return([]string{"a", "b"}, nil)
+			},
+			exceptedStatusCode: 200,
+			exceptedBody: `{"dry_run":false, "total":2, "accepted":2, "rejected":0, "rows":[
+				{"line":2, "status":"accepted", "id":"a"},
+				{"line":3, "status":"accepted", "id":"b"}],
+				"batches":[{"first_line":2, "last_line":3, "rows":2, "stored":2}]}`,
+		},
+		{
+			name:               "Dry run",
+			query:              "?columns=article:Item&dry_run=true",
+			contentType:        "text/csv",
+			inputBody:          csvBody,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {},
+			exceptedStatusCode: 200,
+			exceptedBody: `{"dry_run":true, "total":3, "accepted":2, "rejected":1, "rows":[
+				{"line":2, "status":"accepted"},
+				{"line":3, "status":"rejected", "errors":[
+					{"field":"price_for_one", "message":"price_for_one is not a decimal number"},
+					{"field":"number_of_units", "message":"number_of_units has to be positive"}]},
+				{"line":4, "status":"accepted"}]}`,
+		},
+		{
+			name:        "NDJSON in batches with storage failure",
+			contentType: "application/x-ndjson",
+			inputBody: `{"article":"12-223-41-33","price_for_one":"240.8","number_of_units":2,"date":"2022-02-01"}` + "\n\n" +
+				`{"article":` + "\n" +
+				`{"article":"13-222-21-21","price_for_one":"10","number_of_units":1,"currency":"EUR","date":"2022-02-01"}` + "\n",
+			batchSize: 1,
+			mockBehavior: func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				storage.EXPECT().CreateMany(gomock.Any(), []salemodel.Sale{first}).Return([]string{"a"}, nil)
+				storage.EXPECT().CreateMany(gomock.Any(), []salemodel.Sale{second}).Return(nil, errors.New("connection refused"))
+			},
+			exceptedStatusCode: 200,
+			exceptedBody: `{"dry_run":false, "total":3, "accepted":1, "rejected":2, "rows":[
+				{"line":1, "status":"accepted", "id":"a"},
+				{"line":3, "status":"rejected", "error":"line is not a valid sale: unexpected end of JSON input"},
+				{"line":4, "status":"rejected", "error":"sale is not stored, import it again"}],
+				"batches":[{"first_line":1, "last_line":1, "rows":1, "stored":1},
+					{"first_line":4, "last_line":4, "rows":1, "stored":0}]}`,
+		},
+		{
+			name:        "Manager imports for seller who is looked up once",
+			role:        usermodel.RoleManager,
+			contentType: "application/x-ndjson",
+			inputBody: `{"article":"12-223-41-33","price_for_one":"240.8","number_of_units":2,"date":"2022-02-01","seller_id":"2"}` + "\n" +
+				`{"article":"13-222-21-21","price_for_one":"10","number_of_units":1,"currency":"EUR","date":"2022-02-01","seller_id":"2"}` + "\n",
+			mockBehavior: func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {
+				users.EXPECT().GetByID(gomock.Any(), "2").Return(usermodel.UserInternal{ID: "2"}, nil).Times(1)
+
+				forSeller := []salemodel.Sale{first, second}
+				forSeller[0].SellerID = "2"
+				forSeller[1].SellerID = "2"
+				storage.EXPECT().CreateMany(gomock.Any(), forSeller).Return([]string{"a", "b"}, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:               "Mapped column is not in header",
+			query:              "?columns=article:Article",
+			contentType:        "text/csv",
+			inputBody:          csvBody,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {},
+			exceptedStatusCode: 400,
+			exceptedBody:       `{"message":"column \"Article\" is not in CSV header"}`,
+		},
+		{
+			name:               "Import is too large",
+			query:              "?columns=article:Item",
+			contentType:        "text/csv",
+			inputBody:          csvBody,
+			maxSize:            64,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {},
+			exceptedStatusCode: 400,
+			exceptedBody:       `{"message":"import is larger than 64 bytes"}`,
+		},
+		{
+			name:               "JSON is not supported",
+			contentType:        "application/json",
+			inputBody:          `[]`,
+			mockBehavior:       func(storage *mock_service.MockSaleStorage, users *mock_service.MockUserStorage) {},
+			exceptedStatusCode: 415,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			userStorage := mock_service.NewMockUserStorage(c)
+			testCase.mockBehavior(saleStorage, userStorage)
+
+			userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1"}, nil).AnyTimes()
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{users: userStorage, sales: saleStorage, revocations: revocationStorage})
+			testService.Config.Sales.Import = config.Import{MaxRows: 10, MaxSize: testCase.maxSize,
+				BatchSize: testCase.batchSize, Delimiter: ","}
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			role := testCase.role
+			if role == "" {
+				role = usermodel.RoleSeller
+			}
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/v1/sale/import"+testCase.query, bytes.NewBufferString(testCase.inputBody))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", testCase.contentType)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_Revocation(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	var revocations []tokenmodel.Revocation
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), "1").DoAndReturn(
+		func(_ context.Context, _ string) ([]tokenmodel.Revocation, error) {
+			return revocations, nil
+		}).Times(1)
+	revocationStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, revocation tokenmodel.Revocation) (string, error) {
+			revocations = append(revocations, revocation)
+			return "1", nil
+		}).Times(2)
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().RevokeUser(gomock.Any(), "1").Return(nil)
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "1", Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil).Times(3)
+
+	testService := newTestService(testDeps{sales: saleStorage, tokens: tokenStorage, revocations: revocationStorage})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	doRequest := func(method string, path string, token string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	identity := service.Identity{UserID: "1", Role: usermodel.RoleSeller}
+
+	first, _ := testService.GenerateToken(identity)
+	second, _ := testService.GenerateToken(identity)
+
+	assert.Equal(t, 200, doRequest("GET", "/api/v1/sale/", first))
+	assert.Equal(t, 204, doRequest("POST", "/auth/revoke", first))
+	assert.Equal(t, 401, doRequest("GET", "/api/v1/sale/", first))
+	assert.Equal(t, 200, doRequest("GET", "/api/v1/sale/", second))
+
+	assert.Equal(t, 204, doRequest("POST", "/auth/logout-all", second))
+	assert.Equal(t, 401, doRequest("GET", "/api/v1/sale/", second))
+
+	// signing in again in the same second as the logout gives a valid token
+	third, _ := testService.GenerateToken(identity)
+	assert.Equal(t, 200, doRequest("GET", "/api/v1/sale/", third))
+}
+
+func TestHandler_APIKey(t *testing.T) {
+	type mockBehavior func(keys *mock_service.MockAPIKeyStorage, users *mock_service.MockUserStorage,
+		sales *mock_service.MockSaleStorage)
+
+	const key = "nprn_test-key"
+
+	revokedAt := time.Now().Add(-time.Hour)
+
+	apiKey := apikeymodel.APIKey{ID: "5", UserID: "1", Scopes: []string{"sale:read"}}
+
+	revoked := apiKey
+	revoked.RevokedAt = &revokedAt
+
+	testTable := []struct {
+		name               string
+		method             string
+		path               string
+		header             string
+		value              string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+	}{
+		{
+			name:   "Read sales with X-API-Key",
+			method: "GET",
+			path:   "/api/v1/sale/",
+			header: "X-API-Key",
+			value:  key,
+			mockBehavior: func(keys *mock_service.MockAPIKeyStorage, users *mock_service.MockUserStorage, sales *mock_service.MockSaleStorage) {
+				keys.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(apiKey, nil)
+				keys.EXPECT().UpdateLastUsed(gomock.Any(), "5", gomock.Any()).Return(nil)
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", Role: usermodel.RoleAdmin}, nil)
+				// without sale:read:any scope the key sees only sales of its owner
+				sales.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "1", Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil)
+			},
+			exceptedStatusCode: 200,
+		},
+		{
+			name:   "Scope doesn't allow deleting",
+			method: "DELETE",
+			path:   "/api/v1/sale/61f867172c75ef87b9f4d040",
+			header: "Authorization",
+			value:  "ApiKey " + key,
+			mockBehavior: func(keys *mock_service.MockAPIKeyStorage, users *mock_service.MockUserStorage, sales *mock_service.MockSaleStorage) {
+				keys.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(apiKey, nil)
+				keys.EXPECT().UpdateLastUsed(gomock.Any(), "5", gomock.Any()).Return(nil)
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", Role: usermodel.RoleAdmin}, nil)
+			},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:   "Api key can't create api keys",
+			method: "POST",
+			path:   "/api/v1/keys",
+			header: "X-API-Key",
+			value:  key,
+			mockBehavior: func(keys *mock_service.MockAPIKeyStorage, users *mock_service.MockUserStorage, sales *mock_service.MockSaleStorage) {
+				keys.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(apiKey, nil)
+				keys.EXPECT().UpdateLastUsed(gomock.Any(), "5", gomock.Any()).Return(nil)
+				users.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", Role: usermodel.RoleAdmin}, nil)
+			},
+			exceptedStatusCode: 403,
+		},
+		{
+			name:   "Revoked key",
+			method: "GET",
+			path:   "/api/v1/sale/",
+			header: "X-API-Key",
+			value:  key,
+			mockBehavior: func(keys *mock_service.MockAPIKeyStorage, users *mock_service.MockUserStorage, sales *mock_service.MockSaleStorage) {
+				keys.EXPECT().GetByHash(gomock.Any(), gomock.Any()).Return(revoked, nil)
+			},
+			exceptedStatusCode: 401,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			apiKeyStorage := mock_service.NewMockAPIKeyStorage(c)
+			userStorage := mock_service.NewMockUserStorage(c)
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(apiKeyStorage, userStorage, saleStorage)
+
+			var events []auditmodel.Event
+
+			auditStorage := mock_service.NewMockAuditStorage(c)
+			auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, event auditmodel.Event) (string, error) {
+					events = append(events, event)
+					return "1", nil
+				}).AnyTimes()
+
+			testService := newTestService(testDeps{users: userStorage, sales: saleStorage, apiKeys: apiKeyStorage, audit: auditStorage})
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(testCase.method, testCase.path, bytes.NewBufferString(`{"name":"job","scopes":["sale:read"]}`))
+			req.Header.Set(testCase.header, testCase.value)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+
+			// a key which is not accepted is audited as a rejected token
+			if testCase.exceptedStatusCode != 401 {
+				require.NotEmpty(t, events)
+				assert.Equal(t, auditmodel.TypeTokenAccepted, events[0].Type)
+				assert.Equal(t, "apikey", events[0].Reason)
+				assert.Equal(t, "5", events[0].APIKeyID)
+			}
+		})
+	}
+}
+
+func TestHandler_Lockout(t *testing.T) {
+	type mockBehavior func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage,
+		attempts *mock_service.MockAttemptStorage)
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna}
+
+	notLocked := func(attempts *mock_service.MockAttemptStorage) {
+		attempts.EXPECT().Get(gomock.Any(), "user:annatest").Return(attemptmodel.Attempt{Key: "user:annatest"}, nil)
+		attempts.EXPECT().Get(gomock.Any(), "ip:192.0.2.1").Return(attemptmodel.Attempt{Key: "ip:192.0.2.1"}, nil)
+	}
+
+	testTable := []struct {
+		name               string
+		inputBody          string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedRetryAfter string
+	}{
+		{
+			name:      "Locked user",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass"}`,
+			mockBehavior: func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, attempts *mock_service.MockAttemptStorage) {
+				attempts.EXPECT().Get(gomock.Any(), "user:annatest").Return(attemptmodel.Attempt{
+					Key: "user:annatest", Failures: 5, LockedUntil: time.Now().Add(90 * time.Second)}, nil)
+				attempts.EXPECT().Get(gomock.Any(), "ip:192.0.2.1").Return(attemptmodel.Attempt{Key: "ip:192.0.2.1"}, nil)
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "90",
+		},
+		{
+			name:      "Failure below threshold",
+			inputBody: `{"username":"AnnaTest", "password":"WrongPass"}`,
+			mockBehavior: func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, attempts *mock_service.MockAttemptStorage) {
+				notLocked(attempts)
+				users.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(anna, nil)
+				attempts.EXPECT().AddFailure(gomock.Any(), "user:annatest", time.Hour).Return(attemptmodel.Attempt{Failures: 2}, nil)
+				attempts.EXPECT().AddFailure(gomock.Any(), "ip:192.0.2.1", time.Hour).Return(attemptmodel.Attempt{Failures: 2}, nil)
+			},
+			exceptedStatusCode: 404,
+		},
+		{
+			name:      "Failure after threshold doubles the delay",
+			inputBody: `{"username":"AnnaTest", "password":"WrongPass"}`,
+			mockBehavior: func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, attempts *mock_service.MockAttemptStorage) {
+				notLocked(attempts)
+				users.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(anna, nil)
+				attempts.EXPECT().AddFailure(gomock.Any(), "user:annatest", time.Hour).Return(attemptmodel.Attempt{Failures: 4}, nil)
+				attempts.EXPECT().AddFailure(gomock.Any(), "ip:192.0.2.1", time.Hour).Return(attemptmodel.Attempt{Failures: 4}, nil)
+				attempts.EXPECT().Lock(gomock.Any(), "user:annatest", gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, until time.Time) error {
+						assert.WithinDuration(t, time.Now().Add(60*time.Second), until, 5*time.Second)
+						return nil
+					})
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "60",
+		},
+		{
+			name:      "Unknown user is counted too",
+			inputBody: `{"username":"Nobody", "password":"WrongPass"}`,
+			mockBehavior: func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, attempts *mock_service.MockAttemptStorage) {
+				attempts.EXPECT().Get(gomock.Any(), "user:nobody").Return(attemptmodel.Attempt{}, nil)
+				attempts.EXPECT().Get(gomock.Any(), "ip:192.0.2.1").Return(attemptmodel.Attempt{}, nil)
+				users.EXPECT().GetByUsername(gomock.Any(), "nobody").Return(usermodel.UserInternal{}, errors.New("not found"))
+				attempts.EXPECT().AddFailure(gomock.Any(), "user:nobody", time.Hour).Return(attemptmodel.Attempt{Failures: 1}, nil)
+				attempts.EXPECT().AddFailure(gomock.Any(), "ip:192.0.2.1", time.Hour).Return(attemptmodel.Attempt{Failures: 1}, nil)
+			},
+			exceptedStatusCode: 404,
+		},
+		{
+			name:      "Success resets user failures",
+			inputBody: `{"username":"AnnaTest", "password":"AnnaTestPass"}`,
+			mockBehavior: func(users *mock_service.MockUserStorage, tokens *mock_service.MockTokenStorage, attempts *mock_service.MockAttemptStorage) {
+				notLocked(attempts)
+				users.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(anna, nil)
+				attempts.EXPECT().Delete(gomock.Any(), "user:annatest").Return(nil)
+				tokens.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
+			},
+			exceptedStatusCode: 200,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			userStorage := mock_service.NewMockUserStorage(c)
+			tokenStorage := mock_service.NewMockTokenStorage(c)
+			attemptStorage := mock_service.NewMockAttemptStorage(c)
+			testCase.mockBehavior(userStorage, tokenStorage, attemptStorage)
+
+			testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage, attempts: attemptStorage})
+			testService.Config.Lockout = config.Lockout{
+				Enabled:       true,
+				UserThreshold: 3,
+				IPThreshold:   10,
+				BaseDelay:     30 * time.Second,
+				MaxDelay:      time.Hour,
+				Window:        time.Hour,
+			}
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			router.POST("/auth/sign-in", testHandler.CheckErrorMiddleware(testHandler.SignIn))
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/auth/sign-in", bytes.NewBufferString(testCase.inputBody))
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.exceptedRetryAfter, recorder.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestHandler_EmailVerification(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	anna := usermodel.UserInternal{ID: "61f3af2865b5b322243a09c7", Username: "AnnaTest", Email: "test@test.com", Role: usermodel.RoleSeller}
+
+	var link string
+
+	mailer := mock_service.NewMockMailer(c)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, msg mail.Message) error {
+			link = msg.Body[strings.Index(msg.Body, "?token=")+len("?token="):]
+			link = link[:strings.Index(link, "\n")]
+			return nil
+		})
+
+	attemptStorage := mock_service.NewMockAttemptStorage(c)
+	attemptStorage.EXPECT().Get(gomock.Any(), "verify:"+anna.ID).Return(attemptmodel.Attempt{}, nil)
+	attemptStorage.EXPECT().AddFailure(gomock.Any(), "verify:"+anna.ID, time.Hour).Return(attemptmodel.Attempt{Failures: 1}, nil)
+	attemptStorage.EXPECT().Lock(gomock.Any(), "verify:"+anna.ID, gomock.Any()).Return(nil)
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	gomock.InOrder(
+		// resend
+		userStorage.EXPECT().GetByID(gomock.Any(), anna.ID).Return(anna, nil),
+		// verification with the link made for the old email
+		userStorage.EXPECT().GetByID(gomock.Any(), anna.ID).Return(usermodel.UserInternal{ID: anna.ID, Email: "new@test.com"}, nil),
+		userStorage.EXPECT().GetByID(gomock.Any(), anna.ID).Return(anna, nil),
+		userStorage.EXPECT().SetEmailVerified(gomock.Any(), anna.ID, "test@test.com", gomock.Any()).Return(true, nil),
+		// the link is used again
+		userStorage.EXPECT().GetByID(gomock.Any(), anna.ID).Return(usermodel.UserInternal{ID: anna.ID, Email: anna.Email, EmailVerified: true}, nil),
+	)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), anna.ID).Return(nil, nil).AnyTimes()
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: anna.ID, Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil)
+
+	testService := newTestService(testDeps{users: userStorage, sales: saleStorage, revocations: revocationStorage, attempts: attemptStorage, mailer: mailer})
+	testService.Config.Verification.Required = true
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	doRequest := func(method string, path string, token string, body string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	unverified, _ := testService.GenerateToken(service.Identity{UserID: anna.ID, Role: usermodel.RoleSeller})
+	verified, _ := testService.GenerateToken(service.Identity{UserID: anna.ID, Role: usermodel.RoleSeller, EmailVerified: true})
+
+	assert.Equal(t, 403, doRequest("GET", "/api/v1/sale/", unverified, ""))
+	assert.Equal(t, 200, doRequest("GET", "/api/v1/sale/", verified, ""))
+
+	assert.Equal(t, 202, doRequest("POST", "/auth/verify-email/resend", unverified, ""))
+	require.NotEmpty(t, link)
+
+	token, err := url.QueryUnescape(link)
+	require.NoError(t, err)
+
+	// a verification token is not an access token
+	assert.Equal(t, 401, doRequest("GET", "/api/v1/sale/", token, ""))
+
+	body := fmt.Sprintf(`{"token":%q}`, token)
+
+	assert.Equal(t, 400, doRequest("POST", "/auth/verify-email", "", body))
+	assert.Equal(t, 204, doRequest("POST", "/auth/verify-email", "", body))
+	assert.Equal(t, 400, doRequest("POST", "/auth/verify-email", "", body))
+	assert.Equal(t, 400, doRequest("POST", "/auth/verify-email", "", `{"token":"not a token"}`))
+}
+
+// testDeps are storages and the mailer of the test service, the test doesn't use the nil ones
+type testDeps struct {
+	users       service.UserStorage
+	sales       service.SaleStorage
+	tokens      service.TokenStorage
+	revocations service.RevocationStorage
+	resets      service.ResetStorage
+	apiKeys     service.APIKeyStorage
+	attempts    service.AttemptStorage
+	audit       service.AuditStorage
+	revisions   service.RevisionStorage
+	mailer      service.Mailer
+}
+
+// discardAudit is the audit storage of tests which don't check the audit log
+type discardAudit struct{}
+
+func (discardAudit) Create(context.Context, auditmodel.Event) (string, error) {
+	return "", nil
+}
+
+func (discardAudit) List(context.Context, auditmodel.Filter) ([]auditmodel.Event, int64, error) {
+	return nil, 0, nil
+}
+
+// discardRevisions is the revision storage of tests which don't check the history
+type discardRevisions struct{}
+
+func (discardRevisions) Create(context.Context, revisionmodel.Revision) (string, error) {
+	return "", nil
+}
+
+func (discardRevisions) CreateMany(context.Context, []revisionmodel.Revision) error {
+	return nil
+}
+
+func (discardRevisions) List(context.Context, string, int64, int64) ([]revisionmodel.Revision, int64, error) {
+	return nil, 0, nil
+}
+
+func (discardRevisions) GetByVersion(context.Context, string, int64) (revisionmodel.Revision, error) {
+	return revisionmodel.Revision{}, revisionmodel.ErrNotFound
+}
+
+func TestHandler_PasswordReset(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", Email: "test@test.com", Role: usermodel.RoleSeller}
+
+	done := make(chan struct{}, 2)
+
+	attemptStorage := mock_service.NewMockAttemptStorage(c)
+	attemptStorage.EXPECT().Get(gomock.Any(), gomock.Any()).Return(attemptmodel.Attempt{}, nil).Times(2)
+	attemptStorage.EXPECT().AddFailure(gomock.Any(), gomock.Any(), gomock.Any()).Return(attemptmodel.Attempt{Failures: 1}, nil).Times(2)
+	attemptStorage.EXPECT().Lock(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().GetByEmail(gomock.Any(), "nobody@test.com").DoAndReturn(
+		func(_ context.Context, _ string) (usermodel.UserInternal, error) {
+			done <- struct{}{}
+			return usermodel.UserInternal{}, errors.New("not found")
+		})
+	userStorage.EXPECT().GetByEmail(gomock.Any(), "test@test.com").Return(anna, nil)
+	userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(anna, nil)
+	userStorage.EXPECT().UpdatePassword(gomock.Any(), "1", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, passwordHash string) error {
+			ok, _, err := passhash.Verify("NewPass", passwordHash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			return nil
+		})
+
+	var reset tokenmodel.PasswordReset
+
+	resetStorage := mock_service.NewMockResetStorage(c)
+	resetStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, r tokenmodel.PasswordReset) (string, error) {
+			reset = r
+			reset.ID = "5"
+			return reset.ID, nil
+		})
+	resetStorage.EXPECT().GetByHash(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, hash string) (tokenmodel.PasswordReset, error) {
+			if hash != reset.Hash {
+				return tokenmodel.PasswordReset{}, errors.New("not found")
+			}
+			return reset, nil
+		}).Times(3)
+	resetStorage.EXPECT().Use(gomock.Any(), "5").DoAndReturn(
+		func(_ context.Context, _ string) (bool, error) {
+			now := time.Now()
+			reset.UsedAt = &now
+			return true, nil
+		})
+	resetStorage.EXPECT().UseAll(gomock.Any(), "1").Return(nil)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("7", nil)
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().RevokeUser(gomock.Any(), "1").Return(nil)
+
+	var token string
+
+	mailer := mock_service.NewMockMailer(c)
+	gomock.InOrder(
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, msg mail.Message) error {
+				assert.Equal(t, "test@test.com", msg.To)
+				token = msg.Body[strings.Index(msg.Body, "?token=")+len("?token="):]
+				token = token[:strings.Index(token, "\n")]
+				done <- struct{}{}
+				return nil
+			}),
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, msg mail.Message) error {
+				assert.Equal(t, "Your password was changed", msg.Subject)
+				return nil
+			}),
+	)
+
+	testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage, revocations: revocationStorage,
+		resets: resetStorage, attempts: attemptStorage, mailer: mailer})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	doRequest := func(path string, body string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, 400, doRequest("/auth/password/forgot", `{"email":"not an email"}`))
+	assert.Equal(t, 202, doRequest("/auth/password/forgot", `{"email":"nobody@test.com"}`))
+	assert.Equal(t, 202, doRequest("/auth/password/forgot", `{"email":"test@test.com"}`))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("password reset is not processed")
+		}
+	}
+
+	require.NotEmpty(t, token)
+	assert.Equal(t, hashToken(token), reset.Hash)
+
+	assert.Equal(t, 400, doRequest("/auth/password/reset", `{"token":"wrong", "password":"NewPass"}`))
+	assert.Equal(t, 204, doRequest("/auth/password/reset", fmt.Sprintf(`{"token":%q, "password":"NewPass"}`, token)))
+	assert.Equal(t, 400, doRequest("/auth/password/reset", fmt.Sprintf(`{"token":%q, "password":"OtherPass"}`, token)))
+}
+
+func TestHandler_MFA(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna, Role: usermodel.RoleManager}
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().GetByID(gomock.Any(), "1").DoAndReturn(
+		func(_ context.Context, _ string) (usermodel.UserInternal, error) {
+			return anna, nil
+		}).AnyTimes()
+	userStorage.EXPECT().GetByUsername(gomock.Any(), "annatest").DoAndReturn(
+		func(_ context.Context, _ string) (usermodel.UserInternal, error) {
+			return anna, nil
+		}).AnyTimes()
+	userStorage.EXPECT().UpdateMFA(gomock.Any(), "1", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, mfa usermodel.MFA) error {
+			anna.MFA = mfa
+			return nil
+		}).Times(2)
+	userStorage.EXPECT().UseTOTPCounter(gomock.Any(), "1", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, counter int64) (bool, error) {
+			if counter <= anna.MFA.LastCounter {
+				return false, nil
+			}
+			anna.MFA.LastCounter = counter
+			return true, nil
+		}).AnyTimes()
+	userStorage.EXPECT().UseRecoveryCode(gomock.Any(), "1", gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, hash string) (bool, error) {
+			for i, h := range anna.MFA.RecoveryCodes {
+				if h == hash {
+					anna.MFA.RecoveryCodes = append(anna.MFA.RecoveryCodes[:i], anna.MFA.RecoveryCodes[i+1:]...)
+					return true, nil
+				}
+			}
+			return false, nil
+		}).AnyTimes()
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil).AnyTimes()
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), "1").Return(nil, nil).AnyTimes()
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "", Sort: "id", Limit: 50}).Return(salemodel.Page{}, nil)
+
+	testService := newTestService(testDeps{users: userStorage, sales: saleStorage, tokens: tokenStorage, revocations: revocationStorage})
+	testService.Config.MFA = config.MFA{Issuer: "NPRN", ChallengeTTL: time.Minute, Skew: 1, RecoveryCodes: 3,
+		RequiredRoles: []string{usermodel.RoleAdmin, usermodel.RoleManager}}
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	doRequest := func(method string, path string, token string, body string, v interface{}) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(recorder, req)
+		if v != nil {
+			json.Unmarshal(recorder.Body.Bytes(), v)
+		}
+		return recorder.Code
+	}
+
+	var signIn struct {
+		Token       string `json:"token"`
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	// without the second factor a manager can only enroll it
+	require.Equal(t, 200, doRequest("POST", "/auth/sign-in", "", `{"username":"AnnaTest", "password":"AnnaTestPass"}`, &signIn))
+	require.NotEmpty(t, signIn.Token)
+	assert.Equal(t, 403, doRequest("GET", "/api/v1/sale/", signIn.Token, "", nil))
+	assert.Equal(t, 403, doRequest("POST", "/api/v1/keys", signIn.Token, `{"name":"key", "scopes":["sale:read"]}`, nil))
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+		QRCode string `json:"qr_code"`
+	}
+
+	require.Equal(t, 200, doRequest("POST", "/api/v1/mfa/totp", signIn.Token, "", &enrollment))
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/NPRN:AnnaTest?"))
+	assert.True(t, strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,"))
+
+	code, _ := totp.Code(enrollment.Secret, totp.Counter(time.Now()))
+
+	var recovery struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	assert.Equal(t, 401, doRequest("POST", "/api/v1/mfa/totp/confirm", signIn.Token, `{"code":"000000"}`, nil))
+	require.Equal(t, 200, doRequest("POST", "/api/v1/mfa/totp/confirm", signIn.Token, fmt.Sprintf(`{"code":%q}`, code), &recovery))
+	require.Len(t, recovery.RecoveryCodes, 3)
+	assert.True(t, anna.MFA.Enabled)
+
+	// now the password gives only a challenge
+	signIn.Token = ""
+	require.Equal(t, 200, doRequest("POST", "/auth/sign-in", "", `{"username":"AnnaTest", "password":"AnnaTestPass"}`, &signIn))
+	assert.Empty(t, signIn.Token)
+	assert.True(t, signIn.MFARequired)
+
+	var tokens tokenResponse
+
+	// the code used for the confirmation can't be used again
+	assert.Equal(t, 401, doRequest("POST", "/auth/sign-in/mfa", "", fmt.Sprintf(`{"mfa_token":%q, "code":%q}`, signIn.MFAToken, code), nil))
+	assert.Equal(t, 401, doRequest("POST", "/auth/sign-in/mfa", "", fmt.Sprintf(`{"mfa_token":"wrong", "code":%q}`, recovery.RecoveryCodes[0]), nil))
+
+	require.Equal(t, 200, doRequest("POST", "/auth/sign-in/mfa", "", fmt.Sprintf(`{"mfa_token":%q, "code":%q}`, signIn.MFAToken, recovery.RecoveryCodes[0]), &tokens))
+	assert.Equal(t, 401, doRequest("POST", "/auth/sign-in/mfa", "", fmt.Sprintf(`{"mfa_token":%q, "code":%q}`, signIn.MFAToken, recovery.RecoveryCodes[0]), nil))
+
+	identity, err := testService.ParseToken(tokens.Token)
+	require.NoError(t, err)
+	assert.True(t, identity.MFA)
+
+	assert.Equal(t, 200, doRequest("GET", "/api/v1/sale/", tokens.Token, "", nil))
+}
+
+func TestHandler_MFALockout(t *testing.T) {
+	type mockBehavior func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage)
+
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", Role: usermodel.RoleSeller,
+		MFA: usermodel.MFA{Enabled: true, Secret: "JBSWY3DPEHPK3PXP"}}
+
+	wrongCode := func(failures int) mockBehavior {
+		return func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage) {
+			attempts.EXPECT().Get(gomock.Any(), "mfa:1").Return(attemptmodel.Attempt{Key: "mfa:1", Failures: failures - 1}, nil)
+			users.EXPECT().UseRecoveryCode(gomock.Any(), "1", gomock.Any()).Return(false, nil)
+			attempts.EXPECT().AddFailure(gomock.Any(), "mfa:1", time.Hour).Return(attemptmodel.Attempt{Failures: failures}, nil)
+		}
+	}
+
+	testTable := []struct {
+		name               string
+		path               string
+		mockBehavior       mockBehavior
+		exceptedStatusCode int
+		exceptedRetryAfter string
+	}{
+		{
+			name:               "Disable, wrong code below threshold",
+			path:               "/api/v1/mfa/totp/disable",
+			mockBehavior:       wrongCode(2),
+			exceptedStatusCode: 401,
+		},
+		{
+			name: "Disable, wrong code at threshold",
+			path: "/api/v1/mfa/totp/disable",
+			mockBehavior: func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage) {
+				wrongCode(3)(users, attempts)
+				attempts.EXPECT().Lock(gomock.Any(), "mfa:1", gomock.Any()).Return(nil)
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "30",
+		},
+		{
+			name: "Disable while locked",
+			path: "/api/v1/mfa/totp/disable",
+			mockBehavior: func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage) {
+				attempts.EXPECT().Get(gomock.Any(), "mfa:1").Return(attemptmodel.Attempt{
+					Key: "mfa:1", Failures: 3, LockedUntil: time.Now().Add(90 * time.Second)}, nil)
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "90",
+		},
+		{
+			name: "Recovery codes, wrong code at threshold",
+			path: "/api/v1/mfa/recovery-codes",
+			mockBehavior: func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage) {
+				wrongCode(3)(users, attempts)
+				attempts.EXPECT().Lock(gomock.Any(), "mfa:1", gomock.Any()).Return(nil)
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "30",
+		},
+		{
+			name: "Recovery codes while locked",
+			path: "/api/v1/mfa/recovery-codes",
+			mockBehavior: func(users *mock_service.MockUserStorage, attempts *mock_service.MockAttemptStorage) {
+				attempts.EXPECT().Get(gomock.Any(), "mfa:1").Return(attemptmodel.Attempt{
+					Key: "mfa:1", Failures: 3, LockedUntil: time.Now().Add(90 * time.Second)}, nil)
+			},
+			exceptedStatusCode: 429,
+			exceptedRetryAfter: "90",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			userStorage := mock_service.NewMockUserStorage(c)
+			userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(anna, nil).AnyTimes()
+			attemptStorage := mock_service.NewMockAttemptStorage(c)
+			testCase.mockBehavior(userStorage, attemptStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), "1").Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{users: userStorage, revocations: revocationStorage, attempts: attemptStorage})
+			testService.Config.Lockout = config.Lockout{
+				Enabled:       true,
+				UserThreshold: 3,
+				IPThreshold:   10,
+				BaseDelay:     30 * time.Second,
+				MaxDelay:      time.Hour,
+				Window:        time.Hour,
+			}
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, _ := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller, MFA: true})
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", testCase.path, bytes.NewBufferString(`{"code":"wrong-code"}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			assert.Equal(t, testCase.exceptedRetryAfter, recorder.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestHandler_Me(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna, Email: "test@test.com", EmailVerified: true}
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(anna, nil).AnyTimes()
+	userStorage.EXPECT().GetByUsername(gomock.Any(), "taken").Return(usermodel.UserInternal{ID: "2"}, nil)
+	userStorage.EXPECT().UpdateProfile(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, user usermodel.UserInternal) error {
+			assert.Equal(t, "1", user.ID)
+			assert.Equal(t, "new@test.com", user.Email)
+			assert.False(t, user.EmailVerified)
+			assert.Equal(t, passAnna, user.PasswordHash)
+			return nil
+		})
+	userStorage.EXPECT().UpdatePassword(gomock.Any(), "1", gomock.Any()).Return(nil)
+	userStorage.EXPECT().Delete(gomock.Any(), "1").Return(nil)
+
+	mailer := mock_service.NewMockMailer(c)
+	gomock.InOrder(
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, msg mail.Message) error {
+				assert.Equal(t, "new@test.com", msg.To)
+				assert.Equal(t, "Confirm your email", msg.Subject)
+				return nil
+			}),
+		mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, msg mail.Message) error {
+				assert.Equal(t, "Your password was changed", msg.Subject)
+				return nil
+			}),
+	)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), "1").Return(nil, nil).AnyTimes()
+	revocationStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("7", nil).Times(2)
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().RevokeUser(gomock.Any(), "1").Return(nil).Times(2)
+
+	testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage, revocations: revocationStorage, mailer: mailer})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	token, _ := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+
+	doRequest := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := doRequest("GET", "/api/v1/users/me", "")
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{"id":"1", "username":"AnnaTest", "email":"test@test.com", "role":"seller", "email_verified":true, "mfa_enabled":false}`,
+		recorder.Body.String())
+
+	assert.Equal(t, 409, doRequest("PATCH", "/api/v1/users/me", `{"username":"Taken"}`).Code)
+	assert.Equal(t, 400, doRequest("PATCH", "/api/v1/users/me", `{"email":"not an email"}`).Code)
+
+	recorder = doRequest("PATCH", "/api/v1/users/me", `{"email":"new@test.com"}`)
+	assert.Equal(t, 200, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "password")
+
+	assert.Equal(t, 403, doRequest("POST", "/api/v1/users/me/password", `{"current_password":"Wrong", "new_password":"NewPass"}`).Code)
+	assert.Equal(t, 204, doRequest("POST", "/api/v1/users/me/password", `{"current_password":"AnnaTestPass", "new_password":"NewPass"}`).Code)
+
+	// all sessions are revoked after the password change
+	assert.Equal(t, 401, doRequest("GET", "/api/v1/users/me", "").Code)
+
+	time.Sleep(time.Second)
+	token, _ = testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+
+	assert.Equal(t, 403, doRequest("DELETE", "/api/v1/users/me", `{"password":"Wrong"}`).Code)
+	assert.Equal(t, 204, doRequest("DELETE", "/api/v1/users/me", `{"password":"AnnaTestPass"}`).Code)
+}
+
+func TestHandler_AdminUsers(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna, Email: "test@test.com"}
+	disabledAnna := anna
+	disabledAnna.Disabled = true
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().List(gomock.Any(), usermodel.ListFilter{Search: "anna", Skip: 10, Limit: 10}).
+		Return([]usermodel.UserInternal{anna}, int64(11), nil)
+	userStorage.EXPECT().GetByID(gomock.Any(), "404").Return(usermodel.UserInternal{}, errors.New("not found")).AnyTimes()
+	userStorage.EXPECT().SetDisabled(gomock.Any(), "1", true).Return(nil)
+	userStorage.EXPECT().UpdateRole(gomock.Any(), "1", usermodel.RoleManager).Return(nil)
+	userStorage.EXPECT().SetMustResetPassword(gomock.Any(), "1").Return(nil)
+	gomock.InOrder(
+		userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(anna, nil).Times(3),
+		userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(disabledAnna, nil).AnyTimes(),
+	)
+	userStorage.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(disabledAnna, nil)
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().CountBySeller(gomock.Any(), []string{"1"}).Return(map[string]int64{"1": 3}, nil)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("7", nil).Times(3)
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().RevokeUser(gomock.Any(), "1").Return(nil).Times(2)
+
+	resetStorage := mock_service.NewMockResetStorage(c)
+	resetStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("5", nil)
+
+	mailer := mock_service.NewMockMailer(c)
+	mailer.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, msg mail.Message) error {
+			assert.Equal(t, "test@test.com", msg.To)
+			assert.Equal(t, "Reset your password", msg.Subject)
+			return nil
+		})
+
+	testService := newTestService(testDeps{users: userStorage, sales: saleStorage, tokens: tokenStorage,
+		revocations: revocationStorage, resets: resetStorage, mailer: mailer})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	adminToken, _ := testService.GenerateToken(service.Identity{UserID: "9", Role: usermodel.RoleAdmin})
+	sellerToken, _ := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+
+	doRequest := func(token string, method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), "9").Return(nil, nil).AnyTimes()
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), "1").Return(nil, nil)
+
+	assert.Equal(t, 403, doRequest(sellerToken, "GET", "/api/v1/admin/users", "").Code)
+
+	recorder := doRequest(adminToken, "GET", "/api/v1/admin/users?search=anna&page=2&limit=10", "")
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{"users":[{"id":"1", "username":"AnnaTest", "email":"test@test.com", "role":"seller",
+		"email_verified":false, "mfa_enabled":false, "disabled":false, "must_reset_password":false, "sale_count":3}],
+		"total":11, "page":2, "limit":10}`, recorder.Body.String())
+
+	assert.Equal(t, 400, doRequest(adminToken, "GET", "/api/v1/admin/users?role=owner", "").Code)
+	assert.Equal(t, 404, doRequest(adminToken, "GET", "/api/v1/admin/users/404", "").Code)
+	assert.Equal(t, 400, doRequest(adminToken, "POST", "/api/v1/admin/users/9/disable", "").Code)
+	assert.Equal(t, 400, doRequest(adminToken, "PUT", "/api/v1/admin/users/1/role", `{"role":"owner"}`).Code)
+
+	assert.Equal(t, 204, doRequest(adminToken, "PUT", "/api/v1/admin/users/1/role", `{"role":"manager"}`).Code)
+	assert.Equal(t, 204, doRequest(adminToken, "POST", "/api/v1/admin/users/1/reset-password", "").Code)
+	assert.Equal(t, 204, doRequest(adminToken, "POST", "/api/v1/admin/users/1/disable", "").Code)
+
+	// tokens issued before disabling don't work and a new sign-in is rejected
+	assert.Equal(t, 401, doRequest(sellerToken, "GET", "/api/v1/users/me", "").Code)
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/auth/sign-in", bytes.NewBufferString(`{"username":"AnnaTest", "password":"AnnaTestPass"}`))
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, 403, recorder.Code)
+}
+
+func TestHandler_Audit(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	passAnna, _ := passhash.Hash("AnnaTestPass", passhash.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	anna := usermodel.UserInternal{ID: "1", Username: "AnnaTest", PasswordHash: passAnna}
+
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().GetByUsername(gomock.Any(), "annatest").Return(anna, nil).Times(2)
+
+	tokenStorage := mock_service.NewMockTokenStorage(c)
+	tokenStorage.EXPECT().Create(gomock.Any(), gomock.Any()).Return("10", nil)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	from := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	event := auditmodel.Event{ID: "5", Time: from.Add(time.Hour), Type: auditmodel.TypeSignIn,
+		Outcome: auditmodel.OutcomeSuccess, UserID: "1", IP: "192.0.2.1"}
+
+	auditStorage := mock_service.NewMockAuditStorage(c)
+	gomock.InOrder(
+		auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, event auditmodel.Event) (string, error) {
+				assert.Equal(t, auditmodel.TypeSignIn, event.Type)
+				assert.Equal(t, auditmodel.OutcomeFailure, event.Outcome)
+				assert.Equal(t, "wrong password", event.Reason)
+				assert.Equal(t, "1", event.UserID)
+				assert.Equal(t, "192.0.2.1", event.IP)
+				assert.Equal(t, "test-agent", event.UserAgent)
+				assert.WithinDuration(t, time.Now(), event.Time, time.Minute)
+				return "1", nil
+			}),
+		auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, event auditmodel.Event) (string, error) {
+				assert.Equal(t, auditmodel.OutcomeSuccess, event.Outcome)
+				assert.Empty(t, event.Reason)
+				return "2", nil
+			}),
+		auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, event auditmodel.Event) (string, error) {
+				assert.Equal(t, auditmodel.TypeTokenRejected, event.Type)
+				assert.Equal(t, auditmodel.OutcomeFailure, event.Outcome)
+				return "3", nil
+			}),
+		auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, event auditmodel.Event) (string, error) {
+				assert.Equal(t, auditmodel.TypeTokenAccepted, event.Type)
+				assert.Equal(t, auditmodel.OutcomeSuccess, event.Outcome)
+				assert.Equal(t, "bearer", event.Reason)
+				assert.Equal(t, "1", event.UserID)
+				assert.NotEmpty(t, event.TokenID)
+				assert.Equal(t, "GET /api/v1/audit", event.Details)
+				return "4", nil
+			}),
+		auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, event auditmodel.Event) (string, error) {
+				assert.Equal(t, auditmodel.TypeAccessDenied, event.Type)
+				assert.Equal(t, "1", event.UserID)
+				assert.Equal(t, "GET /api/v1/audit", event.Details)
+				return "5", nil
+			}),
+	)
+	// only the first of three requests with the token of the admin
+	auditStorage.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, event auditmodel.Event) (string, error) {
+			assert.Equal(t, auditmodel.TypeTokenAccepted, event.Type)
+			assert.Equal(t, "9", event.UserID)
+			return "6", nil
+		})
+	auditStorage.EXPECT().List(gomock.Any(), auditmodel.Filter{From: from, To: from.Add(24 * time.Hour),
+		UserID: "1", Limit: 50}).Return([]auditmodel.Event{event}, int64(1), nil)
+
+	testService := newTestService(testDeps{users: userStorage, tokens: tokenStorage, revocations: revocationStorage, audit: auditStorage})
+	testService.Config.Listen.TrustProxy = true
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	doRequest := func(method string, path string, authorization string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		req.Header.Set("User-Agent", "test-agent")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, 404, doRequest("POST", "/auth/sign-in", "", `{"username":"AnnaTest", "password":"WrongPass"}`).Code)
+	assert.Equal(t, 200, doRequest("POST", "/auth/sign-in", "", `{"username":"AnnaTest", "password":"AnnaTestPass"}`).Code)
+	assert.Equal(t, 401, doRequest("GET", "/api/v1/audit", "Bearer not-a-token", "").Code)
+
+	sellerToken, _ := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+	assert.Equal(t, 403, doRequest("GET", "/api/v1/audit", "Bearer "+sellerToken, "").Code)
+
+	adminToken, _ := testService.GenerateToken(service.Identity{UserID: "9", Role: usermodel.RoleAdmin})
+	assert.Equal(t, 400, doRequest("GET", "/api/v1/audit?from=yesterday", "Bearer "+adminToken, "").Code)
+	assert.Equal(t, 400, doRequest("GET", "/api/v1/audit?from=2022-02-02T00:00:00Z&to=2022-02-01T00:00:00Z",
+		"Bearer "+adminToken, "").Code)
+
+	recorder := doRequest("GET", "/api/v1/audit?from=2022-02-01T00:00:00Z&to=2022-02-02T00:00:00Z&user_id=1",
+		"Bearer "+adminToken, "")
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{"events":[{"id":"5", "time":"2022-02-01T01:00:00Z", "type":"sign_in", "outcome":"success",
+		"user_id":"1", "ip":"192.0.2.1"}], "total":1, "page":1, "limit":50}`, recorder.Body.String())
+}
+
+func TestHandler_ClientIP(t *testing.T) {
+	testService := newTestService(testDeps{})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	testTable := []struct {
+		name       string
+		trustProxy bool
+		proxyHops  int
+		forwarded  []string
+		exceptedIP string
+	}{
+		{
+			name:       "Without a proxy the header is ignored",
+			forwarded:  []string{"192.0.2.1"},
+			exceptedIP: "198.51.100.7",
+		},
+		{
+			name:       "Address appended by the proxy",
+			trustProxy: true,
+			proxyHops:  1,
+			forwarded:  []string{"203.0.113.9, 192.0.2.1"},
+			exceptedIP: "192.0.2.1",
+		},
+		{
+			name:       "Address appended by the first of two proxies",
+			trustProxy: true,
+			proxyHops:  2,
+			forwarded:  []string{"203.0.113.9, 192.0.2.1", "10.0.0.2"},
+			exceptedIP: "192.0.2.1",
+		},
+		{
+			name:       "Less addresses than proxies",
+			trustProxy: true,
+			proxyHops:  2,
+			forwarded:  []string{"192.0.2.1"},
+			exceptedIP: "198.51.100.7",
+		},
+		{
+			name:       "Without the header",
+			trustProxy: true,
+			proxyHops:  1,
+			exceptedIP: "198.51.100.7",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testService.Config.Listen.TrustProxy = testCase.trustProxy
+			testService.Config.Listen.ProxyHops = testCase.proxyHops
+
+			req := httptest.NewRequest("GET", "/api/v1/sale", nil)
+			req.RemoteAddr = "198.51.100.7:41000"
+			for _, forwarded := range testCase.forwarded {
+				req.Header.Add("X-Forwarded-For", forwarded)
+			}
+
+			assert.Equal(t, testCase.exceptedIP, testHandler.clientIP(req))
+		})
+	}
+}
+
+func TestHandler_SalesList(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	minAmount, _ := money.Parse("100")
+	saleDate := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	sale := salemodel.Sale{ID: "61f867172c75ef87b9f4d040", Article: "12-223-41-33", PriceForOne: 2408000,
+		NumberOfUnits: 1, Amount: 2408000, Currency: "USD", Date: saleDate, SellerID: "1", Version: 1,
+		CreatedAt: saleDate, UpdatedAt: saleDate}
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{SellerID: "1", ArticlePrefix: "12-", MinAmount: &minAmount,
+		DateFrom: time.Date(2022, 1, 31, 21, 0, 0, 0, time.UTC), DateTo: time.Date(2022, 2, 28, 21, 0, 0, 0, time.UTC),
+		Sort: "amount", Descending: true, Limit: 1}).
+		Return(salemodel.Page{Sales: []salemodel.Sale{sale}, NextCursor: "next", Total: 3}, nil)
+	saleStorage.EXPECT().GetAll(gomock.Any(), salemodel.ListFilter{Sort: "id", Limit: 500, Cursor: "bad"}).
+		Return(salemodel.Page{}, salemodel.ErrInvalidCursor)
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// date_from and date_to are days in the time zone of the user
+	userStorage := mock_service.NewMockUserStorage(c)
+	userStorage.EXPECT().GetByID(gomock.Any(), "1").Return(usermodel.UserInternal{ID: "1", TimeZone: "Europe/Moscow"}, nil).Times(2)
+
+	testService := newTestService(testDeps{users: userStorage, sales: saleStorage, revocations: revocationStorage})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	sellerToken, _ := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleSeller})
+	managerToken, _ := testService.GenerateToken(service.Identity{UserID: "2", Role: usermodel.RoleManager})
+
+	testTable := []struct {
+		name         string
+		query        string
+		token        string
+		exceptedCode int
+		exceptedBody string
+	}{
+		{
+			name:         "Filter, sort and limit",
+			query:        "?article=12-&min_amount=100&date_from=2022-02-01&date_to=2022-02-28&sort=-amount&limit=1",
+			token:        sellerToken,
+			exceptedCode: 200,
+			exceptedBody: `{"sales":[{"id":"61f867172c75ef87b9f4d040", "article":"12-223-41-33", "price_for_one":"240.8",
+				"number_of_units":1, "amount":"240.8", "currency":"USD", "date":"2022-02-01T10:00:00Z", "seller_id":"1",
+				"version":1, "created_at":"2022-02-01T10:00:00Z", "updated_at":"2022-02-01T10:00:00Z"}], "next_cursor":"next", "total":3}`,
+		},
+		{
+			name:         "Seller reads sales of another seller",
+			query:        "?seller_id=2",
+			token:        sellerToken,
+			exceptedCode: 403,
+		},
+		{
+			name:         "Unknown sort field",
+			query:        "?sort=seller_id",
+			token:        managerToken,
+			exceptedCode: 400,
+		},
+		{
+			name:         "Amount is not a number",
+			query:        "?max_amount=many",
+			token:        managerToken,
+			exceptedCode: 400,
+		},
+		{
+			name:         "Min amount is more than max amount",
+			query:        "?min_amount=10&max_amount=5",
+			token:        managerToken,
+			exceptedCode: 400,
+		},
+		{
+			name:         "Date is not YYYY-MM-DD",
+			query:        "?date_from=2022-02-01T00:00:00&date_to=2022-02-02T00:00:00Z",
+			token:        sellerToken,
+			exceptedCode: 400,
+		},
+		{
+			name:         "Cursor is not valid",
+			query:        "?limit=1000&cursor=bad",
+			token:        managerToken,
+			exceptedCode: 400,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/v1/sale/"+testCase.query, nil)
+			req.Header.Set("Authorization", "Bearer "+testCase.token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedCode, recorder.Code)
+			if testCase.exceptedBody != "" {
+				assert.JSONEq(t, testCase.exceptedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func newTestService(deps testDeps) *service.Service {
+	cfg := &config.Config{
+		JWT: config.JWT{
+			AccessTokenTTL:     15 * time.Minute,
+			RefreshTokenTTL:    720 * time.Hour,
+			RevocationCacheTTL: time.Minute,
+			SigningKey:         "test",
+			Keys: []config.JWTKey{
+				{ID: "test", Algorithm: "HS256", Secret: "test-secret"},
+			},
+		},
+		Password: config.Password{
+			Memory:      1024,
+			Iterations:  1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		Verification: config.Verification{
+			LinkURL:        "http://test/verify-email",
+			TokenTTL:       time.Hour,
+			ResendInterval: time.Minute,
+			ResendLimit:    3,
+			ResendWindow:   time.Hour,
+		},
+		PasswordReset: config.PasswordReset{
+			LinkURL:  "http://test/reset-password",
+			TokenTTL: time.Hour,
+			Interval: time.Minute,
+			Limit:    3,
+			Window:   time.Hour,
+		},
+		Sales: config.Sales{
+			DefaultCurrency: "USD",
+			TimeZone:        "UTC",
+			DateLayouts:     []string{"02-01-2006"},
+		},
+	}
+
+	keys, err := service.LoadKeySet(cfg.JWT)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if deps.audit == nil {
+		deps.audit = discardAudit{}
+	}
+
+	if deps.revisions == nil {
+		deps.revisions = discardRevisions{}
+	}
+
+	return service.NewService(deps.users, deps.sales, deps.tokens, deps.revocations, deps.resets,
+		deps.apiKeys, deps.attempts, deps.audit, deps.revisions, deps.mailer, keys, cfg, logging.GetLogger())
+}
+
+func assertTokens(t *testing.T, testService *service.Service, exceptedUserID string, body []byte) {
+	t.Helper()
+
+	var tr tokenResponse
+
+	err := json.Unmarshal(body, &tr)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tr.RefreshToken)
+
+	identity, err := testService.ParseToken(tr.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, exceptedUserID, identity.UserID)
+	assert.Equal(t, usermodel.RoleSeller, identity.Role)
+}
+
+func hashToken(token string) string {
+	return fmt.Sprintf("%x", sha256Sum(token))
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+func printWarning(message string) {
+	profile := termenv.ColorProfile()
+
+	str := termenv.String(message)
+	styleStr := str.Foreground(profile.Color("#ff0000"))
+
+	log.Println(styleStr)
+}
+
+func printSuccess(message string) {
+	profile := termenv.ColorProfile()
+
+	str := termenv.String(message)
+	styleStr := str.Foreground(profile.Color("#0dff00"))
+
+	log.Println(styleStr)
+}
+
+func TestHandler_SaleExport(t *testing.T) {
+	type mockBehavior func(storage *mock_service.MockSaleStorage)
+
+	date := time.Date(2022, 2, 1, 10, 0, 0, 0, time.UTC)
+	price, _ := money.Parse("2.50")
+	amount, _ := money.Parse("10.00")
+	sale := salemodel.Sale{ID: "61f867172c75ef87b9f4d040", Article: "tea, green", PriceForOne: price,
+		NumberOfUnits: 4, Amount: amount, Currency: "EUR", Date: date, SellerID: "2", Version: 1,
+		CreatedAt: date, UpdatedAt: date}
+
+	exportSales := func(filter salemodel.ListFilter, sales ...salemodel.Sale) mockBehavior {
+		return func(storage *mock_service.MockSaleStorage) {
+			storage.EXPECT().Export(gomock.Any(), filter, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ salemodel.ListFilter, each func(sale salemodel.Sale) error) error {
+					for _, sale := range sales {
+						if err := each(sale); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+		}
+	}
+
+	testTable := []struct {
+		name                string
+		role                string
+		path                string
+		mockBehavior        mockBehavior
+		exceptedStatusCode  int
+		exceptedContentType string
+		exceptedExtension   string
+		exceptedBody        string
+	}{
+		{
+			name:                "CSV by default",
+			role:                usermodel.RoleAdmin,
+			path:                "/api/v1/sale/export?currency=eur&sort=-amount",
+			mockBehavior:        exportSales(salemodel.ListFilter{Currency: "EUR", Sort: "amount", Descending: true}, sale),
+			exceptedStatusCode:  200,
+			exceptedContentType: "text/csv; charset=utf-8",
+			exceptedExtension:   ".csv",
+			exceptedBody: "id,article,price_for_one,number_of_units,amount,currency,date,seller_id,version,created_at,updated_at\n" +
+				"61f867172c75ef87b9f4d040,\"tea, green\",2.5,4,10,EUR,2022-02-01T10:00:00Z,2,1,2022-02-01T10:00:00Z,2022-02-01T10:00:00Z\n",
+		},
+		{
+			name: "Formulas are exported as text",
+			role: usermodel.RoleAdmin,
+			path: "/api/v1/sale/export",
+			mockBehavior: exportSales(salemodel.ListFilter{Sort: "id"}, func() salemodel.Sale {
+				formula := sale
+				formula.Article = "=HYPERLINK(\"http://example.com\")"
+				formula.SellerID = "@SUM(A1)"
+				return formula
+			}()),
+			exceptedStatusCode:  200,
+			exceptedContentType: "text/csv; charset=utf-8",
+			exceptedExtension:   ".csv",
+			exceptedBody: "id,article,price_for_one,number_of_units,amount,currency,date,seller_id,version,created_at,updated_at\n" +
+				"61f867172c75ef87b9f4d040,\"'=HYPERLINK(\"\"http://example.com\"\")\",2.5,4,10,EUR,2022-02-01T10:00:00Z,'@SUM(A1),1,2022-02-01T10:00:00Z,2022-02-01T10:00:00Z\n",
+		},
+		{
+			name: "Formula guard is optional",
+			role: usermodel.RoleAdmin,
+			path: "/api/v1/sale/export?formula_guard=false",
+			mockBehavior: exportSales(salemodel.ListFilter{Sort: "id"}, func() salemodel.Sale {
+				formula := sale
+				formula.Article = "-12-223-41-33"
+				return formula
+			}()),
+			exceptedStatusCode:  200,
+			exceptedContentType: "text/csv; charset=utf-8",
+			exceptedExtension:   ".csv",
+			exceptedBody: "id,article,price_for_one,number_of_units,amount,currency,date,seller_id,version,created_at,updated_at\n" +
+				"61f867172c75ef87b9f4d040,-12-223-41-33,2.5,4,10,EUR,2022-02-01T10:00:00Z,2,1,2022-02-01T10:00:00Z,2022-02-01T10:00:00Z\n",
+		},
+		{
+			name:               "Formula guard is not boolean",
+			role:               usermodel.RoleAdmin,
+			path:               "/api/v1/sale/export?formula_guard=maybe",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 400,
+		},
+		{
+			name: "XLSX keeps formulas as text without the guard",
+			role: usermodel.RoleAdmin,
+			path: "/api/v1/sale/export?format=xlsx",
+			mockBehavior: exportSales(salemodel.ListFilter{Sort: "id"}, func() salemodel.Sale {
+				formula := sale
+				formula.Article = "-12-223-41-33"
+				formula.SellerID = "=SUM(A1)"
+				return formula
+			}()),
+			exceptedStatusCode:  200,
+			exceptedContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			exceptedExtension:   ".xlsx",
+			exceptedBody: `<c r="B2" t="inlineStr"><is><t xml:space="preserve">-12-223-41-33</t></is></c>` +
+				`<c r="C2"><v>2.5</v></c><c r="D2"><v>4</v></c><c r="E2"><v>10</v></c>` +
+				`<c r="F2" t="inlineStr"><is><t xml:space="preserve">EUR</t></is></c>` +
+				`<c r="G2" t="inlineStr"><is><t xml:space="preserve">2022-02-01T10:00:00Z</t></is></c>` +
+				`<c r="H2" t="inlineStr"><is><t xml:space="preserve">=SUM(A1)</t></is></c>`,
+		},
+		{
+			name:                "Seller exports own sales as NDJSON",
+			role:                usermodel.RoleSeller,
+			path:                "/api/v1/sale/export?format=ndjson",
+			mockBehavior:        exportSales(salemodel.ListFilter{SellerID: "1", Sort: "id"}, sale, sale),
+			exceptedStatusCode:  200,
+			exceptedContentType: "application/x-ndjson",
+			exceptedExtension:   ".ndjson",
+			exceptedBody: `{"id":"61f867172c75ef87b9f4d040","article":"tea, green","price_for_one":"2.5","number_of_units":4,"amount":"10","currency":"EUR","date":"2022-02-01T10:00:00Z","seller_id":"2","version":1,"created_at":"2022-02-01T10:00:00Z","updated_at":"2022-02-01T10:00:00Z"}` + "\n" +
+				`{"id":"61f867172c75ef87b9f4d040","article":"tea, green","price_for_one":"2.5","number_of_units":4,"amount":"10","currency":"EUR","date":"2022-02-01T10:00:00Z","seller_id":"2","version":1,"created_at":"2022-02-01T10:00:00Z","updated_at":"2022-02-01T10:00:00Z"}` + "\n",
+		},
+		{
+			name:                "Empty XLSX",
+			role:                usermodel.RoleViewer,
+			path:                "/api/v1/sale/export?format=xlsx",
+			mockBehavior:        exportSales(salemodel.ListFilter{Sort: "id"}),
+			exceptedStatusCode:  200,
+			exceptedContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			exceptedExtension:   ".xlsx",
+		},
+		{
+			name:               "Unknown format",
+			role:               usermodel.RoleAdmin,
+			path:               "/api/v1/sale/export?format=pdf",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 400,
+		},
+		{
+			name:               "Seller can't export sales of others",
+			role:               usermodel.RoleSeller,
+			path:               "/api/v1/sale/export?seller_id=2",
+			mockBehavior:       func(storage *mock_service.MockSaleStorage) {},
+			exceptedStatusCode: 403,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			saleStorage := mock_service.NewMockSaleStorage(c)
+			testCase.mockBehavior(saleStorage)
+
+			revocationStorage := mock_service.NewMockRevocationStorage(c)
+			revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+			testHandler := NewHandler(testService, logging.GetLogger())
+
+			router := httprouter.New()
+			testHandler.RegisterRouting(router)
+
+			token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: testCase.role})
+			assert.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", testCase.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, testCase.exceptedStatusCode, recorder.Code)
+			if testCase.exceptedStatusCode != 200 {
+				return
+			}
+
+			assert.Equal(t, testCase.exceptedContentType, recorder.Header().Get("Content-Type"))
+
+			_, params, err := mime.ParseMediaType(recorder.Header().Get("Content-Disposition"))
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(params["filename"], "sales-"))
+			assert.True(t, strings.HasSuffix(params["filename"], testCase.exceptedExtension))
+
+			if testCase.exceptedExtension == ".xlsx" {
+				archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+				require.NoError(t, err)
+
+				file, err := archive.Open("xl/worksheets/sheet1.xml")
+				require.NoError(t, err)
+				defer file.Close()
+
+				sheet, err := io.ReadAll(file)
+				require.NoError(t, err)
+				assert.Contains(t, string(sheet), testCase.exceptedBody)
+				return
+			}
+
+			assert.Equal(t, testCase.exceptedBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_SaleExportStream(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	const count = 2000
+
+	saleStorage := mock_service.NewMockSaleStorage(c)
+	saleStorage.EXPECT().Export(gomock.Any(), salemodel.ListFilter{Sort: "id"}, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ salemodel.ListFilter, each func(sale salemodel.Sale) error) error {
+			for i := 0; i < count; i++ {
+				// the export takes longer than the write timeout of the server
+				if i == count/2 {
+					time.Sleep(300 * time.Millisecond)
+				}
+
+				err := each(salemodel.Sale{ID: fmt.Sprintf("%024d", i), Article: "12-223-41-33", NumberOfUnits: 1,
+					Currency: "USD", SellerID: "1", Version: 1})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	revocationStorage := mock_service.NewMockRevocationStorage(c)
+	revocationStorage.EXPECT().GetByUser(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	testService := newTestService(testDeps{sales: saleStorage, revocations: revocationStorage})
+	testHandler := NewHandler(testService, logging.GetLogger())
+
+	router := httprouter.New()
+	testHandler.RegisterRouting(router)
+
+	testServer := httptest.NewUnstartedServer(router)
+	testServer.Config.WriteTimeout = 200 * time.Millisecond
+	testServer.Config.ConnContext = server.ConnContext
+	testServer.Start()
+	defer testServer.Close()
+
+	token, err := testService.GenerateToken(service.Identity{UserID: "1", Role: usermodel.RoleAdmin})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("GET", testServer.URL+"/api/v1/sale/export?format=ndjson", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := testServer.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// the sales are many times more than the buffer of the response, so they are flushed many times
+	assert.Greater(t, len(body), 100*1024)
+	assert.Equal(t, count, bytes.Count(body, []byte("\n")))
 }
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"mime"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/service"
+	"nprn/pkg/money"
+	"nprn/pkg/server"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// importFields are the fields of a sale which are read from CSV
+var importFields = []string{"article", "price_for_one", "number_of_units", "amount", "currency", "date", "seller_id"}
+
+type importRowResponse struct {
+	Line   int                    `json:"line"`
+	Status string                 `json:"status"`
+	ID     string                 `json:"id,omitempty"`
+	Errors []customerr.FieldError `json:"errors,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+type importBatchResponse struct {
+	FirstLine int `json:"first_line"`
+	LastLine  int `json:"last_line"`
+	Rows      int `json:"rows"`
+	Stored    int `json:"stored"`
+}
+
+type importResponse struct {
+	DryRun   bool                  `json:"dry_run"`
+	Total    int                   `json:"total"`
+	Accepted int                   `json:"accepted"`
+	Rejected int                   `json:"rejected"`
+	Rows     []importRowResponse   `json:"rows"`
+	Batches  []importBatchResponse `json:"batches,omitempty"`
+}
+
+const (
+	// importTimeout and importRowTimeout for every row limit the import
+	importTimeout    = 10 * time.Second
+	importRowTimeout = 5 * time.Millisecond
+)
+
+// SaleAction serves POST /api/v1/sale/import, httprouter doesn't allow a static segment next to :id
+func (h *Handler) SaleAction(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if params.ByName("id") == "import" {
+		return h.ImportSales(w, r, params)
+	}
+
+	return customerr.NotFoundErr
+}
+
+// ImportSales takes CSV with a header (text/csv) or a sale per line (application/x-ndjson),
+// ?dry_run=true only validates the rows and ?columns=article:Item,price_for_one:Price maps CSV columns
+func (h *Handler) ImportSales(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	cfg := h.service.Config.Sales.Import
+	query := r.URL.Query()
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			return customerr.NewCustomError(customerr.BadRequest, "dry_run has to be true or false")
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	defer r.Body.Close()
+
+	body := io.Reader(r.Body)
+	if cfg.MaxSize > 0 {
+		body = &sizeLimit{reader: r.Body, limit: cfg.MaxSize, left: cfg.MaxSize + 1}
+	}
+
+	var rows []service.ImportRow
+
+	switch mediaType {
+	case "text/csv":
+		columns, err := importColumns(cfg.Columns, query.Get("columns"))
+		if err != nil {
+			return err
+		}
+
+		delimiter, _ := utf8.DecodeRuneInString(cfg.Delimiter)
+
+		rows, err = readCSV(body, delimiter, columns, cfg.MaxRows)
+		if err != nil {
+			return err
+		}
+	case "application/x-ndjson", "application/ndjson":
+		rows, err = readNDJSON(body, cfg.MaxRows)
+		if err != nil {
+			return err
+		}
+	default:
+		return customerr.NewCustomError(customerr.UnsupportedMediaType,
+			"content type has to be text/csv or application/x-ndjson")
+	}
+
+	// the response is written after all rows, so the write deadline of the server is moved too
+	timeout := importTimeout + time.Duration(len(rows))*importRowTimeout
+
+	err = server.SetWriteDeadline(r.Context(), time.Now().Add(timeout+server.WriteTimeout))
+	if err != nil {
+		h.logger.Warn(err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	report, err := h.service.ImportSales(ctx, rows, dryRun)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	response := importResponse{DryRun: report.DryRun, Total: len(report.Rows), Accepted: report.Accepted,
+		Rejected: report.Rejected, Rows: make([]importRowResponse, 0, len(report.Rows))}
+
+	for _, batch := range report.Batches {
+		response.Batches = append(response.Batches, importBatchResponse{FirstLine: batch.FirstLine,
+			LastLine: batch.LastLine, Rows: batch.Rows, Stored: batch.Stored})
+	}
+
+	for _, row := range report.Rows {
+		status := "rejected"
+		if row.Accepted {
+			status = "accepted"
+		}
+
+		response.Rows = append(response.Rows, importRowResponse{Line: row.Line, Status: status, ID: row.ID,
+			Errors: row.Errors, Error: row.Error})
+	}
+
+	return writeJSON(w, 200, response)
+}
+
+// importColumns maps the fields to the CSV columns, the mapping of the request is added to the configured one
+func importColumns(configured map[string]string, value string) (map[string]string, error) {
+	columns := make(map[string]string, len(importFields))
+	for _, field := range importFields {
+		columns[field] = field
+	}
+
+	for field, column := range configured {
+		columns[field] = column
+	}
+
+	if value == "" {
+		return columns, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		if _, known := columns[parts[0]]; len(parts) != 2 || !known || parts[1] == "" {
+			return nil, customerr.NewCustomError(customerr.BadRequest,
+				fmt.Sprintf("column mapping %q has to be field:column with a field of a sale", pair))
+		}
+
+		columns[parts[0]] = parts[1]
+	}
+
+	return columns, nil
+}
+
+func readCSV(body io.Reader, delimiter rune, columns map[string]string, maxRows int) ([]service.ImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.Comma = delimiter
+	reader.TrimLeadingSpace = true
+	// the missing fields of a short row are empty
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, importReadError("CSV", err)
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		positions[strings.TrimSpace(name)] = i
+	}
+
+	for field, column := range columns {
+		if _, ok := positions[column]; !ok && column != field {
+			return nil, customerr.NewCustomError(customerr.BadRequest, fmt.Sprintf("column %q is not in CSV header", column))
+		}
+	}
+
+	var rows []service.ImportRow
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, importReadError("CSV", err)
+		}
+
+		if maxRows > 0 && len(rows) == maxRows {
+			return nil, customerr.NewCustomError(customerr.BadRequest, fmt.Sprintf("import can't have more than %d rows", maxRows))
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		// the text exported with the formula guard is imported as it was
+		value := func(field string) string {
+			if i, ok := positions[columns[field]]; ok && i < len(record) {
+				return unguardFormula(strings.TrimSpace(record[i]))
+			}
+			return ""
+		}
+
+		rows = append(rows, csvRow(line, value))
+	}
+
+	return rows, nil
+}
+
+// csvRow reads the fields of a sale, an empty number is not sent
+func csvRow(line int, value func(field string) string) service.ImportRow {
+	row := service.ImportRow{Line: line, Date: value("date")}
+
+	invalid := func(field string, message string) {
+		row.Errors = append(row.Errors, customerr.FieldError{Field: field, Message: message})
+	}
+
+	row.Sale.Article = value("article")
+	row.Sale.Currency = value("currency")
+	row.Sale.SellerID = value("seller_id")
+
+	for field, target := range map[string]*money.Decimal{"price_for_one": &row.Sale.PriceForOne, "amount": &row.Sale.Amount} {
+		if text := value(field); text != "" {
+			decimal, err := money.Parse(text)
+			if err != nil {
+				invalid(field, field+" is not a decimal number")
+			}
+
+			*target = decimal
+		}
+	}
+
+	if text := value("number_of_units"); text != "" {
+		units, err := strconv.Atoi(text)
+		if err != nil {
+			invalid("number_of_units", "number_of_units is not a number")
+		}
+
+		row.Sale.NumberOfUnits = units
+	}
+
+	return row
+}
+
+// readNDJSON reads a sale per line like the body of POST /api/v1/sale/, empty lines are skipped
+func readNDJSON(body io.Reader, maxRows int) ([]service.ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+
+	var rows []service.ImportRow
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if maxRows > 0 && len(rows) == maxRows {
+			return nil, customerr.NewCustomError(customerr.BadRequest, fmt.Sprintf("import can't have more than %d rows", maxRows))
+		}
+
+		row := service.ImportRow{Line: line}
+
+		var sale saleRequest
+
+		err := json.Unmarshal([]byte(text), &sale)
+		if err != nil {
+			row.Error = "line is not a valid sale: " + err.Error()
+		}
+
+		row.Sale = sale.Sale
+		row.Date = sale.Date
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, importReadError("NDJSON", err)
+	}
+
+	return rows, nil
+}
+
+// sizeLimit fails the reading of more than limit bytes, unlike io.LimitReader the body isn't silently cut
+type sizeLimit struct {
+	reader io.Reader
+	limit  int64
+	left   int64
+}
+
+type sizeLimitError struct {
+	limit int64
+}
+
+func (e *sizeLimitError) Error() string {
+	return fmt.Sprintf("import is larger than %d bytes", e.limit)
+}
+
+func (l *sizeLimit) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+
+	n, err := l.reader.Read(p)
+	l.left -= int64(n)
+
+	if l.left <= 0 {
+		return n, &sizeLimitError{limit: l.limit}
+	}
+
+	return n, err
+}
+
+func importReadError(format string, err error) error {
+	var tooLarge *sizeLimitError
+	if errors.As(err, &tooLarge) {
+		return customerr.NewCustomError(customerr.BadRequest, tooLarge.Error())
+	}
+
+	return customerr.NewCustomError(customerr.BadRequest, fmt.Sprintf("%s is not valid: %v", format, err))
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"github.com/julienschmidt/httprouter"
+	"net"
+	"net/http"
+	"nprn/internal/customerr"
+	"time"
+)
+
+// UnlockUser lets the user sign in again before the lockout is over
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.UnlockUser(ctx, params.ByName("id"))
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// UnlockAddress lets sign-ins from the address again before the lockout is over
+func (h *Handler) UnlockAddress(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ip := net.ParseIP(params.ByName("ip"))
+	if ip == nil {
+		return customerr.NewCustomError(customerr.BadRequest, "ip address is not valid")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.UnlockAddress(ctx, ip.String())
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
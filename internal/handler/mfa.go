@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/service"
+	"time"
+)
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type signInMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	// QRCode is a data URI of a PNG image
+	QRCode string `json:"qr_code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func writeMFAChallenge(w http.ResponseWriter, result service.SignInResult) error {
+	return writeJSON(w, 200, mfaChallengeResponse{
+		MFARequired: true,
+		MFAToken:    result.MFAToken,
+		ExpiresIn:   int64(result.MFAExpiresIn.Seconds()),
+	})
+}
+
+// SignInMFA is the second step of sign-in for users with the second factor
+func (h *Handler) SignInMFA(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var mfaReq signInMFARequest
+
+	err := json.NewDecoder(r.Body).Decode(&mfaReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := h.service.SignInMFA(ctx, mfaReq.MFAToken, mfaReq.Code)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeTokens(w, tokens)
+}
+
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	enrollment, err := h.service.EnrollTOTP(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, totpEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	})
+}
+
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var codeReq mfaCodeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	codes, err := h.service.ConfirmTOTP(ctx, codeReq.Code)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var codeReq mfaCodeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = h.service.DisableTOTP(ctx, codeReq.Code)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var codeReq mfaCodeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&codeReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	codes, err := h.service.RegenerateRecoveryCodes(ctx, codeReq.Code)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, recoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"net"
 	"net/http"
 	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/service"
+	"strconv"
 	"strings"
 )
 
@@ -16,13 +20,19 @@ type authError struct {
 
 type CustomHandlerFunc func(w http.ResponseWriter, r *http.Request, params httprouter.Params) error
 
-func (h *Handler) CheckAuthorizationMiddleware(handlerFunc CustomHandlerFunc) httprouter.Handle {
+func (h *Handler) CheckAuthorizationMiddleware(permission service.Permission, handlerFunc CustomHandlerFunc) httprouter.Handle {
 
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
 
+		r = h.withClient(r)
+
 		header := r.Header.Get("Authorization")
+		if apiKey := r.Header.Get("X-API-Key"); len(apiKey) != 0 {
+			header = "ApiKey " + apiKey
+		}
+
 		if len(header) == 0 {
 
 			authErr := authError{
@@ -41,7 +51,7 @@ func (h *Handler) CheckAuthorizationMiddleware(handlerFunc CustomHandlerFunc) ht
 
 		parts := strings.Split(header, " ")
 
-		if len(parts) != 2 || parts[0] != "Bearer" || len(parts[1]) == 0 {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") || len(parts[1]) == 0 {
 			authErr := authError{
 				Message: "unauthorized",
 			}
@@ -56,9 +66,22 @@ func (h *Handler) CheckAuthorizationMiddleware(handlerFunc CustomHandlerFunc) ht
 			return
 		}
 
-		userID, err := h.service.ParseToken(parts[1])
+		var identity service.Identity
+		var err error
+
+		if parts[0] == "ApiKey" {
+			identity, err = h.service.AuthenticateAPIKey(r.Context(), parts[1])
+		} else {
+			identity, err = h.service.Authenticate(r.Context(), parts[1])
+		}
 
 		if err != nil {
+			h.service.Audit(r.Context(), auditmodel.Event{
+				Type:    auditmodel.TypeTokenRejected,
+				Outcome: auditmodel.OutcomeFailure,
+				Reason:  fmt.Sprintf("%s: %v", strings.ToLower(parts[0]), err),
+			})
+
 			authErr := authError{
 				Message: "unauthorized: not valid token",
 			}
@@ -73,6 +96,29 @@ func (h *Handler) CheckAuthorizationMiddleware(handlerFunc CustomHandlerFunc) ht
 			return
 		}
 
+		r = r.WithContext(service.WithIdentity(r.Context(), identity))
+
+		// the token id or the api key id is taken from the identity, only the first use is recorded
+		h.service.AuditTokenAccepted(r.Context(), auditmodel.Event{
+			Type:    auditmodel.TypeTokenAccepted,
+			Outcome: auditmodel.OutcomeSuccess,
+			Reason:  strings.ToLower(parts[0]),
+			Details: r.Method + " " + r.URL.Path,
+		})
+
+		err = h.service.Authorize(identity, permission)
+		if err != nil {
+			h.logger.Infof("user with id=%v and role=%v has no permission %v: %v", identity.UserID, identity.Role, permission, err)
+			h.service.Audit(r.Context(), auditmodel.Event{
+				Type:    auditmodel.TypeAccessDenied,
+				Outcome: auditmodel.OutcomeFailure,
+				Reason:  err.Error(),
+				Details: r.Method + " " + r.URL.Path,
+			})
+			checkCustomError(err, w)
+			return
+		}
+
 		err = handlerFunc(w, r, params)
 		if err != nil {
 			h.logger.Info(err)
@@ -80,7 +126,7 @@ func (h *Handler) CheckAuthorizationMiddleware(handlerFunc CustomHandlerFunc) ht
 			return
 		}
 
-		h.logger.Logger.Info(fmt.Sprintf("user with id=%v is accepted", userID))
+		h.logger.Logger.Info(fmt.Sprintf("user with id=%v is accepted", identity.UserID))
 	}
 }
 
@@ -90,7 +136,7 @@ func (h *Handler) CheckErrorMiddleware(handlerFunc CustomHandlerFunc) httprouter
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
 
-		err := handlerFunc(w, r, params)
+		err := handlerFunc(w, h.withClient(r), params)
 		if err != nil {
 			h.logger.Info(err)
 			checkCustomError(err, w)
@@ -110,6 +156,13 @@ func checkCustomError(err error, w http.ResponseWriter) {
 				ce := err.(*customerr.CustomError)
 				w.Write(ce.Marshal())
 
+			} else if errors.Is(err, customerr.BadRequest) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(400)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
 			} else if errors.Is(err, customerr.NotAcceptable) {
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(406)
@@ -117,6 +170,66 @@ func checkCustomError(err error, w http.ResponseWriter) {
 				ce := err.(*customerr.CustomError)
 				w.Write(ce.Marshal())
 
+			} else if errors.Is(err, customerr.Unauthorized) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(401)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.Forbidden) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(403)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.Conflict) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(409)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.Unprocessable) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(422)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.UnsupportedMediaType) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(415)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.PreconditionFailed) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(412)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.PreconditionRequired) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(428)
+
+				ce := err.(*customerr.CustomError)
+				w.Write(ce.Marshal())
+
+			} else if errors.Is(err, customerr.TooManyRequests) {
+				ce := err.(*customerr.CustomError)
+
+				w.Header().Set("Content-Type", "application/json")
+				if ce.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.FormatInt(ce.RetryAfter, 10))
+				}
+				w.WriteHeader(429)
+
+				w.Write(ce.Marshal())
+
 			} else {
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(418)
@@ -127,3 +240,39 @@ func checkCustomError(err error, w http.ResponseWriter) {
 		}
 	}
 }
+
+// withClient passes the address and the user agent of the caller to the service for the audit log
+func (h *Handler) withClient(r *http.Request) *http.Request {
+	return r.WithContext(service.WithClient(r.Context(), service.Client{IP: h.clientIP(r), UserAgent: r.UserAgent()}))
+}
+
+// clientIP is the address of the caller, X-Forwarded-For is used only behind a trusted proxy.
+// The client can send X-Forwarded-For itself, so the address is counted from the right by listen.proxy_hops.
+func (h *Handler) clientIP(r *http.Request) string {
+	cfg := h.service.Config.Listen
+
+	if cfg.TrustProxy {
+		var addresses []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			addresses = append(addresses, strings.Split(header, ",")...)
+		}
+
+		hops := cfg.ProxyHops
+		if hops < 1 {
+			hops = 1
+		}
+
+		if len(addresses) >= hops {
+			if address := strings.TrimSpace(addresses[len(addresses)-hops]); address != "" {
+				return address
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
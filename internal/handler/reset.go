@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"time"
+)
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPassword answers 202 for any valid email, the link is sent only if the user exists
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var forgotReq forgotPasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&forgotReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	err = h.service.ForgotPassword(r.Context(), forgotReq.Email)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(202)
+
+	return nil
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var resetReq resetPasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&resetReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = h.service.ResetPassword(ctx, resetReq.Token, resetReq.Password)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
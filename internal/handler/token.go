@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"nprn/internal/customerr"
+	"time"
+)
+
+type revokeTokensRequest struct {
+	Before time.Time `json:"before"`
+}
+
+// RevokeToken revokes the access token of the request
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.RevokeToken(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// LogoutAll revokes all tokens of the caller on every device
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.service.LogoutAll(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// RevokeUserTokens revokes tokens of any user issued before the time from body (or now if body is empty)
+func (h *Handler) RevokeUserTokens(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	var revokeReq revokeTokensRequest
+
+	err := json.NewDecoder(r.Body).Decode(&revokeReq)
+	if err != nil && err != io.EOF {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = h.service.RevokeUserTokens(ctx, params.ByName("id"), revokeReq.Before)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
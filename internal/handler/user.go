@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"nprn/internal/service"
+	"time"
+)
+
+type updateMeRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	TimeZone *string `json:"time_zone"`
+}
+
+type deleteMeRequest struct {
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// GetMe returns the user of the token
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.service.GetMe(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, user)
+}
+
+// UpdateMe changes only the fields which are sent
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var updateReq updateMeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&updateReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := h.service.UpdateMe(ctx, service.UserUpdate{Username: updateReq.Username, Email: updateReq.Email,
+		TimeZone: updateReq.TimeZone})
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	return writeJSON(w, 200, user)
+}
+
+// DeleteMe deletes the account, the password is required
+func (h *Handler) DeleteMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var deleteReq deleteMeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&deleteReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = h.service.DeleteMe(ctx, deleteReq.Password)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var passwordReq changePasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&passwordReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = h.service.ChangePassword(ctx, passwordReq.CurrentPassword, passwordReq.NewPassword)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"nprn/internal/customerr"
+	"time"
+)
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail takes the token from the link sent after sign-up
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	var verifyReq verifyEmailRequest
+
+	err := json.NewDecoder(r.Body).Decode(&verifyReq)
+	if err != nil {
+		return customerr.NewCustomError(err, "error with decode body")
+	}
+
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = h.service.VerifyEmail(ctx, verifyReq.Token)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(204)
+
+	return nil
+}
+
+// ResendVerification sends a new verification link to the signed-in user
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := h.service.ResendVerification(ctx)
+	if err != nil {
+		h.logger.Info(err)
+		return err
+	}
+
+	w.WriteHeader(202)
+
+	return nil
+}
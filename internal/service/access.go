@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/user/usermodel"
+	"strings"
+	"time"
+)
+
+type Permission string
+
+const (
+	// PermissionAuthenticated is granted to every signed-in user
+	PermissionAuthenticated Permission = ""
+
+	PermissionUserManage Permission = "user:manage"
+	PermissionAuditRead  Permission = "audit:read"
+
+	PermissionSaleRead   Permission = "sale:read"
+	PermissionSaleCreate Permission = "sale:create"
+	PermissionSaleUpdate Permission = "sale:update"
+	PermissionSaleDelete Permission = "sale:delete"
+
+	// PermissionSaleReadAny and PermissionSaleWriteAny allow access to sales of other sellers
+	PermissionSaleReadAny  Permission = "sale:read:any"
+	PermissionSaleWriteAny Permission = "sale:write:any"
+)
+
+var rolePermissions = map[string][]Permission{
+	usermodel.RoleAdmin: {PermissionUserManage, PermissionAuditRead, PermissionSaleRead, PermissionSaleCreate, PermissionSaleUpdate, PermissionSaleDelete,
+		PermissionSaleReadAny, PermissionSaleWriteAny},
+	usermodel.RoleManager: {PermissionSaleRead, PermissionSaleCreate, PermissionSaleUpdate,
+		PermissionSaleReadAny, PermissionSaleWriteAny},
+	usermodel.RoleSeller: {PermissionSaleRead, PermissionSaleCreate, PermissionSaleUpdate},
+	usermodel.RoleViewer: {PermissionSaleRead, PermissionSaleReadAny},
+}
+
+type identityKey struct{}
+
+// Identity is the authenticated caller taken from the access token or the api key
+type Identity struct {
+	UserID    string
+	Role      string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	EmailVerified bool
+	MFA           bool
+
+	// APIKeyID is set for machine clients, they are limited by Scopes and can't use session endpoints
+	APIKeyID string
+	Scopes   []Permission
+}
+
+func (i Identity) Can(permission Permission) bool {
+	if i.APIKeyID != "" && !hasPermission(i.Scopes, permission) {
+		return false
+	}
+
+	if permission == PermissionAuthenticated {
+		return true
+	}
+
+	return hasPermission(rolePermissions[i.Role], permission)
+}
+
+func hasPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks the permission of the caller. Roles from mfa.required_roles need a session
+// with the second factor, with verification.required the sales API needs a verified email.
+func (s *Service) Authorize(identity Identity, permission Permission) error {
+	if !identity.Can(permission) {
+		return customerr.Forbidden
+	}
+
+	if permission != PermissionAuthenticated && s.mfaRequired(identity) {
+		return errMFARequired
+	}
+
+	if s.Config.Verification.Required && !identity.EmailVerified && strings.HasPrefix(string(permission), "sale:") {
+		return customerr.NewCustomError(customerr.Forbidden, "forbidden: email is not verified")
+	}
+
+	return nil
+}
+
+// WithIdentity is used by the authorization middleware to pass the caller to the service
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// identityOf is the identity of a user who has just signed in
+func identityOf(user usermodel.UserInternal) Identity {
+	return Identity{UserID: user.ID, Role: roleOf(user), EmailVerified: user.EmailVerified}
+}
+
+// roleOf treats users created before roles were introduced as sellers
+func roleOf(user usermodel.UserInternal) string {
+	if user.Role == "" {
+		return usermodel.RoleSeller
+	}
+	return user.Role
+}
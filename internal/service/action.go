@@ -0,0 +1,57 @@
+package service
+
+import (
+	"github.com/golang-jwt/jwt"
+	"time"
+)
+
+// actionClaims are claims of tokens sent in links. They are signed with the same keys as access tokens,
+// but have no user_id, so ParseToken never accepts them.
+type actionClaims struct {
+	jwt.StandardClaims
+	Purpose string `json:"purpose"`
+	// Binding is a hash of the state the token is made for, e.g. the email being verified,
+	// the token stops working when the state changes, which makes it single-use
+	Binding string `json:"binding,omitempty"`
+}
+
+func (s *Service) signActionToken(purpose string, userID string, binding string, ttl time.Duration) (string, error) {
+	tokenID, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	return s.Keys.Sign(&actionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Subject:   userID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Purpose: purpose,
+		Binding: binding,
+	})
+}
+
+// parseActionToken checks the signature, the expiration and the purpose of the token
+func (s *Service) parseActionToken(token string, purpose string) (actionClaims, bool) {
+	var claims actionClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, s.Keys.Keyfunc)
+	if err != nil {
+		s.Logger.Info(err)
+		return actionClaims{}, false
+	}
+
+	if claims.Purpose != purpose || claims.Subject == "" {
+		return actionClaims{}, false
+	}
+
+	return claims, true
+}
+
+func bindingOf(state string) string {
+	return hashToken(state)
+}
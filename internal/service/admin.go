@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/user/usermodel"
+	"time"
+)
+
+const (
+	defaultUsersLimit = 20
+	maxUsersLimit     = 100
+)
+
+var (
+	errAccountDisabled   = customerr.NewCustomError(customerr.Forbidden, "forbidden: account is disabled")
+	errMustResetPassword = customerr.NewCustomError(customerr.Forbidden,
+		"forbidden: password has to be reset, the link was sent by email")
+	errSelfManagement = customerr.NewCustomError(customerr.BadRequest, "admins can't change their own account here")
+)
+
+// UserSummary is a user as admins see it
+type UserSummary struct {
+	User              usermodel.UserTransfer
+	Disabled          bool
+	MustResetPassword bool
+	SaleCount         int64
+}
+
+// UserPage is one page of ListUsers, Total is the number of all matching users
+type UserPage struct {
+	Users []UserSummary
+	Total int64
+	Page  int64
+	Limit int64
+}
+
+// ListUsers returns users sorted by username, page starts from 1
+func (s *Service) ListUsers(ctx context.Context, search string, role string, page int64, limit int64) (UserPage, error) {
+	if role != "" && !usermodel.IsValidRole(role) {
+		return UserPage{}, customerr.NewCustomError(customerr.BadRequest, "role is not valid")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = defaultUsersLimit
+	}
+
+	if limit > maxUsersLimit {
+		limit = maxUsersLimit
+	}
+
+	users, total, err := s.UserStorage.List(ctx, usermodel.ListFilter{
+		Search: search,
+		Role:   role,
+		Skip:   (page - 1) * limit,
+		Limit:  limit,
+	})
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	counts := map[string]int64{}
+
+	if len(ids) != 0 {
+		counts, err = s.SaleStorage.CountBySeller(ctx, ids)
+		if err != nil {
+			return UserPage{}, err
+		}
+	}
+
+	summaries := make([]UserSummary, 0, len(users))
+	for _, user := range users {
+		summaries = append(summaries, newUserSummary(user, counts[user.ID]))
+	}
+
+	return UserPage{Users: summaries, Total: total, Page: page, Limit: limit}, nil
+}
+
+func (s *Service) GetUser(ctx context.Context, userID string) (UserSummary, error) {
+	user, err := s.UserStorage.GetByID(ctx, userID)
+	if err != nil {
+		s.Logger.Info(err)
+		return UserSummary{}, customerr.NotFoundErr
+	}
+
+	counts, err := s.SaleStorage.CountBySeller(ctx, []string{user.ID})
+	if err != nil {
+		return UserSummary{}, err
+	}
+
+	return newUserSummary(user, counts[user.ID]), nil
+}
+
+func newUserSummary(user usermodel.UserInternal, saleCount int64) UserSummary {
+	user.Role = roleOf(user)
+
+	return UserSummary{
+		User:              usermodel.NewUserTransfer(user),
+		Disabled:          user.Disabled,
+		MustResetPassword: user.MustResetPassword,
+		SaleCount:         saleCount,
+	}
+}
+
+// DisableUser blocks sign-in and revokes all tokens, so the user is signed out at once
+func (s *Service) DisableUser(ctx context.Context, userID string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeUserDisabled, TargetID: userID}, err) }()
+
+	user, err := s.managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.SetDisabled(ctx, user.ID, true)
+	if err != nil {
+		return err
+	}
+
+	err = s.RevokeAllTokens(ctx, user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("user id=%s is disabled", user.ID)
+
+	return nil
+}
+
+func (s *Service) EnableUser(ctx context.Context, userID string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeUserEnabled, TargetID: userID}, err) }()
+
+	user, err := s.managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.SetDisabled(ctx, user.ID, false)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("user id=%s is enabled", user.ID)
+
+	return nil
+}
+
+// ChangeRole revokes only access tokens, the role is read again when they are refreshed
+func (s *Service) ChangeRole(ctx context.Context, userID string, role string) (err error) {
+	defer func() {
+		s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeRoleChanged, TargetID: userID, Details: role}, err)
+	}()
+
+	if !usermodel.IsValidRole(role) {
+		return customerr.NewCustomError(customerr.BadRequest, "role is not valid")
+	}
+
+	user, err := s.managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if roleOf(user) == role {
+		return nil
+	}
+
+	err = s.UserStorage.UpdateRole(ctx, user.ID, role)
+	if err != nil {
+		return err
+	}
+
+	err = s.revokeAccessTokens(ctx, user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("role of user id=%s is changed from %s to %s", user.ID, roleOf(user), role)
+
+	return nil
+}
+
+// ForcePasswordReset makes the current password useless and mails a reset link,
+// it is used when the password is known to be compromised
+func (s *Service) ForcePasswordReset(ctx context.Context, userID string) (err error) {
+	defer func() {
+		s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypePasswordResetForced, TargetID: userID}, err)
+	}()
+
+	user, err := s.managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.SetMustResetPassword(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.RevokeAllTokens(ctx, user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("password reset is forced for user id=%s", user.ID)
+
+	return s.mailResetLink(ctx, user)
+}
+
+// managedUser is the user an admin changes, admins can't lock themselves out
+func (s *Service) managedUser(ctx context.Context, userID string) (usermodel.UserInternal, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return usermodel.UserInternal{}, customerr.Unauthorized
+	}
+
+	if identity.UserID == userID {
+		return usermodel.UserInternal{}, errSelfManagement
+	}
+
+	user, err := s.UserStorage.GetByID(ctx, userID)
+	if err != nil {
+		s.Logger.Info(err)
+		return usermodel.UserInternal{}, customerr.NotFoundErr
+	}
+
+	return user, nil
+}
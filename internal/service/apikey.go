@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/apikey/apikeymodel"
+	"nprn/internal/entity/audit/auditmodel"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix = "nprn_"
+	// lastUsedPrecision limits writes to mongo for keys used by every request of a job
+	lastUsedPrecision = time.Minute
+)
+
+// CreateAPIKey returns the key itself, it is shown only once and only its hash is stored
+func (s *Service) CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (string, apikeymodel.APIKey, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return "", apikeymodel.APIKey{}, customerr.Unauthorized
+	}
+
+	// otherwise a key would be a way around the second factor
+	if s.mfaRequired(identity) {
+		return "", apikeymodel.APIKey{}, errMFARequired
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return "", apikeymodel.APIKey{}, customerr.NewCustomError(customerr.BadRequest, "name of api key is required")
+	}
+
+	if len(scopes) == 0 {
+		return "", apikeymodel.APIKey{}, customerr.NewCustomError(customerr.BadRequest, "scopes of api key are required")
+	}
+
+	for _, scope := range scopes {
+		if scope == string(PermissionAuthenticated) || !identity.Can(Permission(scope)) {
+			return "", apikeymodel.APIKey{}, customerr.NewCustomError(customerr.BadRequest,
+				"scope "+scope+" is unknown or not allowed for your role")
+		}
+	}
+
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return "", apikeymodel.APIKey{}, customerr.NewCustomError(customerr.BadRequest, "expires_at is in the past")
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return "", apikeymodel.APIKey{}, err
+	}
+
+	key := apiKeyPrefix + secret
+
+	apiKey := apikeymodel.APIKey{
+		UserID:    identity.UserID,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Hash:      hashToken(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	apiKey.ID, err = s.APIKeyStorage.Create(ctx, apiKey)
+	if err != nil {
+		return "", apikeymodel.APIKey{}, err
+	}
+
+	s.Audit(ctx, auditmodel.Event{Type: auditmodel.TypeAPIKeyCreated, Outcome: auditmodel.OutcomeSuccess, Details: apiKey.ID})
+
+	return key, apiKey, nil
+}
+
+func (s *Service) GetAPIKeys(ctx context.Context) ([]apikeymodel.APIKey, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return nil, customerr.Unauthorized
+	}
+
+	return s.APIKeyStorage.GetByUser(ctx, identity.UserID)
+}
+
+func (s *Service) RevokeAPIKey(ctx context.Context, id string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeAPIKeyRevoked, Details: id}, err) }()
+
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return customerr.Unauthorized
+	}
+
+	revoked, err := s.APIKeyStorage.Revoke(ctx, id, identity.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return customerr.NotFoundErr
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey returns the identity of the key owner limited by the key scopes
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (Identity, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return Identity{}, customerr.Unauthorized
+	}
+
+	apiKey, err := s.APIKeyStorage.GetByHash(ctx, hashToken(key))
+	if err != nil {
+		s.Logger.Info(err)
+		return Identity{}, customerr.Unauthorized
+	}
+
+	now := time.Now()
+
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return Identity{}, customerr.Unauthorized
+	}
+
+	user, err := s.UserStorage.GetByID(ctx, apiKey.UserID)
+	if err != nil {
+		s.Logger.Info(err)
+		return Identity{}, customerr.Unauthorized
+	}
+
+	// api keys are not revoked with the account, so the state is checked on every request
+	if user.Disabled {
+		return Identity{}, customerr.Unauthorized
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedPrecision {
+		err = s.APIKeyStorage.UpdateLastUsed(ctx, apiKey.ID, now.UTC())
+		if err != nil {
+			s.Logger.Error(err)
+		}
+	}
+
+	scopes := make([]Permission, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		scopes = append(scopes, Permission(scope))
+	}
+
+	return Identity{
+		UserID:        user.ID,
+		Role:          roleOf(user),
+		EmailVerified: user.EmailVerified,
+		APIKeyID:      apiKey.ID,
+		Scopes:        scopes,
+	}, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+
+	// apiKeyAuditInterval is how often a use of an api key is recorded, keys don't expire like access tokens
+	apiKeyAuditInterval = time.Hour
+)
+
+type clientKey struct{}
+
+// Client is the caller as the network sees it, it is written to the audit log
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// WithClient is used by the middlewares for every request
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFromContext(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// AuditPage is one page of ListAudit, Total is the number of all matching events
+type AuditPage struct {
+	Events []auditmodel.Event
+	Total  int64
+	Page   int64
+	Limit  int64
+}
+
+// Audit appends the event to the audit log. The time, the client and the caller are taken from the context
+// if they are not set. The log doesn't fail the request, errors are only logged.
+func (s *Service) Audit(ctx context.Context, event auditmodel.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	client := clientFromContext(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+
+	if identity, ok := IdentityFromContext(ctx); ok {
+		if event.UserID == "" {
+			event.UserID = identity.UserID
+		}
+		if event.TokenID == "" {
+			event.TokenID = identity.TokenID
+		}
+		if event.APIKeyID == "" {
+			event.APIKeyID = identity.APIKeyID
+		}
+	}
+
+	_, err := s.AuditStorage.Create(ctx, event)
+	if err != nil {
+		s.Logger.Errorf("failed to audit %s of user id=%s: %v", event.Type, event.UserID, err)
+	}
+}
+
+// tokenUses keeps the access tokens and api keys whose use is already recorded by this instance,
+// an entry is removed when the token expires
+type tokenUses struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newTokenUses() *tokenUses {
+	return &tokenUses{seen: make(map[string]time.Time)}
+}
+
+// first returns true if the key is not seen before or its entry is expired, the key is kept until the time
+func (u *tokenUses) first(key string, until time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+
+	if expiresAt, ok := u.seen[key]; ok && now.Before(expiresAt) {
+		return false
+	}
+
+	for k, expiresAt := range u.seen {
+		if !now.Before(expiresAt) {
+			delete(u.seen, k)
+		}
+	}
+
+	u.seen[key] = until
+
+	return true
+}
+
+// AuditTokenAccepted records the first use of the access token of the caller, an api key is recorded
+// once per apiKeyAuditInterval. Writing every request would double the load of mongo for nothing,
+// rejected tokens and denied requests are still recorded every time.
+func (s *Service) AuditTokenAccepted(ctx context.Context, event auditmodel.Event) {
+	identity, ok := IdentityFromContext(ctx)
+	if ok {
+		key, until := "token:"+identity.TokenID, identity.ExpiresAt
+
+		if identity.APIKeyID != "" {
+			key, until = "key:"+identity.APIKeyID, time.Now().Add(apiKeyAuditInterval)
+		}
+
+		if key != "token:" && !s.tokenUses.first(key, until) {
+			return
+		}
+	}
+
+	s.Audit(ctx, event)
+}
+
+// auditResult records the outcome of an action by the error it ended with,
+// Reason set before is kept, it is more exact than the error shown to the client
+func (s *Service) auditResult(ctx context.Context, event auditmodel.Event, err error) {
+	event.Outcome = auditmodel.OutcomeSuccess
+
+	if err != nil {
+		event.Outcome = auditmodel.OutcomeFailure
+		if event.Reason == "" {
+			event.Reason = err.Error()
+		}
+	}
+
+	s.Audit(ctx, event)
+}
+
+// ListAudit returns the newest events first, zero from and to are not limited
+func (s *Service) ListAudit(ctx context.Context, filter auditmodel.Filter, page int64) (AuditPage, error) {
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return AuditPage{}, customerr.NewCustomError(customerr.BadRequest, "from has to be before to")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if filter.Limit < 1 {
+		filter.Limit = defaultAuditLimit
+	}
+
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	filter.Skip = (page - 1) * filter.Limit
+
+	events, total, err := s.AuditStorage.List(ctx, filter)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	return AuditPage{Events: events, Total: total, Page: page, Limit: filter.Limit}, nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/entity/sale/salemodel"
+	"time"
+)
+
+type locationKey struct{}
+
+// withLocation keeps the time zone of the caller for the work on many sales, so it is looked up once
+func withLocation(ctx context.Context, location *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, location)
+}
+
+// Location is the time zone of the caller in which days start, callers without one get sales.time_zone
+func (s *Service) Location(ctx context.Context) *time.Location {
+	if location, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return location
+	}
+
+	if identity, ok := IdentityFromContext(ctx); ok {
+		user, err := s.UserStorage.GetByID(ctx, identity.UserID)
+		if err == nil && user.TimeZone != "" {
+			location, err := time.LoadLocation(user.TimeZone)
+			if err == nil {
+				return location
+			}
+
+			s.Logger.Warnf("time zone %q of user id=%s: %v", user.TimeZone, user.ID, err)
+		}
+	}
+
+	location, err := time.LoadLocation(s.Config.Sales.TimeZone)
+	if err != nil {
+		s.Logger.Error(err)
+		return time.UTC
+	}
+
+	return location
+}
+
+// parseSaleDate looks up the time zone only for dates without one
+func (s *Service) parseSaleDate(ctx context.Context, value string) (time.Time, error) {
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date.UTC(), nil
+	}
+
+	return salemodel.ParseDate(value, s.Config.Sales.DateLayouts, s.Location(ctx))
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/sale/salemodel"
+	"time"
+)
+
+// ImportRow is one sale of the import. Line is the line of CSV or NDJSON, Errors are the fields which couldn't
+// be read and Error is for the line which couldn't be read at all, the row with them is rejected.
+type ImportRow struct {
+	Line   int
+	Sale   salemodel.Sale
+	Date   string
+	Errors []customerr.FieldError
+	Error  string
+}
+
+// ImportResult is the outcome of one row, ID is set for the stored sale
+type ImportResult struct {
+	Line     int
+	Accepted bool
+	ID       string
+	Errors   []customerr.FieldError
+	Error    string
+}
+
+// ImportBatch is a part of the import stored at once, it is stored partly if the storage failed on it
+// and not at all if the storage failed before it
+type ImportBatch struct {
+	FirstLine int
+	LastLine  int
+	Rows      int
+	Stored    int
+}
+
+// ImportReport has a result for every row, in the dry run accepted rows are only valid and not stored
+type ImportReport struct {
+	DryRun   bool
+	Accepted int
+	Rejected int
+	Rows     []ImportResult
+	Batches  []ImportBatch
+}
+
+// ImportSales validates every row like CreateSale and stores the valid ones by sales.import.batch_size,
+// invalid rows don't stop the import. If the storage fails, the rows which are not stored yet are rejected.
+func (s *Service) ImportSales(ctx context.Context, rows []ImportRow, dryRun bool) (ImportReport, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ImportReport{}, customerr.Unauthorized
+	}
+
+	cfg := s.Config.Sales.Import
+	if cfg.MaxRows > 0 && len(rows) > cfg.MaxRows {
+		return ImportReport{}, customerr.NewCustomError(customerr.BadRequest,
+			fmt.Sprintf("import can't have more than %d rows", cfg.MaxRows))
+	}
+
+	// the time zone of the caller is the same for all rows, a seller is looked up once for all its rows
+	ctx = withLocation(ctx, s.Location(ctx))
+	ctx = withSellers(ctx)
+
+	report := ImportReport{DryRun: dryRun, Rows: make([]ImportResult, len(rows))}
+
+	var sales []salemodel.Sale
+	var accepted []int
+
+	for i, row := range rows {
+		result := ImportResult{Line: row.Line, Errors: row.Errors, Error: row.Error}
+
+		if row.Error == "" {
+			sale := row.Sale
+			if sale.SellerID == "" || !identity.Can(PermissionSaleWriteAny) {
+				sale.SellerID = identity.UserID
+			}
+
+			err := s.validateSale(ctx, &sale, row.Date, sale.SellerID != identity.UserID)
+			result.Errors = mergeFieldErrors(row.Errors, err)
+
+			if len(result.Errors) == 0 {
+				sales = append(sales, sale)
+				accepted = append(accepted, i)
+			}
+		}
+
+		report.Rows[i] = result
+	}
+
+	stored := len(sales)
+	if !dryRun {
+		stored, report.Batches = s.storeImport(ctx, sales, report.Rows, accepted)
+	}
+
+	for _, i := range accepted[:stored] {
+		report.Rows[i].Accepted = true
+	}
+
+	report.Accepted = stored
+	report.Rejected = len(rows) - stored
+
+	s.Logger.Infof("user id=%s imported %d sales, %d rows are rejected, dry run: %v",
+		identity.UserID, report.Accepted, report.Rejected, dryRun)
+
+	return report, nil
+}
+
+// storeImport inserts the sales by batches and returns how many of them are stored. The batches which are stored
+// are kept if a later one fails, so the report tells which of them are stored.
+func (s *Service) storeImport(ctx context.Context, sales []salemodel.Sale, results []ImportResult,
+	rows []int) (int, []ImportBatch) {
+	batchSize := s.Config.Sales.Import.BatchSize
+	if batchSize < 1 {
+		batchSize = len(sales)
+	}
+
+	var batches []ImportBatch
+
+	stored := 0
+	failed := false
+
+	for start := 0; start < len(sales); start += batchSize {
+		end := start + batchSize
+		if end > len(sales) {
+			end = len(sales)
+		}
+
+		batch := ImportBatch{FirstLine: results[rows[start]].Line, LastLine: results[rows[end-1]].Line, Rows: end - start}
+
+		if !failed {
+			batch.Stored, failed = s.storeBatch(ctx, sales[start:end], results, rows[start:end])
+			stored += batch.Stored
+		}
+
+		batches = append(batches, batch)
+	}
+
+	if failed {
+		for _, i := range rows[stored:] {
+			results[i].Error = "sale is not stored, import it again"
+		}
+	}
+
+	return stored, batches
+}
+
+// storeBatch returns how many sales of the batch are stored and true if the storage failed
+func (s *Service) storeBatch(ctx context.Context, batch []salemodel.Sale, results []ImportResult, rows []int) (int, bool) {
+	ids, err := s.SaleStorage.CreateMany(ctx, batch)
+
+	now := time.Now().UTC()
+	for i, id := range ids {
+		batch[i].ID = id
+		batch[i].Version = 1
+		batch[i].CreatedAt = now
+		batch[i].UpdatedAt = now
+		results[rows[i]].ID = id
+	}
+
+	s.recordCreated(ctx, batch[:len(ids)])
+
+	if err != nil {
+		s.Logger.Error(err)
+		return len(ids), true
+	}
+
+	return len(ids), false
+}
+
+// mergeFieldErrors keeps the errors of reading the row, validation errors of the same fields are left out
+func mergeFieldErrors(read []customerr.FieldError, err error) []customerr.FieldError {
+	var validation *customerr.CustomError
+	if !errors.As(err, &validation) {
+		return read
+	}
+
+	fields := append([]customerr.FieldError{}, read...)
+
+	for _, fieldErr := range validation.Errors {
+		known := false
+		for _, readErr := range read {
+			known = known || readErr.Field == fieldErr.Field
+		}
+
+		if !known {
+			fields = append(fields, fieldErr)
+		}
+	}
+
+	return fields
+}
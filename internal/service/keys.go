@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"nprn/internal/config"
+	"nprn/pkg/jwks"
+	"os"
+	"strings"
+)
+
+// LoadKeySet reads the keys described in config, only HMAC secrets may be written in config directly
+func LoadKeySet(cfg config.JWT) (*jwks.KeySet, error) {
+	keys := make([]*jwks.Key, 0, len(cfg.Keys))
+
+	for _, keyCfg := range cfg.Keys {
+		var data []byte
+
+		if keyCfg.File != "" {
+			content, err := os.ReadFile(keyCfg.File)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key %s: %v", keyCfg.ID, err)
+			}
+			data = content
+		} else {
+			data = []byte(keyCfg.Secret)
+		}
+
+		var key *jwks.Key
+		var err error
+
+		if strings.HasPrefix(keyCfg.Algorithm, "HS") {
+			key, err = jwks.NewHMACKey(keyCfg.ID, keyCfg.Algorithm, bytes.TrimSpace(data))
+		} else {
+			key, err = jwks.ParsePEMKey(keyCfg.ID, keyCfg.Algorithm, data)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return jwks.NewKeySet(cfg.SigningKey, keys...)
+}
+
+// JWKS returns public keys for other services which verify our tokens
+func (s *Service) JWKS() jwks.JSONWebKeySet {
+	return s.Keys.JWKS()
+}
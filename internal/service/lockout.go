@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"time"
+)
+
+const lockoutMessage = "too many failed sign-in attempts, try again later"
+
+type lockoutKey struct {
+	key       string
+	threshold int
+}
+
+func userAttemptKey(username string) string {
+	return "user:" + username
+}
+
+func ipAttemptKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+func mfaAttemptKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// lockoutKeys are counted separately: a username is attacked from many addresses,
+// an address guesses many usernames. The address threshold is higher because of NAT.
+// The username is the normalized key, so changing the case doesn't give new attempts.
+func (s *Service) lockoutKeys(username string, clientIP string) []lockoutKey {
+	keys := []lockoutKey{{key: userAttemptKey(username), threshold: s.Config.Lockout.UserThreshold}}
+
+	if clientIP != "" {
+		keys = append(keys, lockoutKey{key: ipAttemptKey(clientIP), threshold: s.Config.Lockout.IPThreshold})
+	}
+
+	return keys
+}
+
+// checkLockout returns TooManyRequests while the username or the address is locked
+func (s *Service) checkLockout(ctx context.Context, username string, clientIP string) error {
+	return s.checkLocked(ctx, s.lockoutKeys(username, clientIP))
+}
+
+// signInFailed counts the failure and returns the error for the client,
+// the failure which reaches the threshold already gets TooManyRequests
+func (s *Service) signInFailed(ctx context.Context, username string, clientIP string) error {
+	err := s.addFailure(ctx, s.lockoutKeys(username, clientIP))
+	if err != nil {
+		return err
+	}
+
+	return customerr.NotFoundErr
+}
+
+// resetFailures forgets failures of the username after a successful sign-in,
+// failures of the address are kept, so one known password doesn't help to guess others
+func (s *Service) resetFailures(ctx context.Context, username string) {
+	s.forgetFailures(ctx, userAttemptKey(username))
+}
+
+func (s *Service) checkLocked(ctx context.Context, keys []lockoutKey) error {
+	if !s.Config.Lockout.Enabled {
+		return nil
+	}
+
+	var wait time.Duration
+
+	for _, key := range keys {
+		attempt, err := s.AttemptStorage.Get(ctx, key.key)
+		if err != nil {
+			return err
+		}
+
+		if until := time.Until(attempt.LockedUntil); until > wait {
+			wait = until
+		}
+	}
+
+	if wait > 0 {
+		return customerr.NewRetryAfterError(lockoutMessage, wait)
+	}
+
+	return nil
+}
+
+// addFailure returns TooManyRequests if one of the keys is locked by this failure
+func (s *Service) addFailure(ctx context.Context, keys []lockoutKey) error {
+	if !s.Config.Lockout.Enabled {
+		return nil
+	}
+
+	var wait time.Duration
+
+	for _, key := range keys {
+		attempt, err := s.AttemptStorage.AddFailure(ctx, key.key, s.Config.Lockout.Window)
+		if err != nil {
+			s.Logger.Error(err)
+			continue
+		}
+
+		if key.threshold <= 0 || attempt.Failures < key.threshold {
+			continue
+		}
+
+		delay := lockoutDelay(s.Config.Lockout.BaseDelay, s.Config.Lockout.MaxDelay, attempt.Failures-key.threshold)
+
+		err = s.AttemptStorage.Lock(ctx, key.key, time.Now().UTC().Add(delay))
+		if err != nil {
+			s.Logger.Error(err)
+			continue
+		}
+
+		s.Logger.Warnf("%s is locked for %v after %d failed attempts", key.key, delay, attempt.Failures)
+
+		if delay > wait {
+			wait = delay
+		}
+	}
+
+	if wait > 0 {
+		return customerr.NewRetryAfterError(lockoutMessage, wait)
+	}
+
+	return nil
+}
+
+func (s *Service) forgetFailures(ctx context.Context, key string) {
+	if !s.Config.Lockout.Enabled {
+		return
+	}
+
+	err := s.AttemptStorage.Delete(ctx, key)
+	if err != nil {
+		s.Logger.Error(err)
+	}
+}
+
+// lockoutDelay doubles the base delay for every failure after the threshold
+func lockoutDelay(base time.Duration, max time.Duration, extraFailures int) time.Duration {
+	delay := base
+
+	for i := 0; i < extraFailures && delay < max; i++ {
+		delay *= 2
+	}
+
+	if max > 0 && delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// UnlockUser forgets failed sign-ins of the user, it is used by admins
+func (s *Service) UnlockUser(ctx context.Context, userID string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeUserUnlocked, TargetID: userID}, err) }()
+
+	user, err := s.UserStorage.GetByID(ctx, userID)
+	if err != nil {
+		s.Logger.Info(err)
+		return customerr.NotFoundErr
+	}
+
+	for _, key := range []string{userAttemptKey(user.UsernameKey), mfaAttemptKey(user.ID)} {
+		err = s.AttemptStorage.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Logger.Infof("user id=%s is unlocked", userID)
+
+	return nil
+}
+
+// UnlockAddress forgets failed sign-ins made from the address
+func (s *Service) UnlockAddress(ctx context.Context, clientIP string) (err error) {
+	defer func() {
+		s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeAddressUnlocked, Details: clientIP}, err)
+	}()
+
+	err = s.AttemptStorage.Delete(ctx, ipAttemptKey(clientIP))
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("address %s is unlocked", clientIP)
+
+	return nil
+}
+
+// rateLimit allows an action once per interval and at most limit times per window,
+// it uses the same counters as the lockout
+func (s *Service) rateLimit(ctx context.Context, key string, interval time.Duration, limit int,
+	window time.Duration, message string) error {
+	attempt, err := s.AttemptStorage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if wait := time.Until(attempt.LockedUntil); wait > 0 {
+		return customerr.NewRetryAfterError(message, wait)
+	}
+
+	attempt, err = s.AttemptStorage.AddFailure(ctx, key, window)
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().UTC().Add(interval)
+	if limit > 0 && attempt.Failures >= limit {
+		until = time.Now().UTC().Add(window)
+	}
+
+	return s.AttemptStorage.Lock(ctx, key, until)
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/user/usermodel"
+	"nprn/pkg/totp"
+	"strings"
+	"time"
+)
+
+const purposeMFA = "mfa"
+
+var errMFARequired = customerr.NewCustomError(customerr.Forbidden, "forbidden: second factor is required")
+var errMFACode = customerr.NewCustomError(customerr.Unauthorized, "code is not valid")
+
+// SignInResult has tokens or, for users with the second factor, the token for /auth/sign-in/mfa
+type SignInResult struct {
+	Tokens       TokenPair
+	MFAToken     string
+	MFAExpiresIn time.Duration
+}
+
+// TOTPEnrollment is shown once, QRCode is a PNG image of the URI
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte
+}
+
+// mfaChallenge is bound to the secret, so it stops working when the second factor is changed
+func (s *Service) mfaChallenge(user usermodel.UserInternal) (SignInResult, error) {
+	token, err := s.signActionToken(purposeMFA, user.ID, bindingOf(user.MFA.Secret), s.Config.MFA.ChallengeTTL)
+	if err != nil {
+		return SignInResult{}, err
+	}
+
+	return SignInResult{MFAToken: token, MFAExpiresIn: s.Config.MFA.ChallengeTTL}, nil
+}
+
+// SignInMFA exchanges the challenge from SignIn and a TOTP or recovery code for tokens
+func (s *Service) SignInMFA(ctx context.Context, mfaToken string, code string) (tokens TokenPair, err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeSignInMFA}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	claims, ok := s.parseActionToken(mfaToken, purposeMFA)
+	if !ok {
+		event.Reason = "challenge is not valid or expired"
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	event.UserID = claims.Subject
+
+	user, err := s.UserStorage.GetByID(ctx, claims.Subject)
+	if err != nil {
+		s.Logger.Info(err)
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	if user.Disabled || !user.MFA.Enabled || claims.Binding != bindingOf(user.MFA.Secret) {
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	ok, err = s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if !ok {
+		event.Reason = "wrong code"
+		return TokenPair{}, errMFACode
+	}
+
+	identity := identityOf(user)
+	identity.MFA = true
+
+	return s.issueTokenPair(ctx, identity, "")
+}
+
+// EnrollTOTP starts the enrollment, the secret is used only after ConfirmTOTP
+func (s *Service) EnrollTOTP(ctx context.Context) (TOTPEnrollment, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	if user.MFA.Enabled {
+		return TOTPEnrollment{}, customerr.NewCustomError(customerr.BadRequest, "second factor is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	uri := totp.URI(s.Config.MFA.Issuer, user.Username, secret)
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to encode qr code: %v", err)
+	}
+
+	user.MFA.PendingSecret = secret
+
+	err = s.UserStorage.UpdateMFA(ctx, user.ID, user.MFA)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// ConfirmTOTP enables the second factor if the code matches the pending secret and returns recovery codes
+func (s *Service) ConfirmTOTP(ctx context.Context, code string) (codes []string, err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeMFAEnabled}, err) }()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MFA.Enabled || user.MFA.PendingSecret == "" {
+		return nil, customerr.NewCustomError(customerr.BadRequest, "second factor enrollment is not started")
+	}
+
+	counter, ok := totp.Validate(user.MFA.PendingSecret, code, time.Now(), s.Config.MFA.Skew)
+	if !ok {
+		return nil, errMFACode
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	err = s.UserStorage.UpdateMFA(ctx, user.ID, usermodel.MFA{
+		Enabled:       true,
+		Secret:        user.MFA.PendingSecret,
+		RecoveryCodes: hashes,
+		LastCounter:   counter,
+		EnabledAt:     &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Logger.Infof("second factor of user id=%s is enabled", user.ID)
+
+	return codes, nil
+}
+
+// DisableTOTP turns the second factor off, it needs a valid code
+func (s *Service) DisableTOTP(ctx context.Context, code string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeMFADisabled}, err) }()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !user.MFA.Enabled {
+		return customerr.NewCustomError(customerr.BadRequest, "second factor is not enabled")
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errMFACode
+	}
+
+	err = s.UserStorage.UpdateMFA(ctx, user.ID, usermodel.MFA{})
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("second factor of user id=%s is disabled", user.ID)
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, it needs a valid code
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, code string) (codes []string, err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeRecoveryCodes}, err) }()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MFA.Enabled {
+		return nil, customerr.NewCustomError(customerr.BadRequest, "second factor is not enabled")
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, errMFACode
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// the code could be a recovery code which is already removed
+	user, err = s.UserStorage.GetByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFA.RecoveryCodes = hashes
+
+	err = s.UserStorage.UpdateMFA(ctx, user.ID, user.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// checkSecondFactor verifies the code under the lockout, codes are limited by the same lockout as passwords,
+// but with a separate counter shared by sign-in and the changes of the second factor
+func (s *Service) checkSecondFactor(ctx context.Context, user usermodel.UserInternal, code string) (bool, error) {
+	keys := []lockoutKey{{key: mfaAttemptKey(user.ID), threshold: s.Config.Lockout.UserThreshold}}
+
+	err := s.checkLocked(ctx, keys)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := s.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return false, s.addFailure(ctx, keys)
+	}
+
+	s.forgetFailures(ctx, mfaAttemptKey(user.ID))
+
+	return true, nil
+}
+
+// verifySecondFactor accepts a TOTP code once or an unused recovery code
+func (s *Service) verifySecondFactor(ctx context.Context, user usermodel.UserInternal, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if len(code) == totp.Digits {
+		counter, ok := totp.Validate(user.MFA.Secret, code, time.Now(), s.Config.MFA.Skew)
+		if !ok {
+			return false, nil
+		}
+
+		return s.UserStorage.UseTOTPCounter(ctx, user.ID, counter)
+	}
+
+	if code == "" {
+		return false, nil
+	}
+
+	ok, err := s.UserStorage.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		s.Logger.Infof("user id=%s used a recovery code", user.ID)
+	}
+
+	return ok, nil
+}
+
+// generateRecoveryCodes returns codes like "k3j7d-x2m9q" and their hashes
+func (s *Service) generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, 0, s.Config.MFA.RecoveryCodes)
+	hashes := make([]string, 0, s.Config.MFA.RecoveryCodes)
+
+	for i := 0; i < s.Config.MFA.RecoveryCodes; i++ {
+		buf := make([]byte, 7)
+
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+
+		raw := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		code := raw[:5] + "-" + raw[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// mfaRequired is true for sessions of users whose role needs the second factor but who signed in without it,
+// API keys are created in such sessions only, so they are not checked
+func (s *Service) mfaRequired(identity Identity) bool {
+	if identity.MFA || identity.APIKeyID != "" {
+		return false
+	}
+
+	for _, role := range s.Config.MFA.RequiredRoles {
+		if role == identity.Role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Service) currentUser(ctx context.Context) (usermodel.UserInternal, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return usermodel.UserInternal{}, customerr.Unauthorized
+	}
+
+	user, err := s.UserStorage.GetByID(ctx, identity.UserID)
+	if err != nil {
+		s.Logger.Info(err)
+		return usermodel.UserInternal{}, customerr.NotFoundErr
+	}
+
+	return user, nil
+}
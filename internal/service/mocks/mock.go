@@ -6,9 +6,16 @@ package mock_service
 
 import (
 	context "context"
+	apikeymodel "nprn/internal/entity/apikey/apikeymodel"
+	attemptmodel "nprn/internal/entity/attempt/attemptmodel"
+	auditmodel "nprn/internal/entity/audit/auditmodel"
+	revisionmodel "nprn/internal/entity/revision/revisionmodel"
 	salemodel "nprn/internal/entity/sale/salemodel"
+	tokenmodel "nprn/internal/entity/token/tokenmodel"
 	usermodel "nprn/internal/entity/user/usermodel"
+	mail "nprn/pkg/mail"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -36,6 +43,21 @@ func (m *MockSaleStorage) EXPECT() *MockSaleStorageMockRecorder {
 	return m.recorder
 }
 
+// CountBySeller mocks base method.
+func (m *MockSaleStorage) CountBySeller(ctx context.Context, sellerIDs []string) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountBySeller", ctx, sellerIDs)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountBySeller indicates an expected call of CountBySeller.
+func (mr *MockSaleStorageMockRecorder) CountBySeller(ctx, sellerIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountBySeller", reflect.TypeOf((*MockSaleStorage)(nil).CountBySeller), ctx, sellerIDs)
+}
+
 // Create mocks base method.
 func (m *MockSaleStorage) Create(ctx context.Context, sale salemodel.Sale) (string, error) {
 	m.ctrl.T.Helper()
@@ -51,33 +73,77 @@ func (mr *MockSaleStorageMockRecorder) Create(ctx, sale interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSaleStorage)(nil).Create), ctx, sale)
 }
 
+// CreateMany mocks base method.
+func (m *MockSaleStorage) CreateMany(ctx context.Context, sales []salemodel.Sale) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMany", ctx, sales)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMany indicates an expected call of CreateMany.
+func (mr *MockSaleStorageMockRecorder) CreateMany(ctx, sales interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMany", reflect.TypeOf((*MockSaleStorage)(nil).CreateMany), ctx, sales)
+}
+
 // Delete mocks base method.
-func (m *MockSaleStorage) Delete(ctx context.Context, id string) error {
+func (m *MockSaleStorage) Delete(ctx context.Context, id string, version int64, deletedBy string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret := m.ctrl.Call(m, "Delete", ctx, id, version, deletedBy)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockSaleStorageMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+func (mr *MockSaleStorageMockRecorder) Delete(ctx, id, version, deletedBy interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockSaleStorage)(nil).Delete), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockSaleStorage)(nil).Delete), ctx, id, version, deletedBy)
+}
+
+// Export mocks base method.
+func (m *MockSaleStorage) Export(ctx context.Context, filter salemodel.ListFilter, each func(salemodel.Sale) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", ctx, filter, each)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Export indicates an expected call of Export.
+func (mr *MockSaleStorageMockRecorder) Export(ctx, filter, each interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockSaleStorage)(nil).Export), ctx, filter, each)
 }
 
 // GetAll mocks base method.
-func (m *MockSaleStorage) GetAll(ctx context.Context) ([]salemodel.Sale, error) {
+func (m *MockSaleStorage) GetAll(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAll", ctx)
-	ret0, _ := ret[0].([]salemodel.Sale)
+	ret := m.ctrl.Call(m, "GetAll", ctx, filter)
+	ret0, _ := ret[0].(salemodel.Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAll indicates an expected call of GetAll.
-func (mr *MockSaleStorageMockRecorder) GetAll(ctx interface{}) *gomock.Call {
+func (mr *MockSaleStorageMockRecorder) GetAll(ctx, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockSaleStorage)(nil).GetAll), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockSaleStorage)(nil).GetAll), ctx, filter)
+}
+
+// GetDeleted mocks base method.
+func (m *MockSaleStorage) GetDeleted(ctx context.Context, id string) (salemodel.Sale, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeleted", ctx, id)
+	ret0, _ := ret[0].(salemodel.Sale)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeleted indicates an expected call of GetDeleted.
+func (mr *MockSaleStorageMockRecorder) GetDeleted(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeleted", reflect.TypeOf((*MockSaleStorage)(nil).GetDeleted), ctx, id)
 }
 
 // GetOne mocks base method.
@@ -95,6 +161,35 @@ func (mr *MockSaleStorageMockRecorder) GetOne(ctx, id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOne", reflect.TypeOf((*MockSaleStorage)(nil).GetOne), ctx, id)
 }
 
+// Purge mocks base method.
+func (m *MockSaleStorage) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, deletedBefore)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockSaleStorageMockRecorder) Purge(ctx, deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockSaleStorage)(nil).Purge), ctx, deletedBefore)
+}
+
+// Restore mocks base method.
+func (m *MockSaleStorage) Restore(ctx context.Context, id string, version int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockSaleStorageMockRecorder) Restore(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockSaleStorage)(nil).Restore), ctx, id, version)
+}
+
 // Update mocks base method.
 func (m *MockSaleStorage) Update(ctx context.Context, sale salemodel.Sale) error {
 	m.ctrl.T.Helper()
@@ -147,17 +242,789 @@ func (mr *MockUserStorageMockRecorder) Create(ctx, user interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockUserStorage)(nil).Create), ctx, user)
 }
 
-// GetOne mocks base method.
-func (m *MockUserStorage) GetOne(ctx context.Context, username, password string) (usermodel.UserTransfer, error) {
+// Delete mocks base method.
+func (m *MockUserStorage) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockUserStorageMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockUserStorage)(nil).Delete), ctx, id)
+}
+
+// GetByEmail mocks base method.
+func (m *MockUserStorage) GetByEmail(ctx context.Context, email string) (usermodel.UserInternal, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOne", ctx, username, password)
-	ret0, _ := ret[0].(usermodel.UserTransfer)
+	ret := m.ctrl.Call(m, "GetByEmail", ctx, email)
+	ret0, _ := ret[0].(usermodel.UserInternal)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetOne indicates an expected call of GetOne.
-func (mr *MockUserStorageMockRecorder) GetOne(ctx, username, password interface{}) *gomock.Call {
+// GetByEmail indicates an expected call of GetByEmail.
+func (mr *MockUserStorageMockRecorder) GetByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByEmail", reflect.TypeOf((*MockUserStorage)(nil).GetByEmail), ctx, email)
+}
+
+// GetByID mocks base method.
+func (m *MockUserStorage) GetByID(ctx context.Context, id string) (usermodel.UserInternal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	ret0, _ := ret[0].(usermodel.UserInternal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID.
+func (mr *MockUserStorageMockRecorder) GetByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockUserStorage)(nil).GetByID), ctx, id)
+}
+
+// GetByUsername mocks base method.
+func (m *MockUserStorage) GetByUsername(ctx context.Context, username string) (usermodel.UserInternal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUsername", ctx, username)
+	ret0, _ := ret[0].(usermodel.UserInternal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUsername indicates an expected call of GetByUsername.
+func (mr *MockUserStorageMockRecorder) GetByUsername(ctx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUsername", reflect.TypeOf((*MockUserStorage)(nil).GetByUsername), ctx, username)
+}
+
+// List mocks base method.
+func (m *MockUserStorage) List(ctx context.Context, filter usermodel.ListFilter) ([]usermodel.UserInternal, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter)
+	ret0, _ := ret[0].([]usermodel.UserInternal)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockUserStorageMockRecorder) List(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockUserStorage)(nil).List), ctx, filter)
+}
+
+// SetDisabled mocks base method.
+func (m *MockUserStorage) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisabled", ctx, id, disabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDisabled indicates an expected call of SetDisabled.
+func (mr *MockUserStorageMockRecorder) SetDisabled(ctx, id, disabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisabled", reflect.TypeOf((*MockUserStorage)(nil).SetDisabled), ctx, id, disabled)
+}
+
+// SetEmailVerified mocks base method.
+func (m *MockUserStorage) SetEmailVerified(ctx context.Context, id, email string, verifiedAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEmailVerified", ctx, id, email, verifiedAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetEmailVerified indicates an expected call of SetEmailVerified.
+func (mr *MockUserStorageMockRecorder) SetEmailVerified(ctx, id, email, verifiedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEmailVerified", reflect.TypeOf((*MockUserStorage)(nil).SetEmailVerified), ctx, id, email, verifiedAt)
+}
+
+// SetMustResetPassword mocks base method.
+func (m *MockUserStorage) SetMustResetPassword(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMustResetPassword", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMustResetPassword indicates an expected call of SetMustResetPassword.
+func (mr *MockUserStorageMockRecorder) SetMustResetPassword(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMustResetPassword", reflect.TypeOf((*MockUserStorage)(nil).SetMustResetPassword), ctx, id)
+}
+
+// UpdateMFA mocks base method.
+func (m *MockUserStorage) UpdateMFA(ctx context.Context, id string, mfa usermodel.MFA) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMFA", ctx, id, mfa)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMFA indicates an expected call of UpdateMFA.
+func (mr *MockUserStorageMockRecorder) UpdateMFA(ctx, id, mfa interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMFA", reflect.TypeOf((*MockUserStorage)(nil).UpdateMFA), ctx, id, mfa)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserStorage) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, passwordHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserStorageMockRecorder) UpdatePassword(ctx, id, passwordHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserStorage)(nil).UpdatePassword), ctx, id, passwordHash)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockUserStorage) UpdateProfile(ctx context.Context, user usermodel.UserInternal) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfile", ctx, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockUserStorageMockRecorder) UpdateProfile(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockUserStorage)(nil).UpdateProfile), ctx, user)
+}
+
+// UpdateRole mocks base method.
+func (m *MockUserStorage) UpdateRole(ctx context.Context, id, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRole", ctx, id, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRole indicates an expected call of UpdateRole.
+func (mr *MockUserStorageMockRecorder) UpdateRole(ctx, id, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRole", reflect.TypeOf((*MockUserStorage)(nil).UpdateRole), ctx, id, role)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockUserStorage) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, id, hash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockUserStorageMockRecorder) UseRecoveryCode(ctx, id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockUserStorage)(nil).UseRecoveryCode), ctx, id, hash)
+}
+
+// UseTOTPCounter mocks base method.
+func (m *MockUserStorage) UseTOTPCounter(ctx context.Context, id string, counter int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPCounter", ctx, id, counter)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPCounter indicates an expected call of UseTOTPCounter.
+func (mr *MockUserStorageMockRecorder) UseTOTPCounter(ctx, id, counter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPCounter", reflect.TypeOf((*MockUserStorage)(nil).UseTOTPCounter), ctx, id, counter)
+}
+
+// MockTokenStorage is a mock of TokenStorage interface.
+type MockTokenStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenStorageMockRecorder
+}
+
+// MockTokenStorageMockRecorder is the mock recorder for MockTokenStorage.
+type MockTokenStorageMockRecorder struct {
+	mock *MockTokenStorage
+}
+
+// NewMockTokenStorage creates a new mock instance.
+func NewMockTokenStorage(ctrl *gomock.Controller) *MockTokenStorage {
+	mock := &MockTokenStorage{ctrl: ctrl}
+	mock.recorder = &MockTokenStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenStorage) EXPECT() *MockTokenStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockTokenStorage) Create(ctx context.Context, token tokenmodel.RefreshToken) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, token)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockTokenStorageMockRecorder) Create(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockTokenStorage)(nil).Create), ctx, token)
+}
+
+// GetByHash mocks base method.
+func (m *MockTokenStorage) GetByHash(ctx context.Context, hash string) (tokenmodel.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByHash", ctx, hash)
+	ret0, _ := ret[0].(tokenmodel.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByHash indicates an expected call of GetByHash.
+func (mr *MockTokenStorageMockRecorder) GetByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByHash", reflect.TypeOf((*MockTokenStorage)(nil).GetByHash), ctx, hash)
+}
+
+// RevokeFamily mocks base method.
+func (m *MockTokenStorage) RevokeFamily(ctx context.Context, familyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeFamily", ctx, familyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeFamily indicates an expected call of RevokeFamily.
+func (mr *MockTokenStorageMockRecorder) RevokeFamily(ctx, familyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeFamily", reflect.TypeOf((*MockTokenStorage)(nil).RevokeFamily), ctx, familyID)
+}
+
+// RevokeUser mocks base method.
+func (m *MockTokenStorage) RevokeUser(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUser indicates an expected call of RevokeUser.
+func (mr *MockTokenStorageMockRecorder) RevokeUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUser", reflect.TypeOf((*MockTokenStorage)(nil).RevokeUser), ctx, userID)
+}
+
+// Rotate mocks base method.
+func (m *MockTokenStorage) Rotate(ctx context.Context, id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rotate", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Rotate indicates an expected call of Rotate.
+func (mr *MockTokenStorageMockRecorder) Rotate(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rotate", reflect.TypeOf((*MockTokenStorage)(nil).Rotate), ctx, id)
+}
+
+// MockRevocationStorage is a mock of RevocationStorage interface.
+type MockRevocationStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockRevocationStorageMockRecorder
+}
+
+// MockRevocationStorageMockRecorder is the mock recorder for MockRevocationStorage.
+type MockRevocationStorageMockRecorder struct {
+	mock *MockRevocationStorage
+}
+
+// NewMockRevocationStorage creates a new mock instance.
+func NewMockRevocationStorage(ctrl *gomock.Controller) *MockRevocationStorage {
+	mock := &MockRevocationStorage{ctrl: ctrl}
+	mock.recorder = &MockRevocationStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRevocationStorage) EXPECT() *MockRevocationStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRevocationStorage) Create(ctx context.Context, revocation tokenmodel.Revocation) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, revocation)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRevocationStorageMockRecorder) Create(ctx, revocation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRevocationStorage)(nil).Create), ctx, revocation)
+}
+
+// GetByUser mocks base method.
+func (m *MockRevocationStorage) GetByUser(ctx context.Context, userID string) ([]tokenmodel.Revocation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUser", ctx, userID)
+	ret0, _ := ret[0].([]tokenmodel.Revocation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUser indicates an expected call of GetByUser.
+func (mr *MockRevocationStorageMockRecorder) GetByUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUser", reflect.TypeOf((*MockRevocationStorage)(nil).GetByUser), ctx, userID)
+}
+
+// MockResetStorage is a mock of ResetStorage interface.
+type MockResetStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockResetStorageMockRecorder
+}
+
+// MockResetStorageMockRecorder is the mock recorder for MockResetStorage.
+type MockResetStorageMockRecorder struct {
+	mock *MockResetStorage
+}
+
+// NewMockResetStorage creates a new mock instance.
+func NewMockResetStorage(ctrl *gomock.Controller) *MockResetStorage {
+	mock := &MockResetStorage{ctrl: ctrl}
+	mock.recorder = &MockResetStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResetStorage) EXPECT() *MockResetStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockResetStorage) Create(ctx context.Context, reset tokenmodel.PasswordReset) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, reset)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockResetStorageMockRecorder) Create(ctx, reset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockResetStorage)(nil).Create), ctx, reset)
+}
+
+// GetByHash mocks base method.
+func (m *MockResetStorage) GetByHash(ctx context.Context, hash string) (tokenmodel.PasswordReset, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByHash", ctx, hash)
+	ret0, _ := ret[0].(tokenmodel.PasswordReset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByHash indicates an expected call of GetByHash.
+func (mr *MockResetStorageMockRecorder) GetByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByHash", reflect.TypeOf((*MockResetStorage)(nil).GetByHash), ctx, hash)
+}
+
+// Use mocks base method.
+func (m *MockResetStorage) Use(ctx context.Context, id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Use", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Use indicates an expected call of Use.
+func (mr *MockResetStorageMockRecorder) Use(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Use", reflect.TypeOf((*MockResetStorage)(nil).Use), ctx, id)
+}
+
+// UseAll mocks base method.
+func (m *MockResetStorage) UseAll(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseAll indicates an expected call of UseAll.
+func (mr *MockResetStorageMockRecorder) UseAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseAll", reflect.TypeOf((*MockResetStorage)(nil).UseAll), ctx, userID)
+}
+
+// MockAPIKeyStorage is a mock of APIKeyStorage interface.
+type MockAPIKeyStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyStorageMockRecorder
+}
+
+// MockAPIKeyStorageMockRecorder is the mock recorder for MockAPIKeyStorage.
+type MockAPIKeyStorageMockRecorder struct {
+	mock *MockAPIKeyStorage
+}
+
+// NewMockAPIKeyStorage creates a new mock instance.
+func NewMockAPIKeyStorage(ctrl *gomock.Controller) *MockAPIKeyStorage {
+	mock := &MockAPIKeyStorage{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyStorage) EXPECT() *MockAPIKeyStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockAPIKeyStorage) Create(ctx context.Context, key apikeymodel.APIKey) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockAPIKeyStorageMockRecorder) Create(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAPIKeyStorage)(nil).Create), ctx, key)
+}
+
+// GetByHash mocks base method.
+func (m *MockAPIKeyStorage) GetByHash(ctx context.Context, hash string) (apikeymodel.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByHash", ctx, hash)
+	ret0, _ := ret[0].(apikeymodel.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByHash indicates an expected call of GetByHash.
+func (mr *MockAPIKeyStorageMockRecorder) GetByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByHash", reflect.TypeOf((*MockAPIKeyStorage)(nil).GetByHash), ctx, hash)
+}
+
+// GetByUser mocks base method.
+func (m *MockAPIKeyStorage) GetByUser(ctx context.Context, userID string) ([]apikeymodel.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUser", ctx, userID)
+	ret0, _ := ret[0].([]apikeymodel.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUser indicates an expected call of GetByUser.
+func (mr *MockAPIKeyStorageMockRecorder) GetByUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUser", reflect.TypeOf((*MockAPIKeyStorage)(nil).GetByUser), ctx, userID)
+}
+
+// Revoke mocks base method.
+func (m *MockAPIKeyStorage) Revoke(ctx context.Context, id, userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", ctx, id, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockAPIKeyStorageMockRecorder) Revoke(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockAPIKeyStorage)(nil).Revoke), ctx, id, userID)
+}
+
+// UpdateLastUsed mocks base method.
+func (m *MockAPIKeyStorage) UpdateLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLastUsed", ctx, id, lastUsedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLastUsed indicates an expected call of UpdateLastUsed.
+func (mr *MockAPIKeyStorageMockRecorder) UpdateLastUsed(ctx, id, lastUsedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLastUsed", reflect.TypeOf((*MockAPIKeyStorage)(nil).UpdateLastUsed), ctx, id, lastUsedAt)
+}
+
+// MockAttemptStorage is a mock of AttemptStorage interface.
+type MockAttemptStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAttemptStorageMockRecorder
+}
+
+// MockAttemptStorageMockRecorder is the mock recorder for MockAttemptStorage.
+type MockAttemptStorageMockRecorder struct {
+	mock *MockAttemptStorage
+}
+
+// NewMockAttemptStorage creates a new mock instance.
+func NewMockAttemptStorage(ctrl *gomock.Controller) *MockAttemptStorage {
+	mock := &MockAttemptStorage{ctrl: ctrl}
+	mock.recorder = &MockAttemptStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAttemptStorage) EXPECT() *MockAttemptStorageMockRecorder {
+	return m.recorder
+}
+
+// AddFailure mocks base method.
+func (m *MockAttemptStorage) AddFailure(ctx context.Context, key string, window time.Duration) (attemptmodel.Attempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddFailure", ctx, key, window)
+	ret0, _ := ret[0].(attemptmodel.Attempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddFailure indicates an expected call of AddFailure.
+func (mr *MockAttemptStorageMockRecorder) AddFailure(ctx, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddFailure", reflect.TypeOf((*MockAttemptStorage)(nil).AddFailure), ctx, key, window)
+}
+
+// Delete mocks base method.
+func (m *MockAttemptStorage) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockAttemptStorageMockRecorder) Delete(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAttemptStorage)(nil).Delete), ctx, key)
+}
+
+// Get mocks base method.
+func (m *MockAttemptStorage) Get(ctx context.Context, key string) (attemptmodel.Attempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(attemptmodel.Attempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockAttemptStorageMockRecorder) Get(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockAttemptStorage)(nil).Get), ctx, key)
+}
+
+// Lock mocks base method.
+func (m *MockAttemptStorage) Lock(ctx context.Context, key string, until time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lock", ctx, key, until)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lock indicates an expected call of Lock.
+func (mr *MockAttemptStorageMockRecorder) Lock(ctx, key, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockAttemptStorage)(nil).Lock), ctx, key, until)
+}
+
+// MockAuditStorage is a mock of AuditStorage interface.
+type MockAuditStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditStorageMockRecorder
+}
+
+// MockAuditStorageMockRecorder is the mock recorder for MockAuditStorage.
+type MockAuditStorageMockRecorder struct {
+	mock *MockAuditStorage
+}
+
+// NewMockAuditStorage creates a new mock instance.
+func NewMockAuditStorage(ctrl *gomock.Controller) *MockAuditStorage {
+	mock := &MockAuditStorage{ctrl: ctrl}
+	mock.recorder = &MockAuditStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditStorage) EXPECT() *MockAuditStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockAuditStorage) Create(ctx context.Context, event auditmodel.Event) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, event)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockAuditStorageMockRecorder) Create(ctx, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAuditStorage)(nil).Create), ctx, event)
+}
+
+// List mocks base method.
+func (m *MockAuditStorage) List(ctx context.Context, filter auditmodel.Filter) ([]auditmodel.Event, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, filter)
+	ret0, _ := ret[0].([]auditmodel.Event)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockAuditStorageMockRecorder) List(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAuditStorage)(nil).List), ctx, filter)
+}
+
+// MockRevisionStorage is a mock of RevisionStorage interface.
+type MockRevisionStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockRevisionStorageMockRecorder
+}
+
+// MockRevisionStorageMockRecorder is the mock recorder for MockRevisionStorage.
+type MockRevisionStorageMockRecorder struct {
+	mock *MockRevisionStorage
+}
+
+// NewMockRevisionStorage creates a new mock instance.
+func NewMockRevisionStorage(ctrl *gomock.Controller) *MockRevisionStorage {
+	mock := &MockRevisionStorage{ctrl: ctrl}
+	mock.recorder = &MockRevisionStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRevisionStorage) EXPECT() *MockRevisionStorageMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRevisionStorage) Create(ctx context.Context, revision revisionmodel.Revision) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, revision)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRevisionStorageMockRecorder) Create(ctx, revision interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRevisionStorage)(nil).Create), ctx, revision)
+}
+
+// CreateMany mocks base method.
+func (m *MockRevisionStorage) CreateMany(ctx context.Context, revisions []revisionmodel.Revision) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMany", ctx, revisions)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMany indicates an expected call of CreateMany.
+func (mr *MockRevisionStorageMockRecorder) CreateMany(ctx, revisions interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMany", reflect.TypeOf((*MockRevisionStorage)(nil).CreateMany), ctx, revisions)
+}
+
+// GetByVersion mocks base method.
+func (m *MockRevisionStorage) GetByVersion(ctx context.Context, saleID string, version int64) (revisionmodel.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByVersion", ctx, saleID, version)
+	ret0, _ := ret[0].(revisionmodel.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByVersion indicates an expected call of GetByVersion.
+func (mr *MockRevisionStorageMockRecorder) GetByVersion(ctx, saleID, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByVersion", reflect.TypeOf((*MockRevisionStorage)(nil).GetByVersion), ctx, saleID, version)
+}
+
+// List mocks base method.
+func (m *MockRevisionStorage) List(ctx context.Context, saleID string, skip, limit int64) ([]revisionmodel.Revision, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, saleID, skip, limit)
+	ret0, _ := ret[0].([]revisionmodel.Revision)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// List indicates an expected call of List.
+func (mr *MockRevisionStorageMockRecorder) List(ctx, saleID, skip, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRevisionStorage)(nil).List), ctx, saleID, skip, limit)
+}
+
+// MockMailer is a mock of Mailer interface.
+type MockMailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerMockRecorder
+}
+
+// MockMailerMockRecorder is the mock recorder for MockMailer.
+type MockMailerMockRecorder struct {
+	mock *MockMailer
+}
+
+// NewMockMailer creates a new mock instance.
+func NewMockMailer(ctrl *gomock.Controller) *MockMailer {
+	mock := &MockMailer{ctrl: ctrl}
+	mock.recorder = &MockMailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMailerMockRecorder) Send(ctx, msg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOne", reflect.TypeOf((*MockUserStorage)(nil).GetOne), ctx, username, password)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailer)(nil).Send), ctx, msg)
 }
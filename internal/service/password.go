@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"nprn/pkg/passhash"
+)
+
+// legacySalt is used only to check hashes made before argon2id
+const legacySalt = "4hsd83jd7fsd2"
+
+func (s *Service) passwordParams() passhash.Params {
+	return passhash.Params{
+		Memory:      s.Config.Password.Memory,
+		Iterations:  s.Config.Password.Iterations,
+		Parallelism: s.Config.Password.Parallelism,
+		SaltLength:  s.Config.Password.SaltLength,
+		KeyLength:   s.Config.Password.KeyLength,
+	}
+}
+
+func (s *Service) hashPassword(password string) (string, error) {
+	return passhash.Hash(password, s.passwordParams())
+}
+
+// checkPassword also reports whether the hash is legacy or made with outdated params and should be replaced
+func (s *Service) checkPassword(password string, hash string) (bool, bool) {
+	if !passhash.IsPHC(hash) {
+		legacy := legacyPasswordHash(password)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1, true
+	}
+
+	ok, _, err := passhash.Verify(password, hash)
+	if err != nil {
+		s.Logger.Error(err)
+		return false, false
+	}
+
+	return ok, passhash.NeedsRehash(hash, s.passwordParams())
+}
+
+// dummyPasswordHash is checked when the user is not found
+func (s *Service) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.hashPassword("dummy password")
+		if err != nil {
+			s.Logger.Error(err)
+		}
+		s.dummyHash = hash
+	})
+
+	return s.dummyHash
+}
+
+// upgradePassword doesn't fail sign-in, the hash will be upgraded next time
+func (s *Service) upgradePassword(ctx context.Context, userID string, password string) {
+	passHash, err := s.hashPassword(password)
+	if err != nil {
+		s.Logger.Error(err)
+		return
+	}
+
+	err = s.UserStorage.UpdatePassword(ctx, userID, passHash)
+	if err != nil {
+		s.Logger.Error(err)
+		return
+	}
+
+	s.Logger.Infof("password hash of user id=%s is upgraded", userID)
+}
+
+// legacyPasswordHash is the old scheme: hex of the static salt followed by unsalted sha-256
+func legacyPasswordHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return fmt.Sprintf("%x", append([]byte(legacySalt), sum[:]...))
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/token/tokenmodel"
+	"nprn/internal/entity/user/usermodel"
+	"nprn/pkg/mail"
+	"time"
+)
+
+// backgroundTimeout limits work which is done after the answer is sent
+const backgroundTimeout = 30 * time.Second
+
+var errResetLink = customerr.NewCustomError(customerr.BadRequest, "password reset link is not valid or expired")
+
+// ForgotPassword sends a reset link if there is a user with the email. The answer doesn't depend
+// on the email and the work is done in background, so registered emails can't be learned even by timing.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	address, err := parseEmail(email)
+	if err != nil {
+		return err
+	}
+
+	// the request context is canceled after the answer, only the client is taken from it
+	client := clientFromContext(ctx)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(WithClient(context.Background(), client), backgroundTimeout)
+		defer cancel()
+
+		userID, err := s.sendPasswordReset(ctx, address)
+		if err != nil {
+			s.Logger.Info(err)
+		}
+
+		s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypePasswordForgot, UserID: userID, Details: address}, err)
+	}()
+
+	return nil
+}
+
+// sendPasswordReset returns the id of the user if the email is found
+func (s *Service) sendPasswordReset(ctx context.Context, email string) (string, error) {
+	cfg := s.Config.PasswordReset
+
+	err := s.rateLimit(ctx, "reset:"+email, cfg.Interval, cfg.Limit, cfg.Window, "password reset was requested recently")
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.UserStorage.GetByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Disabled {
+		return user.ID, fmt.Errorf("password reset for disabled user id=%s is skipped", user.ID)
+	}
+
+	return user.ID, s.mailResetLink(ctx, user)
+}
+
+func (s *Service) mailResetLink(ctx context.Context, user usermodel.UserInternal) error {
+	cfg := s.Config.PasswordReset
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	_, err = s.ResetStorage.Create(ctx, tokenmodel.PasswordReset{
+		Hash:      hashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.TokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := cfg.LinkURL + "?token=" + url.QueryEscape(token)
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password open the link:\n\n%s\n\n"+
+			"The link is valid for %v. If you didn't ask to reset the password, ignore this email.\n",
+			user.Username, link, cfg.TokenTTL),
+	})
+}
+
+// ResetPassword sets the new password by the token from the link, all sessions of the user are revoked
+func (s *Service) ResetPassword(ctx context.Context, token string, password string) (err error) {
+	event := auditmodel.Event{Type: auditmodel.TypePasswordReset}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	if password == "" {
+		return customerr.NewCustomError(customerr.BadRequest, "password is empty")
+	}
+
+	reset, err := s.ResetStorage.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		s.Logger.Info(err)
+		return errResetLink
+	}
+
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return errResetLink
+	}
+
+	ok, err := s.ResetStorage.Use(ctx, reset.ID)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errResetLink
+	}
+
+	event.UserID = reset.UserID
+
+	user, err := s.UserStorage.GetByID(ctx, reset.UserID)
+	if err != nil {
+		s.Logger.Info(err)
+		return errResetLink
+	}
+
+	if user.Disabled {
+		return errResetLink
+	}
+
+	passHash, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.UpdatePassword(ctx, user.ID, passHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.ResetStorage.UseAll(ctx, user.ID)
+	if err != nil {
+		s.Logger.Error(err)
+	}
+
+	err = s.RevokeAllTokens(ctx, user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.resetFailures(ctx, user.UsernameKey)
+
+	s.Logger.Infof("password of user id=%s is reset", user.ID)
+
+	s.notifyPasswordChanged(ctx, user)
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/revision/revisionmodel"
+	"nprn/internal/entity/sale/salemodel"
+	"time"
+)
+
+const (
+	defaultRevisionLimit = 50
+	maxRevisionLimit     = 500
+)
+
+// RevisionPage is one page of GetSaleHistory, Total is the number of all revisions of the sale
+type RevisionPage struct {
+	Revisions []revisionmodel.Revision
+	Total     int64
+	Page      int64
+	Limit     int64
+}
+
+// updatedSale is the sale as the storage keeps it after the change of the current sale
+func updatedSale(current salemodel.Sale, sale salemodel.Sale) salemodel.Sale {
+	sale.ID = current.ID
+	sale.Version = current.Version + 1
+	sale.CreatedAt = current.CreatedAt
+	sale.UpdatedAt = time.Now().UTC()
+
+	return sale
+}
+
+// recordRevision is written after the change like the audit log, an error is only logged
+// because the change is already made
+func (s *Service) recordRevision(ctx context.Context, action string, before salemodel.Sale, after salemodel.Sale,
+	revertedFrom int64) {
+	revision := newRevision(ctx, action, before, after)
+	revision.RevertedFrom = revertedFrom
+
+	_, err := s.RevisionStorage.Create(ctx, revision)
+	if err != nil {
+		s.Logger.Errorf("failed to record revision %d of sale id=%s: %v", after.Version, after.ID, err)
+	}
+}
+
+// recordCreated writes the first revisions of the sales created together
+func (s *Service) recordCreated(ctx context.Context, sales []salemodel.Sale) {
+	if len(sales) == 0 {
+		return
+	}
+
+	revisions := make([]revisionmodel.Revision, 0, len(sales))
+	for _, sale := range sales {
+		revisions = append(revisions, newRevision(ctx, revisionmodel.ActionCreated, salemodel.Sale{}, sale))
+	}
+
+	err := s.RevisionStorage.CreateMany(ctx, revisions)
+	if err != nil {
+		s.Logger.Errorf("failed to record revisions of %d created sales: %v", len(sales), err)
+	}
+}
+
+func newRevision(ctx context.Context, action string, before salemodel.Sale, after salemodel.Sale) revisionmodel.Revision {
+	identity, _ := IdentityFromContext(ctx)
+
+	return revisionmodel.Revision{
+		SaleID:  after.ID,
+		Version: after.Version,
+		Action:  action,
+		UserID:  identity.UserID,
+		Time:    after.UpdatedAt,
+		Sale:    after,
+		Changes: revisionmodel.Diff(before, after),
+	}
+}
+
+// GetSaleHistory returns the newest revisions first, the history of the sale in the trash can be read too
+func (s *Service) GetSaleHistory(ctx context.Context, id string, page int64, limit int64) (RevisionPage, error) {
+	sale, err := s.SaleStorage.GetOne(ctx, id)
+	if err != nil {
+		sale, err = s.SaleStorage.GetDeleted(ctx, id)
+	}
+
+	if err != nil {
+		s.Logger.Info(err)
+		return RevisionPage{}, customerr.NotFoundErr
+	}
+
+	err = checkOwner(ctx, sale, PermissionSaleReadAny)
+	if err != nil {
+		return RevisionPage{}, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if limit < 1 {
+		limit = defaultRevisionLimit
+	}
+
+	if limit > maxRevisionLimit {
+		limit = maxRevisionLimit
+	}
+
+	revisions, total, err := s.RevisionStorage.List(ctx, id, (page-1)*limit, limit)
+	if err != nil {
+		return RevisionPage{}, err
+	}
+
+	return RevisionPage{Revisions: revisions, Total: total, Page: page, Limit: limit}, nil
+}
+
+// RevertSale makes the sale as it was in the revision with toVersion, it is a new revision itself.
+// The sale is validated as by UpdateSale, the rules can be changed since the revision was made, and only
+// callers with sale:write:any get the seller of the revision back. The version is from If-Match.
+func (s *Service) RevertSale(ctx context.Context, id string, toVersion int64, version int64) (int64, error) {
+	current, err := s.SaleStorage.GetOne(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkOwner(ctx, current, PermissionSaleWriteAny)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkVersion(current, version)
+	if err != nil {
+		return 0, err
+	}
+
+	revision, err := s.RevisionStorage.GetByVersion(ctx, id, toVersion)
+	if errors.Is(err, revisionmodel.ErrNotFound) {
+		return 0, customerr.NewCustomError(customerr.NotFoundErr, "revision is not found")
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// a revision of the deletion keeps the sale out of the trash, restore is for the trash
+	sale := revision.Sale
+	sale.ID = current.ID
+	sale.Version = current.Version
+	sale.DeletedAt = nil
+	sale.DeletedBy = ""
+
+	identity, _ := IdentityFromContext(ctx)
+	if sale.SellerID == "" || !identity.Can(PermissionSaleWriteAny) {
+		sale.SellerID = current.SellerID
+	}
+
+	err = s.validateSale(ctx, &sale, "", sale.SellerID != current.SellerID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.SaleStorage.Update(ctx, sale)
+	if err != nil {
+		return 0, versionError(err, version)
+	}
+
+	s.recordRevision(ctx, revisionmodel.ActionReverted, current, updatedSale(current, sale), toVersion)
+
+	s.Logger.Infof("sale id=%s is reverted to version %d", id, toVersion)
+
+	return current.Version + 1, nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/token/tokenmodel"
+	"sync"
+	"time"
+)
+
+// revocationCache keeps revocations of recently seen users, so not every request goes to mongo.
+// Revocations made by this instance are visible at once, made by other instances after the cache TTL.
+type revocationCache struct {
+	mu    sync.Mutex
+	users map[string]cachedRevocations
+}
+
+type cachedRevocations struct {
+	fetchedAt   time.Time
+	revocations []tokenmodel.Revocation
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{users: make(map[string]cachedRevocations)}
+}
+
+func (c *revocationCache) get(userID string, ttl time.Duration) ([]tokenmodel.Revocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.users[userID]
+	if !ok || time.Since(cached.fetchedAt) > ttl {
+		return nil, false
+	}
+
+	return cached.revocations, true
+}
+
+func (c *revocationCache) set(userID string, revocations []tokenmodel.Revocation, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for id, cached := range c.users {
+		if now.Sub(cached.fetchedAt) > ttl {
+			delete(c.users, id)
+		}
+	}
+
+	c.users[userID] = cachedRevocations{fetchedAt: now, revocations: revocations}
+}
+
+// add is used after a revocation, the entry is kept only if it is already cached
+func (c *revocationCache) add(revocation tokenmodel.Revocation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.users[revocation.UserID]
+	if !ok {
+		return
+	}
+
+	cached.revocations = append(cached.revocations, revocation)
+	c.users[revocation.UserID] = cached
+}
+
+// Authenticate parses the access token and checks it has not been revoked
+func (s *Service) Authenticate(ctx context.Context, accessToken string) (Identity, error) {
+	identity, err := s.ParseToken(accessToken)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	revoked, err := s.isRevoked(ctx, identity)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if revoked {
+		return Identity{}, customerr.NewCustomError(customerr.Unauthorized, "token is revoked")
+	}
+
+	return identity, nil
+}
+
+func (s *Service) isRevoked(ctx context.Context, identity Identity) (bool, error) {
+	ttl := s.Config.JWT.RevocationCacheTTL
+
+	revocations, ok := s.revocations.get(identity.UserID, ttl)
+	if !ok {
+		var err error
+
+		revocations, err = s.RevocationStorage.GetByUser(ctx, identity.UserID)
+		if err != nil {
+			return false, err
+		}
+
+		s.revocations.set(identity.UserID, revocations, ttl)
+	}
+
+	for _, revocation := range revocations {
+		if revocation.TokenID != "" && revocation.TokenID == identity.TokenID {
+			return true, nil
+		}
+
+		// a token issued right after the revocation, e.g. by signing in again, is valid
+		if before := revocation.Before(); !before.IsZero() && identity.IssuedAt.Before(before) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// RevokeToken revokes the access token the request is made with
+func (s *Service) RevokeToken(ctx context.Context) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeTokenRevoked}, err) }()
+
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return customerr.Unauthorized
+	}
+
+	return s.revoke(ctx, tokenmodel.Revocation{
+		TokenID:   identity.TokenID,
+		UserID:    identity.UserID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: identity.ExpiresAt.UTC(),
+	})
+}
+
+// LogoutAll revokes all tokens of the caller on every device
+func (s *Service) LogoutAll(ctx context.Context) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeLogoutAll}, err) }()
+
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return customerr.Unauthorized
+	}
+
+	return s.RevokeAllTokens(ctx, identity.UserID, time.Now())
+}
+
+// RevokeUserTokens is RevokeAllTokens made by an admin
+func (s *Service) RevokeUserTokens(ctx context.Context, userID string, before time.Time) (err error) {
+	defer func() {
+		s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeTokensRevoked, TargetID: userID}, err)
+	}()
+
+	return s.RevokeAllTokens(ctx, userID, before)
+}
+
+// RevokeAllTokens revokes access tokens of the user issued before the time and all their refresh tokens,
+// it is used to log out everywhere and when the account is compromised
+func (s *Service) RevokeAllTokens(ctx context.Context, userID string, before time.Time) error {
+	err := s.revokeAccessTokens(ctx, userID, before)
+	if err != nil {
+		return err
+	}
+
+	return s.TokenStorage.RevokeUser(ctx, userID)
+}
+
+// revokeAccessTokens keeps refresh tokens, so the user gets a new access token with the current role
+func (s *Service) revokeAccessTokens(ctx context.Context, userID string, before time.Time) error {
+	now := time.Now().UTC()
+
+	if before.IsZero() || before.After(now) {
+		before = now
+	}
+
+	return s.revoke(ctx, tokenmodel.Revocation{
+		UserID:           userID,
+		IssuedBefore:     before.UTC(),
+		IssuedBeforeNano: before.UnixNano(),
+		CreatedAt:        now,
+		// tokens issued before are expired by then anyway
+		ExpiresAt: before.UTC().Add(s.Config.JWT.AccessTokenTTL + time.Second),
+	})
+}
+
+func (s *Service) revoke(ctx context.Context, revocation tokenmodel.Revocation) error {
+	id, err := s.RevocationStorage.Create(ctx, revocation)
+	if err != nil {
+		return err
+	}
+
+	revocation.ID = id
+	s.revocations.add(revocation)
+
+	s.Logger.Infof("tokens of user id=%s are revoked (token id=%q, issued before %v)",
+		revocation.UserID, revocation.TokenID, revocation.IssuedBefore)
+
+	return nil
+}
@@ -2,162 +2,613 @@ package service
 
 import (
 	"context"
-	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
+	"nprn/internal/config"
 	"nprn/internal/customerr"
+	"nprn/internal/entity/apikey/apikeymodel"
+	"nprn/internal/entity/attempt/attemptmodel"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/revision/revisionmodel"
 	"nprn/internal/entity/sale/salemodel"
+	"nprn/internal/entity/token/tokenmodel"
 	"nprn/internal/entity/user/usermodel"
+	"nprn/pkg/jwks"
 	"nprn/pkg/logging"
+	"nprn/pkg/mail"
+	"nprn/pkg/mergepatch"
+	"sync"
 	"time"
 )
 
 const (
-	salt      = "4hsd83jd7fsd2"
-	tokenTime = 12 * time.Hour
-	signKey   = "dkr3!#mc349x#s3&74f12d"
+	defaultSaleLimit = 50
+	maxSaleLimit     = 500
 )
 
 //go:generate mockgen -source=service.go -destination=mocks/mock.go
 
 type SaleStorage interface {
 	Create(ctx context.Context, sale salemodel.Sale) (string, error)
+	CreateMany(ctx context.Context, sales []salemodel.Sale) ([]string, error)
 	GetOne(ctx context.Context, id string) (salemodel.Sale, error)
-	GetAll(ctx context.Context) ([]salemodel.Sale, error)
+	GetAll(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error)
+	Export(ctx context.Context, filter salemodel.ListFilter, each func(sale salemodel.Sale) error) error
+	CountBySeller(ctx context.Context, sellerIDs []string) (map[string]int64, error)
 	Update(ctx context.Context, sale salemodel.Sale) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int64, deletedBy string) error
+	GetDeleted(ctx context.Context, id string) (salemodel.Sale, error)
+	Restore(ctx context.Context, id string, version int64) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type UserStorage interface {
 	Create(ctx context.Context, user usermodel.UserInternal) (string, error)
-	GetOne(ctx context.Context, username string, password string) (usermodel.UserTransfer, error)
-	//Update(ctx context.Context, user usermodel.UserInternal) error
-	//Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (usermodel.UserInternal, error)
+	GetByUsername(ctx context.Context, username string) (usermodel.UserInternal, error)
+	GetByEmail(ctx context.Context, email string) (usermodel.UserInternal, error)
+	UpdatePassword(ctx context.Context, id string, passwordHash string) error
+	List(ctx context.Context, filter usermodel.ListFilter) ([]usermodel.UserInternal, int64, error)
+	SetDisabled(ctx context.Context, id string, disabled bool) error
+	UpdateRole(ctx context.Context, id string, role string) error
+	SetMustResetPassword(ctx context.Context, id string) error
+	SetEmailVerified(ctx context.Context, id string, email string, verifiedAt time.Time) (bool, error)
+	UpdateMFA(ctx context.Context, id string, mfa usermodel.MFA) error
+	UseTOTPCounter(ctx context.Context, id string, counter int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, id string, hash string) (bool, error)
+	UpdateProfile(ctx context.Context, user usermodel.UserInternal) error
+	Delete(ctx context.Context, id string) error
+}
+
+type TokenStorage interface {
+	Create(ctx context.Context, token tokenmodel.RefreshToken) (string, error)
+	GetByHash(ctx context.Context, hash string) (tokenmodel.RefreshToken, error)
+	Rotate(ctx context.Context, id string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID string) error
+}
+
+type RevocationStorage interface {
+	Create(ctx context.Context, revocation tokenmodel.Revocation) (string, error)
+	GetByUser(ctx context.Context, userID string) ([]tokenmodel.Revocation, error)
+}
+
+type ResetStorage interface {
+	Create(ctx context.Context, reset tokenmodel.PasswordReset) (string, error)
+	GetByHash(ctx context.Context, hash string) (tokenmodel.PasswordReset, error)
+	Use(ctx context.Context, id string) (bool, error)
+	UseAll(ctx context.Context, userID string) error
+}
+
+type APIKeyStorage interface {
+	Create(ctx context.Context, key apikeymodel.APIKey) (string, error)
+	GetByHash(ctx context.Context, hash string) (apikeymodel.APIKey, error)
+	GetByUser(ctx context.Context, userID string) ([]apikeymodel.APIKey, error)
+	Revoke(ctx context.Context, id string, userID string) (bool, error)
+	UpdateLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error
+}
+
+type AttemptStorage interface {
+	Get(ctx context.Context, key string) (attemptmodel.Attempt, error)
+	AddFailure(ctx context.Context, key string, window time.Duration) (attemptmodel.Attempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+type AuditStorage interface {
+	Create(ctx context.Context, event auditmodel.Event) (string, error)
+	List(ctx context.Context, filter auditmodel.Filter) ([]auditmodel.Event, int64, error)
+}
+
+type RevisionStorage interface {
+	Create(ctx context.Context, revision revisionmodel.Revision) (string, error)
+	CreateMany(ctx context.Context, revisions []revisionmodel.Revision) error
+	List(ctx context.Context, saleID string, skip int64, limit int64) ([]revisionmodel.Revision, int64, error)
+	GetByVersion(ctx context.Context, saleID string, version int64) (revisionmodel.Revision, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg mail.Message) error
 }
 
 type Service struct {
-	UserStorage UserStorage
-	SaleStorage SaleStorage
-	Logger      *logging.Logger
+	UserStorage       UserStorage
+	SaleStorage       SaleStorage
+	TokenStorage      TokenStorage
+	RevocationStorage RevocationStorage
+	ResetStorage      ResetStorage
+	APIKeyStorage     APIKeyStorage
+	AttemptStorage    AttemptStorage
+	AuditStorage      AuditStorage
+	RevisionStorage   RevisionStorage
+	Mailer            Mailer
+	Keys              *jwks.KeySet
+	Config            *config.Config
+	Logger            *logging.Logger
+
+	revocations *revocationCache
+	tokenUses   *tokenUses
+
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
 type tokenClaims struct {
 	jwt.StandardClaims
 	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+
+	EmailVerified bool `json:"email_verified,omitempty"`
+	// MFA is true if the session was started with the second factor
+	MFA bool `json:"mfa,omitempty"`
+	// IssuedAtNano is iat in nanoseconds, so a token issued right after a revocation is not revoked by it
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
 }
 
-func NewService(userStorage UserStorage, saleStorage SaleStorage, logger *logging.Logger) *Service {
+func NewService(userStorage UserStorage, saleStorage SaleStorage, tokenStorage TokenStorage,
+	revocationStorage RevocationStorage, resetStorage ResetStorage, apiKeyStorage APIKeyStorage, attemptStorage AttemptStorage,
+	auditStorage AuditStorage, revisionStorage RevisionStorage, mailer Mailer, keys *jwks.KeySet, cfg *config.Config,
+	logger *logging.Logger) *Service {
 	return &Service{
-		UserStorage: userStorage,
-		SaleStorage: saleStorage,
-		Logger:      logger,
+		UserStorage:       userStorage,
+		SaleStorage:       saleStorage,
+		TokenStorage:      tokenStorage,
+		RevocationStorage: revocationStorage,
+		ResetStorage:      resetStorage,
+		APIKeyStorage:     apiKeyStorage,
+		AttemptStorage:    attemptStorage,
+		AuditStorage:      auditStorage,
+		RevisionStorage:   revisionStorage,
+		Mailer:            mailer,
+		Keys:              keys,
+		Config:            cfg,
+		Logger:            logger,
+		revocations:       newRevocationCache(),
+		tokenUses:         newTokenUses(),
 	}
 }
 
-func (s *Service) SignUp(ctx context.Context, user usermodel.UserInternal) (string, error) {
-	passHash, err := GeneratePasswordHash(user.PasswordHash)
+func (s *Service) SignUp(ctx context.Context, user usermodel.UserInternal) (tokens TokenPair, err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeSignUp, Username: user.Username}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	username, usernameKey, err := parseUsername(user.Username)
 	if err != nil {
-		return "", err
+		return TokenPair{}, err
+	}
+
+	email, err := parseEmail(user.Email)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	err = checkTimeZone(user.TimeZone)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	passHash, err := s.hashPassword(user.PasswordHash)
+	if err != nil {
+		return TokenPair{}, err
 	}
 
 	user.PasswordHash = passHash
+	user.Username = username
+	user.UsernameKey = usernameKey
+	user.Role = usermodel.RoleSeller // roles are granted only by admins
+	user.Email = email
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
 
 	objID, err := s.UserStorage.Create(ctx, user)
 	if err != nil {
 		s.Logger.Info(err)
-		return "", customerr.NotAcceptable
+		if conflict := conflictOf(err); conflict != nil {
+			return TokenPair{}, conflict
+		}
+		return TokenPair{}, customerr.NotAcceptable
+	}
+
+	user.ID = objID
+	event.UserID = objID
+
+	// the account is usable without the email, a new link can be requested later
+	err = s.sendVerification(ctx, user)
+	if err != nil {
+		s.Logger.Error(err)
 	}
 
-	return GenerateToken(objID)
+	return s.issueTokenPair(ctx, identityOf(user), "")
 }
 
-func (s *Service) SignIn(ctx context.Context, username string, password string) (string, error) {
-	passHash, err := GeneratePasswordHash(password)
+// SignIn checks the password, users with the second factor get a challenge instead of tokens.
+// clientIP is used to limit password guessing from one address
+func (s *Service) SignIn(ctx context.Context, username string, password string, clientIP string) (result SignInResult, err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeSignIn, Username: username, IP: clientIP}
+	defer func() {
+		if err == nil && result.MFAToken != "" {
+			event.Outcome = auditmodel.OutcomeChallenge
+			s.Audit(ctx, event)
+			return
+		}
+		s.auditResult(ctx, event, err)
+	}()
+
+	// a username which can't be normalized isn't registered, it is counted as it is
+	if _, key, err := usermodel.NormalizeUsername(username); err == nil {
+		username = key
+	}
+
+	err = s.checkLockout(ctx, username, clientIP)
 	if err != nil {
-		return "", err
+		event.Reason = "locked out"
+		return SignInResult{}, err
+	}
+
+	user, err := s.UserStorage.GetByUsername(ctx, username)
+	if err != nil {
+		s.Logger.Info(err)
+		event.Reason = "unknown username"
+		// spend the same time as for an existing user, so usernames can't be guessed by timing
+		s.checkPassword(password, s.dummyPasswordHash())
+		return SignInResult{}, s.signInFailed(ctx, username, clientIP)
+	}
+
+	event.UserID = user.ID
+
+	ok, rehash := s.checkPassword(password, user.PasswordHash)
+	if !ok {
+		event.Reason = "wrong password"
+		return SignInResult{}, s.signInFailed(ctx, username, clientIP)
+	}
+
+	s.resetFailures(ctx, username)
+
+	// checked after the password, so the state of the account isn't shown to strangers
+	if user.Disabled {
+		return SignInResult{}, errAccountDisabled
+	}
+
+	if user.MustResetPassword {
+		return SignInResult{}, errMustResetPassword
 	}
 
-	user, err := s.UserStorage.GetOne(ctx, username, passHash)
+	if rehash {
+		s.upgradePassword(ctx, user.ID, password)
+	}
+
+	if user.MFA.Enabled {
+		return s.mfaChallenge(user)
+	}
+
+	tokens, err := s.issueTokenPair(ctx, identityOf(user), "")
 	if err != nil {
-		return "", customerr.NotFoundErr
+		return SignInResult{}, err
 	}
 
-	return GenerateToken(user.ID)
+	return SignInResult{Tokens: tokens}, nil
 }
 
-func GenerateToken(id string) (string, error) {
+func (s *Service) GenerateToken(identity Identity) (string, error) {
+	tokenID, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
 	tkCl := tokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTime).Unix(),
-			IssuedAt:  time.Now().Unix(),
+			Id:        tokenID,
+			ExpiresAt: now.Add(s.Config.JWT.AccessTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
 		},
-		UserID: id,
+		UserID:        identity.UserID,
+		Role:          identity.Role,
+		EmailVerified: identity.EmailVerified,
+		MFA:           identity.MFA,
+		IssuedAtNano:  now.UnixNano(),
+	}
+
+	return s.Keys.Sign(&tkCl)
+}
+
+func (s *Service) ParseToken(accessToken string) (Identity, error) {
+
+	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, s.Keys.Keyfunc)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	claims, ok := token.Claims.(*tokenClaims)
+	if !ok {
+		return Identity{}, fmt.Errorf("token claims are not of internal type *tokenClaims")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tkCl)
+	// tokens for links (email verification etc.) are signed with the same keys but have no user_id
+	if claims.UserID == "" {
+		return Identity{}, fmt.Errorf("token is not an access token")
+	}
+
+	// tokens issued before iat_ns was added have only seconds
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if claims.IssuedAtNano != 0 {
+		issuedAt = time.Unix(0, claims.IssuedAtNano)
+	}
 
-	return token.SignedString([]byte(signKey))
+	return Identity{
+		UserID:        claims.UserID,
+		Role:          claims.Role,
+		TokenID:       claims.Id,
+		IssuedAt:      issuedAt,
+		ExpiresAt:     time.Unix(claims.ExpiresAt, 0),
+		EmailVerified: claims.EmailVerified,
+		MFA:           claims.MFA,
+	}, nil
 }
 
-func GeneratePasswordHash(password string) (string, error) {
-	hash := sha256.New()
+// CreateSale takes the date as text, it can be in the time zone of the user
+func (s *Service) CreateSale(ctx context.Context, sale salemodel.Sale, date string) (string, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return "", customerr.Unauthorized
+	}
+
+	// only managers can book a sale for another seller
+	if sale.SellerID == "" || !identity.Can(PermissionSaleWriteAny) {
+		sale.SellerID = identity.UserID
+	}
+
+	err := s.validateSale(ctx, &sale, date, sale.SellerID != identity.UserID)
+	if err != nil {
+		return "", err
+	}
 
-	_, err := hash.Write([]byte(password))
+	id, err := s.SaleStorage.Create(ctx, sale)
 	if err != nil {
 		return "", err
 	}
 
-	result := hash.Sum([]byte(salt))
+	sale.ID = id
+	sale.Version = 1
+	sale.CreatedAt = time.Now().UTC()
+	sale.UpdatedAt = sale.CreatedAt
 
-	return fmt.Sprintf("%x", result), nil
+	s.recordRevision(ctx, revisionmodel.ActionCreated, salemodel.Sale{}, sale, 0)
+
+	return id, nil
 }
 
-func (s *Service) ParseToken(accessToken string) (string, error) {
+func (s *Service) GetSale(ctx context.Context, id string) (salemodel.Sale, error) {
+	sale, err := s.SaleStorage.GetOne(ctx, id)
+	if err != nil {
+		return salemodel.Sale{}, err
+	}
 
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(signKey), nil
-	})
+	err = checkOwner(ctx, sale, PermissionSaleReadAny)
+	if err != nil {
+		return salemodel.Sale{}, err
+	}
+
+	return sale, nil
+}
 
+// GetAllSales returns a page of sales, sellers without sale:read:any get only their own sales
+func (s *Service) GetAllSales(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error) {
+	err := checkListFilter(ctx, &filter)
 	if err != nil {
-		return "", err
+		return salemodel.Page{}, err
 	}
 
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return "", fmt.Errorf("invalid signing method")
+	if filter.Limit < 1 {
+		filter.Limit = defaultSaleLimit
 	}
 
-	claims, ok := token.Claims.(*tokenClaims)
+	if filter.Limit > maxSaleLimit {
+		filter.Limit = maxSaleLimit
+	}
+
+	page, err := s.SaleStorage.GetAll(ctx, filter)
+	if errors.Is(err, salemodel.ErrInvalidCursor) {
+		return salemodel.Page{}, customerr.NewCustomError(customerr.BadRequest, "cursor is not valid")
+	}
+
+	return page, err
+}
+
+// ExportSales calls the function for every sale matching the filter of GetAllSales, the sales are not limited.
+// The filter is checked before the first call, so its errors come before anything is written.
+func (s *Service) ExportSales(ctx context.Context, filter salemodel.ListFilter, each func(sale salemodel.Sale) error) error {
+	err := checkListFilter(ctx, &filter)
+	if err != nil {
+		return err
+	}
+
+	filter.Limit = 0
+	filter.Cursor = ""
+
+	return s.SaleStorage.Export(ctx, filter, each)
+}
+
+// checkListFilter limits sellers without sale:read:any to their own sales and checks the sort and the amounts
+func checkListFilter(ctx context.Context, filter *salemodel.ListFilter) error {
+	identity, ok := IdentityFromContext(ctx)
 	if !ok {
-		return "", fmt.Errorf("token claims are not of internal type *tokenClaims")
+		return customerr.Unauthorized
+	}
+
+	if !identity.Can(PermissionSaleReadAny) {
+		if filter.SellerID != "" && filter.SellerID != identity.UserID {
+			return customerr.Forbidden
+		}
+
+		filter.SellerID = identity.UserID
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = "id"
+	}
+
+	if _, ok = salemodel.SortFields[filter.Sort]; !ok {
+		return customerr.NewCustomError(customerr.BadRequest, "sales can't be sorted by "+filter.Sort)
+	}
+
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return customerr.NewCustomError(customerr.BadRequest, "min_amount is more than max_amount")
 	}
 
-	return claims.UserID, nil
+	return nil
 }
 
-//func (s *Service) UpdateUser(ctx context.Context, user usermodel.UserInternal) error {
-//	return s.userstorage.Update(ctx, user)
-//}
-//
-//func (s *Service) DeleteUser(ctx context.Context, id string) error {
-//	return s.userstorage.Delete(ctx, id)
-//}
+// UpdateSale replaces the sale with the one sent, as if it were created again: the currency and the date
+// which are not sent are defaulted like for a new sale. Only the seller is kept if it is not sent.
+// The version is from If-Match, zero if it is not sent. The new version of the sale is returned.
+func (s *Service) UpdateSale(ctx context.Context, sale salemodel.Sale, date string, version int64) (int64, error) {
+	current, err := s.SaleStorage.GetOne(ctx, sale.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkOwner(ctx, current, PermissionSaleWriteAny)
+	if err != nil {
+		return 0, err
+	}
 
-func (s *Service) CreateSale(ctx context.Context, sale salemodel.Sale) (string, error) {
-	return s.SaleStorage.Create(ctx, sale)
+	err = s.checkVersion(current, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.replaceSale(ctx, current, sale, date, version)
 }
 
-func (s *Service) GetSale(ctx context.Context, id string) (salemodel.Sale, error) {
-	return s.SaleStorage.GetOne(ctx, id)
+// PatchSale applies RFC 7396 merge patch to the sale, the merged sale is validated as a whole.
+// The amount which is not in the patch is computed again, so changing the price doesn't conflict with the old amount.
+func (s *Service) PatchSale(ctx context.Context, id string, patch []byte, version int64) (int64, error) {
+	var changes map[string]json.RawMessage
+
+	err := json.Unmarshal(patch, &changes)
+	if err != nil || changes == nil {
+		return 0, customerr.NewCustomError(customerr.BadRequest, "patch has to be JSON object")
+	}
+
+	current, err := s.SaleStorage.GetOne(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkOwner(ctx, current, PermissionSaleWriteAny)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkVersion(current, version)
+	if err != nil {
+		return 0, err
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return 0, err
+	}
+
+	merged, err := mergepatch.Apply(document, patch)
+	if err != nil {
+		return 0, customerr.NewCustomError(customerr.BadRequest, err.Error())
+	}
+
+	var sale struct {
+		salemodel.Sale
+		Date string `json:"date"`
+	}
+
+	err = json.Unmarshal(merged, &sale)
+	if err != nil {
+		return 0, customerr.NewCustomError(customerr.BadRequest, "patched sale is not valid: "+err.Error())
+	}
+
+	sale.ID = current.ID
+	if _, ok := changes["amount"]; !ok {
+		sale.Amount = 0
+	}
+
+	return s.replaceSale(ctx, current, sale.Sale, sale.Date, version)
 }
 
-func (s *Service) GetAllSales(ctx context.Context) ([]salemodel.Sale, error) {
-	return s.SaleStorage.GetAll(ctx)
+// replaceSale keeps the seller if the caller can't change it, the sale is replaced only if it has the version it was read with.
+// The sale is moved to the trash only by DeleteSale, so deleted_at and deleted_by of the request are ignored.
+func (s *Service) replaceSale(ctx context.Context, current salemodel.Sale, sale salemodel.Sale, date string,
+	version int64) (int64, error) {
+	identity, _ := IdentityFromContext(ctx)
+	if sale.SellerID == "" || !identity.Can(PermissionSaleWriteAny) {
+		sale.SellerID = current.SellerID
+	}
+
+	sale.Date = time.Time{}
+	sale.Version = current.Version
+	sale.DeletedAt = nil
+	sale.DeletedBy = ""
+
+	err := s.validateSale(ctx, &sale, date, sale.SellerID != current.SellerID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.SaleStorage.Update(ctx, sale)
+	if err != nil {
+		return 0, versionError(err, version)
+	}
+
+	s.recordRevision(ctx, revisionmodel.ActionUpdated, current, updatedSale(current, sale), 0)
+
+	return current.Version + 1, nil
 }
 
-func (s *Service) UpdateSale(ctx context.Context, sale salemodel.Sale) error {
-	return s.SaleStorage.Update(ctx, sale)
+// DeleteSale moves the sale to the trash, it takes the version from If-Match, zero if it is not sent
+func (s *Service) DeleteSale(ctx context.Context, id string, version int64) error {
+	current, err := s.SaleStorage.GetOne(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = checkOwner(ctx, current, PermissionSaleWriteAny)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkVersion(current, version)
+	if err != nil {
+		return err
+	}
+
+	identity, _ := IdentityFromContext(ctx)
+
+	err = s.SaleStorage.Delete(ctx, id, current.Version, identity.UserID)
+	if err != nil {
+		return versionError(err, version)
+	}
+
+	deleted := updatedSale(current, current)
+	deleted.DeletedAt = &deleted.UpdatedAt
+	deleted.DeletedBy = identity.UserID
+
+	s.recordRevision(ctx, revisionmodel.ActionDeleted, current, deleted, 0)
+
+	return nil
 }
 
-func (s *Service) DeleteSale(ctx context.Context, id string) error {
-	return s.SaleStorage.Delete(ctx, id)
+// checkOwner allows access to the sale for its seller or for the caller with the permission
+func checkOwner(ctx context.Context, sale salemodel.Sale, permission Permission) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return customerr.Unauthorized
+	}
+
+	if sale.SellerID != identity.UserID && !identity.Can(permission) {
+		return customerr.Forbidden
+	}
+
+	return nil
 }
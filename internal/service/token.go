@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/token/tokenmodel"
+	"time"
+)
+
+// TokenPair is a short-lived access token with an opaque refresh token for renewing it
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// Refresh rotates the refresh token: the old one becomes used and a new pair is issued.
+// Presenting an already rotated token means it was stolen, so the whole family is revoked.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (tokens TokenPair, err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeRefresh}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	stored, err := s.TokenStorage.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		s.Logger.Info(err)
+		event.Reason = "unknown refresh token"
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	event.UserID = stored.UserID
+	event.TokenID = stored.ID
+
+	if stored.Revoked || time.Now().After(stored.ExpiresAt) {
+		event.Reason = "refresh token is revoked or expired"
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	if stored.RotatedAt != nil {
+		event.Reason = "reuse of rotated refresh token, the family is revoked"
+		s.revokeFamily(ctx, stored)
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	ok, err := s.TokenStorage.Rotate(ctx, stored.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if !ok {
+		event.Reason = "reuse of rotated refresh token, the family is revoked"
+		s.revokeFamily(ctx, stored)
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	// the role and the email status could be changed since the previous token, so the user is read again
+	user, err := s.UserStorage.GetByID(ctx, stored.UserID)
+	if err != nil {
+		s.Logger.Info(err)
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	if user.Disabled {
+		event.Reason = "account is disabled"
+		return TokenPair{}, customerr.Unauthorized
+	}
+
+	identity := identityOf(user)
+	identity.MFA = stored.MFA
+
+	return s.issueTokenPair(ctx, identity, stored.FamilyID)
+}
+
+// Logout revokes the refresh token together with every token rotated from the same sign-in
+func (s *Service) Logout(ctx context.Context, refreshToken string) (err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeLogout}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	stored, err := s.TokenStorage.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		s.Logger.Info(err)
+		event.Reason = "unknown refresh token"
+		return customerr.Unauthorized
+	}
+
+	event.UserID = stored.UserID
+	event.TokenID = stored.ID
+
+	return s.TokenStorage.RevokeFamily(ctx, stored.FamilyID)
+}
+
+func (s *Service) revokeFamily(ctx context.Context, token tokenmodel.RefreshToken) {
+	s.Logger.Warnf("reuse of refresh token id=%s detected, revoking family %s of user id=%s",
+		token.ID, token.FamilyID, token.UserID)
+
+	err := s.TokenStorage.RevokeFamily(ctx, token.FamilyID)
+	if err != nil {
+		s.Logger.Error(err)
+	}
+}
+
+// issueTokenPair starts a new refresh token family when familyID is empty
+func (s *Service) issueTokenPair(ctx context.Context, identity Identity, familyID string) (TokenPair, error) {
+	accessToken, err := s.GenerateToken(identity)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if familyID == "" {
+		familyID, err = generateOpaqueToken()
+		if err != nil {
+			return TokenPair{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+
+	_, err = s.TokenStorage.Create(ctx, tokenmodel.RefreshToken{
+		Hash:      hashToken(refreshToken),
+		UserID:    identity.UserID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.Config.JWT.RefreshTokenTTL),
+		MFA:       identity.MFA,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.Config.JWT.AccessTokenTTL,
+	}, nil
+}
+
+func generateOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random token: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
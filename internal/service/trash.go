@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/revision/revisionmodel"
+	"nprn/internal/entity/sale/salemodel"
+	"time"
+)
+
+// ListTrash returns a page of deleted sales, it is for the callers who can delete sales
+func (s *Service) ListTrash(ctx context.Context, filter salemodel.ListFilter) (salemodel.Page, error) {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return salemodel.Page{}, customerr.Unauthorized
+	}
+
+	if !identity.Can(PermissionSaleDelete) {
+		return salemodel.Page{}, customerr.Forbidden
+	}
+
+	filter.Deleted = true
+
+	return s.GetAllSales(ctx, filter)
+}
+
+// RestoreSale takes the sale out of the trash, it takes the version from If-Match and returns the new one
+func (s *Service) RestoreSale(ctx context.Context, id string, version int64) (int64, error) {
+	current, err := s.SaleStorage.GetDeleted(ctx, id)
+	if err != nil {
+		s.Logger.Info(err)
+		return 0, customerr.NotFoundErr
+	}
+
+	err = checkOwner(ctx, current, PermissionSaleWriteAny)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkVersion(current, version)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.SaleStorage.Restore(ctx, id, current.Version)
+	if err != nil {
+		return 0, versionError(err, version)
+	}
+
+	restored := updatedSale(current, current)
+	restored.DeletedAt = nil
+	restored.DeletedBy = ""
+
+	s.recordRevision(ctx, revisionmodel.ActionRestored, current, restored, 0)
+
+	s.Logger.Infof("sale id=%s is restored", id)
+
+	return current.Version + 1, nil
+}
+
+// PurgeTrash removes sales which are in the trash longer than sales.trash_retention
+func (s *Service) PurgeTrash(ctx context.Context) (int64, error) {
+	if s.Config.Sales.TrashRetention <= 0 {
+		return 0, nil
+	}
+
+	count, err := s.SaleStorage.Purge(ctx, time.Now().UTC().Add(-s.Config.Sales.TrashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	if count != 0 {
+		s.Logger.Infof("%d sales are purged from the trash", count)
+	}
+
+	return count, nil
+}
+
+// RunTrashPurge purges the trash every sales.purge_interval until the context is canceled
+func (s *Service) RunTrashPurge(ctx context.Context) {
+	if s.Config.Sales.TrashRetention <= 0 || s.Config.Sales.PurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.Config.Sales.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeCtx, cancel := context.WithTimeout(ctx, backgroundTimeout)
+		_, err := s.PurgeTrash(purgeCtx)
+		cancel()
+
+		if err != nil {
+			s.Logger.Error(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
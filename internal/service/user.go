@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/user/usermodel"
+	"nprn/pkg/mail"
+	"time"
+)
+
+// UserUpdate has the fields the user can change, nil fields are kept
+type UserUpdate struct {
+	Username *string
+	Email    *string
+	// TimeZone is IANA name, empty removes it
+	TimeZone *string
+}
+
+var errWrongPassword = customerr.NewCustomError(customerr.Forbidden, "forbidden: password is wrong")
+
+func (s *Service) GetMe(ctx context.Context) (usermodel.UserTransfer, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return usermodel.UserTransfer{}, err
+	}
+
+	user.Role = roleOf(user)
+
+	return usermodel.NewUserTransfer(user), nil
+}
+
+// UpdateMe changes the username, the email or the time zone, a new email has to be verified again
+func (s *Service) UpdateMe(ctx context.Context, update UserUpdate) (transfer usermodel.UserTransfer, err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeAccountUpdated}, err) }()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return usermodel.UserTransfer{}, err
+	}
+
+	if update.Username != nil && *update.Username != user.Username {
+		username, key, err := parseUsername(*update.Username)
+		if err != nil {
+			return usermodel.UserTransfer{}, err
+		}
+
+		// only the case can be changed without a check
+		if key != user.UsernameKey {
+			other, err := s.UserStorage.GetByUsername(ctx, key)
+			if err == nil && other.ID != user.ID {
+				return usermodel.UserTransfer{}, conflictOf(&usermodel.DuplicateError{Field: "username"})
+			}
+		}
+
+		user.Username = username
+		user.UsernameKey = key
+	}
+
+	emailChanged := false
+
+	if update.Email != nil && usermodel.NormalizeEmail(*update.Email) != user.Email {
+		email, err := parseEmail(*update.Email)
+		if err != nil {
+			return usermodel.UserTransfer{}, err
+		}
+
+		user.Email = email
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+		emailChanged = true
+	}
+
+	if update.TimeZone != nil {
+		err = checkTimeZone(*update.TimeZone)
+		if err != nil {
+			return usermodel.UserTransfer{}, err
+		}
+
+		user.TimeZone = *update.TimeZone
+	}
+
+	err = s.UserStorage.UpdateProfile(ctx, user)
+	if err != nil {
+		if conflict := conflictOf(err); conflict != nil {
+			return usermodel.UserTransfer{}, conflict
+		}
+		return usermodel.UserTransfer{}, err
+	}
+
+	if emailChanged {
+		err = s.sendVerification(ctx, user)
+		if err != nil {
+			s.Logger.Error(err)
+		}
+	}
+
+	user.Role = roleOf(user)
+
+	return usermodel.NewUserTransfer(user), nil
+}
+
+// DeleteMe deletes the account after checking the password, all its sessions are revoked
+func (s *Service) DeleteMe(ctx context.Context, password string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypeAccountDeleted}, err) }()
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.confirmPassword(ctx, user, password)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.Delete(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("user id=%s is deleted by themselves", user.ID)
+
+	return s.RevokeAllTokens(ctx, user.ID, time.Now())
+}
+
+// ChangePassword sets the new password if the current one is right, all sessions are revoked,
+// so the user signs in again with the new password
+func (s *Service) ChangePassword(ctx context.Context, currentPassword string, newPassword string) (err error) {
+	defer func() { s.auditResult(ctx, auditmodel.Event{Type: auditmodel.TypePasswordChanged}, err) }()
+
+	if newPassword == "" {
+		return customerr.NewCustomError(customerr.BadRequest, "new password is empty")
+	}
+
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.confirmPassword(ctx, user, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	passHash, err := s.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.UserStorage.UpdatePassword(ctx, user.ID, passHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.RevokeAllTokens(ctx, user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Infof("password of user id=%s is changed", user.ID)
+
+	s.notifyPasswordChanged(ctx, user)
+
+	return nil
+}
+
+// confirmPassword is limited by the lockout, so a stolen access token doesn't help to guess the password
+func (s *Service) confirmPassword(ctx context.Context, user usermodel.UserInternal, password string) error {
+	err := s.checkLockout(ctx, user.UsernameKey, "")
+	if err != nil {
+		return err
+	}
+
+	ok, _ := s.checkPassword(password, user.PasswordHash)
+	if !ok {
+		err = s.addFailure(ctx, s.lockoutKeys(user.UsernameKey, ""))
+		if err != nil {
+			return err
+		}
+		return errWrongPassword
+	}
+
+	return nil
+}
+
+// parseUsername returns the username to show and its key, see usermodel.NormalizeUsername
+func parseUsername(username string) (string, string, error) {
+	display, key, err := usermodel.NormalizeUsername(username)
+	if err != nil {
+		return "", "", customerr.NewCustomError(customerr.BadRequest,
+			"username is not valid: letters, digits and symbols without spaces are allowed")
+	}
+
+	return display, key, nil
+}
+
+// checkTimeZone accepts an IANA name or empty for no time zone, "Local" would be the zone of the server
+func checkTimeZone(name string) error {
+	_, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return customerr.NewCustomError(customerr.BadRequest, "time zone is not IANA name")
+	}
+
+	return nil
+}
+
+// conflictOf turns a duplicate from the storage into 409 Conflict naming the field
+func conflictOf(err error) error {
+	var duplicate *usermodel.DuplicateError
+	if !errors.As(err, &duplicate) {
+		return nil
+	}
+
+	return customerr.NewConflictError(duplicate.Field, duplicate.Error())
+}
+
+func (s *Service) notifyPasswordChanged(ctx context.Context, user usermodel.UserInternal) {
+	err := s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hello, %s!\n\nThe password of your account was changed and you were signed out "+
+			"on all devices.\nIf it wasn't you, contact support.\n", user.Username),
+	})
+	if err != nil {
+		s.Logger.Error(err)
+	}
+}
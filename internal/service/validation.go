@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/sale/salemodel"
+	"nprn/pkg/money"
+	"strings"
+	"time"
+)
+
+type sellersKey struct{}
+
+// withSellers keeps the sellers which are looked up for the work on many sales, so every seller is looked up once
+func withSellers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sellersKey{}, make(map[string]bool))
+}
+
+// sellerExists is false for the user who is not found or disabled
+func (s *Service) sellerExists(ctx context.Context, sellerID string) bool {
+	sellers, cached := ctx.Value(sellersKey{}).(map[string]bool)
+	if cached {
+		if exists, ok := sellers[sellerID]; ok {
+			return exists
+		}
+	}
+
+	user, err := s.UserStorage.GetByID(ctx, sellerID)
+	if err != nil {
+		s.Logger.Info(err)
+	}
+
+	exists := err == nil && !user.Disabled
+
+	if cached {
+		sellers[sellerID] = exists
+	}
+
+	return exists
+}
+
+// validateSale checks all fields at once and computes the amount as price_for_one * number_of_units
+// rounded half away from zero to the minor unit of the currency. The price for one is kept with money.Scale
+// digits because it can be a fraction of the minor unit. The seller is looked up only when it is changed,
+// the seller from the token exists. The date is parsed if it is sent, a new sale without it is dated now.
+func (s *Service) validateSale(ctx context.Context, sale *salemodel.Sale, date string, checkSeller bool) error {
+	var fields []customerr.FieldError
+
+	invalid := func(field string, message string) {
+		fields = append(fields, customerr.FieldError{Field: field, Message: message})
+	}
+
+	sale.Article = strings.TrimSpace(sale.Article)
+	if sale.Article == "" {
+		invalid("article", "article is required")
+	}
+
+	if date != "" {
+		parsed, err := s.parseSaleDate(ctx, date)
+		if err != nil {
+			invalid("date", "date has to be RFC 3339 time or YYYY-MM-DD")
+		}
+
+		sale.Date = parsed
+	} else if sale.Date.IsZero() {
+		sale.Date = time.Now().UTC()
+	}
+
+	if sale.NumberOfUnits <= 0 {
+		invalid("number_of_units", "number_of_units has to be positive")
+	}
+
+	if sale.PriceForOne < 0 {
+		invalid("price_for_one", "price_for_one can't be negative")
+	}
+
+	if checkSeller && !s.sellerExists(ctx, sale.SellerID) {
+		invalid("seller_id", "seller is not found")
+	}
+
+	sale.Currency = strings.ToUpper(strings.TrimSpace(sale.Currency))
+	if sale.Currency == "" {
+		sale.Currency = s.Config.Sales.DefaultCurrency
+	}
+
+	digits, ok := money.MinorDigits(sale.Currency)
+	if !ok {
+		invalid("currency", "currency is not ISO 4217 code")
+	}
+
+	if ok && sale.NumberOfUnits > 0 && sale.PriceForOne >= 0 {
+		amount, err := sale.PriceForOne.Mul(int64(sale.NumberOfUnits))
+		if err != nil {
+			invalid("amount", "amount is too large")
+		} else {
+			amount = amount.Round(digits)
+
+			// zero is an amount which wasn't sent
+			if s.Config.Sales.StrictAmount && sale.Amount != 0 && sale.Amount.Round(digits) != amount {
+				invalid("amount", "amount has to be price_for_one * number_of_units = "+amount.String())
+			}
+
+			sale.Amount = amount
+		}
+	}
+
+	if len(fields) > 0 {
+		return customerr.NewValidationError(fields)
+	}
+
+	return nil
+}
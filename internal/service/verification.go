@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/audit/auditmodel"
+	"nprn/internal/entity/user/usermodel"
+	"nprn/pkg/mail"
+	"strings"
+	"time"
+)
+
+const purposeVerifyEmail = "verify-email"
+
+var errVerificationLink = customerr.NewCustomError(customerr.BadRequest, "verification link is not valid or expired")
+
+// parseEmail accepts only a bare address like "anna@test.com" and returns it lower-cased
+func parseEmail(email string) (string, error) {
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != strings.TrimSpace(email) {
+		return "", customerr.NewCustomError(customerr.BadRequest, "email is not valid")
+	}
+
+	return usermodel.NormalizeEmail(address.Address), nil
+}
+
+func (s *Service) sendVerification(ctx context.Context, user usermodel.UserInternal) error {
+	token, err := s.signActionToken(purposeVerifyEmail, user.ID, bindingOf(user.Email), s.Config.Verification.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.Config.Verification.LinkURL + "?token=" + url.QueryEscape(token)
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo confirm your email open the link:\n\n%s\n\n"+
+			"The link is valid for %v. If you didn't sign up, ignore this email.\n",
+			user.Username, link, s.Config.Verification.TokenTTL),
+	})
+}
+
+// VerifyEmail marks the email verified, the link works once and only for the email it was sent to
+func (s *Service) VerifyEmail(ctx context.Context, token string) (err error) {
+	event := auditmodel.Event{Type: auditmodel.TypeEmailVerified}
+	defer func() { s.auditResult(ctx, event, err) }()
+
+	claims, ok := s.parseActionToken(token, purposeVerifyEmail)
+	if !ok {
+		return errVerificationLink
+	}
+
+	event.UserID = claims.Subject
+
+	user, err := s.UserStorage.GetByID(ctx, claims.Subject)
+	if err != nil {
+		s.Logger.Info(err)
+		return errVerificationLink
+	}
+
+	if user.EmailVerified || claims.Binding != bindingOf(user.Email) {
+		return errVerificationLink
+	}
+
+	ok, err = s.UserStorage.SetEmailVerified(ctx, user.ID, user.Email, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errVerificationLink
+	}
+
+	s.Logger.Infof("email of user id=%s is verified", user.ID)
+
+	return nil
+}
+
+// ResendVerification sends a new link to the signed-in user
+func (s *Service) ResendVerification(ctx context.Context) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return customerr.Unauthorized
+	}
+
+	user, err := s.UserStorage.GetByID(ctx, identity.UserID)
+	if err != nil {
+		s.Logger.Info(err)
+		return customerr.NotFoundErr
+	}
+
+	if user.EmailVerified {
+		return customerr.NewCustomError(customerr.BadRequest, "email is already verified")
+	}
+
+	cfg := s.Config.Verification
+
+	err = s.rateLimit(ctx, "verify:"+user.ID, cfg.ResendInterval, cfg.ResendLimit, cfg.ResendWindow,
+		"verification email was sent recently, try again later")
+	if err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, user)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"nprn/internal/customerr"
+	"nprn/internal/entity/sale/salemodel"
+)
+
+// AnyVersion is the version of If-Match: *, the sale has to exist but its version is not compared
+const AnyVersion int64 = -1
+
+var errVersionChanged = customerr.NewCustomError(customerr.PreconditionFailed,
+	"sale was changed by another request, get it again")
+
+// checkVersion compares the version from If-Match with the current one, zero is a request without If-Match.
+// With sales.require_if_match the request without it is rejected, so the client can't overwrite changes it hasn't seen.
+// AnyVersion meets the requirement, the sale is already found.
+func (s *Service) checkVersion(current salemodel.Sale, version int64) error {
+	if version == AnyVersion {
+		return nil
+	}
+
+	if version == 0 {
+		if s.Config.Sales.RequireIfMatch {
+			return customerr.NewCustomError(customerr.PreconditionRequired, "If-Match header is required")
+		}
+
+		return nil
+	}
+
+	if version != current.Version {
+		return errVersionChanged
+	}
+
+	return nil
+}
+
+// versionError is for the sale changed between reading and writing it. The client which sent the ETag in If-Match
+// gets Precondition Failed, the client which didn't or sent "*" gets Conflict.
+func versionError(err error, version int64) error {
+	if !errors.Is(err, salemodel.ErrVersionConflict) {
+		return err
+	}
+
+	if version > 0 {
+		return errVersionChanged
+	}
+
+	return customerr.NewCustomError(customerr.Conflict, "sale was changed by another request, try again")
+}
@@ -0,0 +1,202 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"sort"
+)
+
+// Key is one signing or verification key, identified by the "kid" header of a token
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// JSONWebKey is a public key in RFC 7517 format
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewHMACKey creates a symmetric key, such keys are never published in JWKS
+func NewHMACKey(id string, algorithm string, secret []byte) (*Key, error) {
+	method, ok := jwt.GetSigningMethod(algorithm).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("key %s: algorithm %s is not HMAC", id, algorithm)
+	}
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("key %s: secret is empty", id)
+	}
+
+	return &Key{ID: id, Method: method, signKey: secret, verifyKey: secret}, nil
+}
+
+// ParsePEMKey creates an asymmetric key from PEM data. A private key can sign and verify tokens,
+// a public key can only verify them (e.g. an old key which is still accepted after rotation).
+func ParsePEMKey(id string, algorithm string, data []byte) (*Key, error) {
+	key := &Key{ID: id, Method: jwt.GetSigningMethod(algorithm)}
+
+	switch method := key.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %s: failed to parse RSA key: %v", id, err)
+		}
+
+	case *jwt.SigningMethodECDSA:
+		var public *ecdsa.PublicKey
+
+		if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			key.signKey, public = private, &private.PublicKey
+		} else if public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("key %s: failed to parse EC key: %v", id, err)
+		}
+
+		if public.Curve.Params().BitSize != method.CurveBits {
+			return nil, fmt.Errorf("key %s: curve %s does not match %s", id, public.Curve.Params().Name, algorithm)
+		}
+
+		key.verifyKey = public
+
+	case *jwt.SigningMethodEd25519:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %s: failed to parse Ed25519 key: %v", id, err)
+		}
+
+	default:
+		return nil, fmt.Errorf("key %s: algorithm %s is not supported", id, algorithm)
+	}
+
+	return key, nil
+}
+
+// KeySet signs tokens with one key and verifies them with any of its keys
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeySet(signingKeyID string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+
+	for _, key := range keys {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("key %s is duplicated", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	signing, ok := ks.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not found", signingKeyID)
+	}
+
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %s has no private part", signingKeyID)
+	}
+
+	ks.signing = signing
+
+	return ks, nil
+}
+
+// Sign returns a signed token with the "kid" header of the signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Keyfunc is used by jwt.Parse, the algorithm of a token must match the algorithm of its key
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("algorithm %s is not allowed for key %s", token.Method.Alg(), kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWKS returns all public keys, symmetric keys are skipped
+func (ks *KeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range ks.keys {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = encode(public.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = curveName(public.Curve)
+			jwk.X = encode(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = encode(public.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = encode(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+
+	return set
+}
+
+func curveName(curve elliptic.Curve) string {
+	switch curve {
+	case elliptic.P256():
+		return "P-256"
+	case elliptic.P384():
+		return "P-384"
+	case elliptic.P521():
+		return "P-521"
+	}
+	return curve.Params().Name
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestKeySet_Rotation(t *testing.T) {
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	oldKey, err := ParsePEMKey("old", "ES256", marshalPEM(t, ecPrivate))
+	require.NoError(t, err)
+
+	newKey, err := ParsePEMKey("new", "EdDSA", marshalPEM(t, edPrivate))
+	require.NoError(t, err)
+
+	hmacKey, err := NewHMACKey("secret", "HS256", []byte("secret"))
+	require.NoError(t, err)
+
+	oldSet, err := NewKeySet("old", oldKey)
+	require.NoError(t, err)
+
+	newSet, err := NewKeySet("new", newKey, oldKey, hmacKey)
+	require.NoError(t, err)
+
+	claims := &jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	oldToken, err := oldSet.Sign(claims)
+	require.NoError(t, err)
+
+	newToken, err := newSet.Sign(claims)
+	require.NoError(t, err)
+
+	parsed, err := jwt.Parse(oldToken, newSet.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "old", parsed.Header["kid"])
+
+	parsed, err = jwt.Parse(newToken, newSet.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	_, err = jwt.Parse(newToken, oldSet.Keyfunc)
+	assert.Error(t, err)
+
+	set := newSet.JWKS()
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, "new", set.Keys[0].KeyID)
+	assert.Equal(t, "OKP", set.Keys[0].KeyType)
+	assert.Equal(t, "old", set.Keys[1].KeyID)
+	assert.Equal(t, "EC", set.Keys[1].KeyType)
+	assert.Equal(t, "P-256", set.Keys[1].Curve)
+}
+
+func TestKeySet_AlgorithmMismatch(t *testing.T) {
+	hmacKey, err := NewHMACKey("secret", "HS256", []byte("secret"))
+	require.NoError(t, err)
+
+	set, err := NewKeySet("secret", hmacKey)
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, &jwt.StandardClaims{})
+	token.Header["kid"] = "secret"
+
+	signed, err := token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, set.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestNewKeySet_PublicKeyCannotSign(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	key, err := ParsePEMKey("public", "EdDSA", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	_, err = NewKeySet("public", key)
+	assert.Error(t, err)
+}
+
+func marshalPEM(t *testing.T, private interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
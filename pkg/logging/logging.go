@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 var entry *logrus.Entry
@@ -63,21 +65,28 @@ func init() {
 		DisableColors: false,
 	}
 
-	err := os.MkdirAll("logs", 0755)
-	if err != nil {
-		log.Println(err)
-	}
+	writers := []io.Writer{os.Stdout}
 
-	logFile, err := os.OpenFile("logs/all.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		log.Println(err)
+	// tests log only to os.Stdout, so they don't leave log files in the package directories
+	if !isTest() {
+		err := os.MkdirAll("logs", 0755)
+		if err != nil {
+			log.Println(err)
+		}
+
+		logFile, err := os.OpenFile("logs/all.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Println(err)
+		} else {
+			writers = append(writers, logFile)
+		}
 	}
 
 	l.SetOutput(io.Discard) // set default output is nothing
 
 	// set custom output in logFile and os.Stdout
 	l.AddHook(&writerHook{
-		Writer:   []io.Writer{logFile, os.Stdout},
+		Writer:   writers,
 		LogLevel: logrus.AllLevels,
 	})
 
@@ -85,3 +94,10 @@ func init() {
 
 	entry = logrus.NewEntry(l)
 }
+
+// isTest reports if the program is a binary built by go test
+func isTest() bool {
+	name := strings.TrimSuffix(path.Base(filepath.ToSlash(os.Args[0])), ".exe")
+
+	return strings.HasSuffix(name, ".test")
+}
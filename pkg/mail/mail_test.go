@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+
+	mailer, err := NewOutboxMailer(dir, "noreply@nprn.local")
+	require.NoError(t, err)
+
+	err = mailer.Send(context.Background(), Message{To: "anna@test.com", Subject: "Hello", Body: "line 1\nline 2"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-anna@test.com.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "To: anna@test.com\r\n")
+	assert.Contains(t, string(data), "Subject: Hello\r\n")
+	assert.Contains(t, string(data), "\r\n\r\nline 1\r\nline 2")
+}
@@ -0,0 +1,64 @@
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Apply applies RFC 7396 JSON Merge Patch to the document: members of the patch replace members
+// of the document, objects are merged recursively and null removes a member. Numbers are kept as they are written.
+func Apply(document []byte, patch []byte) ([]byte, error) {
+	target, err := decode(document)
+	if err != nil {
+		return nil, fmt.Errorf("document is not valid JSON: %v", err)
+	}
+
+	changes, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("patch is not valid JSON: %v", err)
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, fmt.Errorf("data after the value")
+	}
+
+	return value, nil
+}
+
+func merge(target interface{}, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{}, len(changes))
+	}
+
+	for name, value := range changes {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+
+		result[name] = merge(result[name], value)
+	}
+
+	return result
+}
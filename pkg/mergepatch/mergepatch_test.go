@@ -0,0 +1,52 @@
+package mergepatch
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// the examples of RFC 7396 appendix A
+func TestApply_RFC7396(t *testing.T) {
+	testTable := []struct {
+		document string
+		patch    string
+		excepted string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, testCase := range testTable {
+		result, err := Apply([]byte(testCase.document), []byte(testCase.patch))
+		require.NoError(t, err)
+		assert.JSONEq(t, testCase.excepted, string(result), "%s + %s", testCase.document, testCase.patch)
+	}
+}
+
+func TestApply_Numbers(t *testing.T) {
+	result, err := Apply([]byte(`{"a":12345678901234567890.123456789}`), []byte(`{"b":0.1}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":12345678901234567890.123456789,"b":0.1}`, string(result))
+}
+
+func TestApply_NotJSON(t *testing.T) {
+	_, err := Apply([]byte(`{}`), []byte(`{"a":`))
+	assert.Error(t, err)
+
+	_, err = Apply([]byte(`{}`), []byte(`{} {}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of fractional digits kept by Decimal, enough for unit prices in fractions of a cent
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+// Decimal is an exact decimal number with Scale fractional digits, 240.8 is Decimal(2408000).
+// It is a string in JSON (numbers are accepted too) and Decimal128 in BSON.
+type Decimal int64
+
+// currencies are ISO 4217 codes with the number of digits of their minor unit
+var currencies = map[string]int{
+	"AED": 2, "AMD": 2, "AUD": 2, "AZN": 2, "BHD": 3, "BRL": 2, "BYN": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2,
+	"INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KGS": 2, "KRW": 0, "KWD": 3, "KZT": 2, "MDL": 2, "MXN": 2,
+	"NOK": 2, "NZD": 2, "OMR": 3, "PLN": 2, "RON": 2, "RSD": 2, "RUB": 2, "SEK": 2, "SGD": 2, "THB": 2,
+	"TJS": 2, "TND": 3, "TRY": 2, "UAH": 2, "USD": 2, "UZS": 2, "VND": 0, "ZAR": 2,
+}
+
+// MinorDigits returns the number of digits of the minor unit of the ISO 4217 currency
+func MinorDigits(currency string) (int, bool) {
+	digits, ok := currencies[currency]
+	return digits, ok
+}
+
+// Parse accepts plain decimal notation like "-240.8", more than Scale fractional digits are an error
+// rather than silently rounded
+func Parse(value string) (Decimal, error) {
+	text := value
+
+	negative := strings.HasPrefix(text, "-")
+	if negative || strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+
+	whole, fraction := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		whole, fraction = text[:i], text[i+1:]
+	}
+
+	if whole == "" && fraction == "" || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return 0, fmt.Errorf("%q is not a decimal number", value)
+	}
+
+	if len(fraction) > Scale {
+		return 0, fmt.Errorf("%q has more than %d fractional digits", value, Scale)
+	}
+
+	number, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", Scale-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is out of range", value)
+	}
+
+	if negative {
+		number = -number
+	}
+
+	return Decimal(number), nil
+}
+
+func digitsOnly(text string) bool {
+	for _, char := range text {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FromFloat rounds the float to Scale digits, it is for documents stored before Decimal
+func FromFloat(value float64) (Decimal, error) {
+	scaled := math.Round(value * unit)
+	if math.IsNaN(scaled) || scaled > math.MaxInt64 || scaled < math.MinInt64 {
+		return 0, fmt.Errorf("%v is out of range", value)
+	}
+
+	return Decimal(scaled), nil
+}
+
+// String returns the number without trailing zeros: "240.8", "222"
+func (d Decimal) String() string {
+	sign := ""
+	number := uint64(d)
+	if d < 0 {
+		sign = "-"
+		number = uint64(-d)
+	}
+
+	whole := strconv.FormatUint(number/unit, 10)
+	fraction := strings.TrimRight(fmt.Sprintf("%0*d", Scale, number%unit), "0")
+
+	if fraction == "" {
+		return sign + whole
+	}
+
+	return sign + whole + "." + fraction
+}
+
+// Round rounds half away from zero to the digits after the point, it is how receipts are rounded
+func (d Decimal) Round(digits int) Decimal {
+	if digits >= Scale {
+		return d
+	}
+
+	factor := Decimal(1)
+	for i := digits; i < Scale; i++ {
+		factor *= 10
+	}
+
+	quotient, remainder := d/factor, d%factor
+	if remainder < 0 {
+		remainder = -remainder
+	}
+
+	if remainder*2 >= factor {
+		if d < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+
+	return quotient * factor
+}
+
+// Mul multiplies by a whole number
+func (d Decimal) Mul(n int64) (Decimal, error) {
+	if n != 0 && (int64(d)*n/n != int64(d) || int64(d) == math.MinInt64 && n == -1) {
+		return 0, fmt.Errorf("%s * %d is out of range", d, n)
+	}
+
+	return Decimal(int64(d) * n), nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return err
+		}
+	}
+
+	number, err := Parse(text)
+	if err != nil {
+		return err
+	}
+
+	*d = number
+
+	return nil
+}
+
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	number, err := primitive.ParseDecimal128(d.String())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return bson.MarshalValue(number)
+}
+
+// UnmarshalBSONValue also reads doubles and integers of documents stored before Decimal
+func (d *Decimal) UnmarshalBSONValue(valueType bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: valueType, Value: data}
+
+	switch valueType {
+	case bsontype.Decimal128:
+		return d.fromDecimal128(value.Decimal128())
+	case bsontype.Double:
+		number, err := FromFloat(value.Double())
+		if err != nil {
+			return err
+		}
+
+		*d = number
+	case bsontype.Int32:
+		*d = Decimal(int64(value.Int32()) * unit)
+	case bsontype.Int64:
+		number, err := Decimal(value.Int64()).Mul(unit)
+		if err != nil {
+			return err
+		}
+
+		*d = number
+	case bsontype.Null:
+		*d = 0
+	default:
+		return fmt.Errorf("cannot decode %v into money.Decimal", valueType)
+	}
+
+	return nil
+}
+
+func (d *Decimal) fromDecimal128(value primitive.Decimal128) error {
+	coefficient, exponent, err := value.BigInt()
+	if err != nil {
+		return err
+	}
+
+	// the coefficient is scaled to Scale fractional digits, the value is coefficient * 10^exponent
+	shift := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponent+Scale))), nil)
+	if exponent+Scale >= 0 {
+		coefficient.Mul(coefficient, shift)
+	} else {
+		coefficient.Quo(coefficient, shift)
+	}
+
+	if !coefficient.IsInt64() {
+		return fmt.Errorf("%s is out of range", value)
+	}
+
+	*d = Decimal(coefficient.Int64())
+
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,105 @@
+package money
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testTable := []struct {
+		value       string
+		excepted    Decimal
+		exceptedErr bool
+	}{
+		{value: "240.8", excepted: 2408000},
+		{value: "-0.0125", excepted: -125},
+		{value: "222", excepted: 2220000},
+		{value: ".5", excepted: 5000},
+		{value: "0.00001", exceptedErr: true},
+		{value: "1e3", exceptedErr: true},
+		{value: "", exceptedErr: true},
+		{value: ".", exceptedErr: true},
+		{value: "99999999999999999", exceptedErr: true},
+	}
+
+	for _, testCase := range testTable {
+		number, err := Parse(testCase.value)
+		if testCase.exceptedErr {
+			assert.Error(t, err, testCase.value)
+			continue
+		}
+
+		require.NoError(t, err, testCase.value)
+		assert.Equal(t, testCase.excepted, number, testCase.value)
+	}
+}
+
+func TestDecimal_String(t *testing.T) {
+	assert.Equal(t, "240.8", Decimal(2408000).String())
+	assert.Equal(t, "-0.0125", Decimal(-125).String())
+	assert.Equal(t, "0", Decimal(0).String())
+}
+
+func TestDecimal_Round(t *testing.T) {
+	assert.Equal(t, "0.13", Decimal(1250).Round(2).String())
+	assert.Equal(t, "-0.13", Decimal(-1250).Round(2).String())
+	assert.Equal(t, "0.12", Decimal(1249).Round(2).String())
+	assert.Equal(t, "241", Decimal(2405000).Round(0).String())
+}
+
+func TestDecimal_Mul(t *testing.T) {
+	// 3 * 0.1 is 0.30000000000000004 in float64
+	number, err := Decimal(1000).Mul(3)
+	require.NoError(t, err)
+	assert.Equal(t, "0.3", number.String())
+
+	_, err = Decimal(1 << 62).Mul(4)
+	assert.Error(t, err)
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	var price struct {
+		Price Decimal `json:"price"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"price":"240.8"}`), &price))
+	assert.Equal(t, Decimal(2408000), price.Price)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"price":240.8}`), &price))
+	assert.Equal(t, Decimal(2408000), price.Price)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"price":"many"}`), &price))
+
+	data, err := json.Marshal(price)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"price":"240.8"}`, string(data))
+}
+
+func TestDecimal_BSON(t *testing.T) {
+	var price struct {
+		Price Decimal `bson:"price"`
+	}
+
+	data, err := bson.Marshal(struct {
+		Price Decimal `bson:"price"`
+	}{Price: 2408000})
+	require.NoError(t, err)
+	assert.Equal(t, `{"price": {"$numberDecimal":"240.8"}}`, bson.Raw(data).String())
+
+	require.NoError(t, bson.Unmarshal(data, &price))
+	assert.Equal(t, Decimal(2408000), price.Price)
+
+	// documents stored with float64
+	data, err = bson.Marshal(bson.M{"price": 240.8})
+	require.NoError(t, err)
+	require.NoError(t, bson.Unmarshal(data, &price))
+	assert.Equal(t, Decimal(2408000), price.Price)
+
+	data, err = bson.Marshal(bson.M{"price": int64(-3)})
+	require.NoError(t, err)
+	require.NoError(t, bson.Unmarshal(data, &price))
+	assert.Equal(t, Decimal(-30000), price.Price)
+}
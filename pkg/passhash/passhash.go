@@ -0,0 +1,114 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+var ErrInvalidHash = errors.New("hash is not in argon2id PHC format")
+
+// Params of argon2id, memory is in KiB
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hash returns a PHC string like $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func Hash(password string, p Params) (string, error) {
+	salt := make([]byte, p.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// IsPHC reports whether the hash was made by Hash, other hashes are legacy ones
+func IsPHC(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Verify compares the password with the hash in constant time and returns the params the hash was made with
+func Verify(password string, hash string) (bool, Params, error) {
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return false, Params{}, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, other) == 1, p, nil
+}
+
+// NeedsRehash reports whether the hash is not made by Hash with the params, so it should be replaced
+// after the password is verified
+func NeedsRehash(hash string, p Params) bool {
+	current, _, _, err := decode(hash)
+
+	return err != nil || current != p
+}
+
+func decode(hash string) (Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("argon2 version %d is not supported", version)
+	}
+
+	var p Params
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	// argon2 panics on zero params
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	// an empty key would be equal to the empty key of any password
+	if len(salt) == 0 || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
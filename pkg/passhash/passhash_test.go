@@ -0,0 +1,70 @@
+package passhash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHash(t *testing.T) {
+	hash, err := Hash("AnnaTestPass", testParams)
+	require.NoError(t, err)
+	assert.True(t, IsPHC(hash))
+
+	ok, params, err := Verify("AnnaTestPass", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, testParams, params)
+
+	ok, _, err = Verify("WrongPass", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	other, err := Hash("AnnaTestPass", testParams)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt has to be random")
+}
+
+func TestVerify_InvalidHash(t *testing.T) {
+	testTable := []struct {
+		name string
+		hash string
+	}{
+		{"legacy hash", "34687364386a6437667364329f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{"not base64 salt", "$argon2id$v=19$m=1024,t=1,p=1$!!!$c29tZWtleQ"},
+		{"not base64 key", "$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$!!!"},
+		{"no params", "$argon2id$v=19$$c29tZXNhbHQ$c29tZWtleQ"},
+		{"zero iterations", "$argon2id$v=19$m=1024,t=0,p=1$c29tZXNhbHQ$c29tZWtleQ"},
+		{"zero parallelism", "$argon2id$v=19$m=1024,t=1,p=0$c29tZXNhbHQ$c29tZWtleQ"},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$c29tZXNhbHQ$c29tZWtleQ"},
+		{"empty salt", "$argon2id$v=19$m=1024,t=1,p=1$$c29tZWtleQ"},
+		{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			ok, _, err := Verify("any password", testCase.hash)
+			assert.ErrorIs(t, err, ErrInvalidHash)
+			assert.False(t, ok)
+		})
+	}
+
+	_, _, err := Verify("any password", "$argon2id$v=16$m=1024,t=1,p=1$c29tZXNhbHQ$c29tZWtleQ")
+	assert.Error(t, err)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := Hash("AnnaTestPass", testParams)
+	require.NoError(t, err)
+
+	assert.False(t, NeedsRehash(hash, testParams))
+
+	stronger := testParams
+	stronger.Iterations = 3
+	assert.True(t, NeedsRehash(hash, stronger))
+
+	assert.True(t, NeedsRehash("34687364386a6437667364329f86d081884c7d659a2feaa0c55ad015a3bf4f1b", testParams))
+}
@@ -12,6 +12,11 @@ import (
 	"time"
 )
 
+// WriteTimeout is the time a handler has to write its response, long responses move it by SetWriteDeadline
+const WriteTimeout = 10 * time.Second
+
+type connKey struct{}
+
 type Server struct {
 	httpServer *http.Server
 }
@@ -49,12 +54,29 @@ func (s *Server) Run(handler http.Handler, logger *logging.Logger, cfg *config.C
 	s.httpServer = &http.Server{
 		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: WriteTimeout,
+		ConnContext:  ConnContext,
 	}
 
 	return s.httpServer.Serve(listener)
 }
 
+// ConnContext keeps the connection in the context of its requests for SetWriteDeadline
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// SetWriteDeadline moves the write deadline of the connection of the request, the server sets it again
+// for the next request. Requests which didn't come through the server, like in tests, are not changed.
+func SetWriteDeadline(ctx context.Context, deadline time.Time) error {
+	conn, ok := ctx.Value(connKey{}).(net.Conn)
+	if !ok {
+		return nil
+	}
+
+	return conn.SetWriteDeadline(deadline)
+}
+
 func (s *Server) Close(ctx context.Context) error {
 	ctx.Done()
 
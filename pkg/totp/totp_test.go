@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// base32 of the RFC 6238 SHA-1 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode_RFC6238(t *testing.T) {
+	// the RFC has 8 digit codes, 6 digit codes are their last digits
+	testTable := []struct {
+		unix     int64
+		excepted string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, testCase := range testTable {
+		code, err := Code(rfcSecret, Counter(time.Unix(testCase.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, testCase.excepted, code, "time %d", testCase.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	counter, ok := Validate(rfcSecret, "050471", now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	// the code of the previous step is accepted with skew 1 only
+	previous, _ := Code(rfcSecret, Counter(now)-1)
+
+	_, ok = Validate(rfcSecret, previous, now, 1)
+	assert.True(t, ok)
+
+	_, ok = Validate(rfcSecret, previous, now, 0)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "000000", now, 1)
+	assert.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "50471", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("NPRN", "anna test", "ABC")
+	assert.Equal(t, "otpauth://totp/NPRN:anna%20test?algorithm=SHA1&digits=6&issuer=NPRN&period=30&secret=ABC", uri)
+}
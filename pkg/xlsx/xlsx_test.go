@@ -0,0 +1,61 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "Sales & co")
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteRow([]Cell{{Value: "article"}, {Value: "amount"}}))
+	require.NoError(t, w.WriteRow([]Cell{{Value: "<tea> "}, {Value: "12.50", Number: true}}))
+	require.NoError(t, w.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		files[file.Name] = string(content)
+	}
+
+	assert.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files, "_rels/.rels")
+	assert.Contains(t, files, "xl/_rels/workbook.xml.rels")
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="Sales &amp; co"`)
+	assert.Contains(t, files["xl/worksheets/sheet1.xml"],
+		`<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;tea&gt; </t></is></c><c r="B2"><v>12.50</v></c></row>`)
+}
+
+func TestColumnName(t *testing.T) {
+	testTable := []struct {
+		index    int
+		excepted string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, testCase := range testTable {
+		assert.Equal(t, testCase.excepted, columnName(testCase.index))
+	}
+}